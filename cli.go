@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"samba-manager/internal/api"
+	"strings"
+)
+
+// adminUsage describes the admin subcommand
+const adminUsage = `Usage: samba-manager admin <command>
+
+Commands:
+  list                List the admins
+  add <name> [role]   Add an admin: viewer, helpdesk, share-operator or admin (default)
+  remove <name>       Remove an admin
+  passwd <name>       Set the password of an admin
+  role <name> <role>  Change the role of an admin
+
+Passwords are read from SAMBA_MANAGER_ADMIN_PASSWORD or from standard input.
+Admins added or reset with -temporary must change their password at next login.`
+
+// runAdminCommand manages the admin store from the command line and returns
+// the process exit code
+func runAdminCommand(args []string) int {
+	temporary := false
+	var rest []string
+	for _, arg := range args {
+		if arg == "-temporary" || arg == "--temporary" {
+			temporary = true
+			continue
+		}
+		rest = append(rest, arg)
+	}
+
+	if len(rest) == 0 {
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return 2
+	}
+
+	var err error
+	switch {
+	case rest[0] == "list" && len(rest) == 1:
+		var admins []api.AdminInfo
+		admins, err = api.ListAdmins()
+		for _, admin := range admins {
+			note := ""
+			if admin.MustChangePassword {
+				note = " (must change password)"
+			}
+			fmt.Printf("%s\t%s\tpassword changed %s%s\n", admin.Username, admin.Role, admin.PasswordChangedAt.Local().Format("2006-01-02 15:04"), note)
+		}
+	case rest[0] == "add" && (len(rest) == 2 || len(rest) == 3):
+		role := api.RoleAdmin
+		if len(rest) == 3 {
+			role = rest[2]
+		}
+		var password string
+		if password, err = readAdminPassword(); err == nil {
+			err = api.AddAdmin(rest[1], password, role, temporary)
+		}
+	case rest[0] == "remove" && len(rest) == 2:
+		err = api.RemoveAdmin(rest[1])
+	case rest[0] == "passwd" && len(rest) == 2:
+		var password string
+		if password, err = readAdminPassword(); err == nil {
+			err = api.SetAdminPassword(rest[1], password, temporary)
+		}
+	case rest[0] == "role" && len(rest) == 3:
+		err = api.SetAdminRole(rest[1], rest[2])
+	default:
+		fmt.Fprintln(os.Stderr, adminUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// readAdminPassword reads a password from the environment or one line of stdin.
+// SAMBA_MANAGER_PASSWORD already sets the configured admin's password.
+func readAdminPassword() (string, error) {
+	if password := os.Getenv("SAMBA_MANAGER_ADMIN_PASSWORD"); password != "" {
+		return password, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("Failed to read password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,160 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// AccountPolicy defines the regular UID/GID ranges and the accounts the
+// manager must never delete or modify
+type AccountPolicy struct {
+	UIDMin          int
+	UIDMax          int
+	GIDMin          int
+	GIDMax          int
+	ProtectedUsers  []string
+	ProtectedGroups []string
+}
+
+// UserInfo describes a Samba user with its account classification
+type UserInfo struct {
+	Name      string `json:"name"`
+	UID       int    `json:"uid"`
+	IsSystem  bool   `json:"isSystem"`
+	Protected bool   `json:"protected"`
+}
+
+var (
+	accountPolicy = AccountPolicy{
+		UIDMin:          1000,
+		UIDMax:          60000,
+		GIDMin:          1000,
+		GIDMax:          60000,
+		ProtectedUsers:  []string{"root", "nobody"},
+		ProtectedGroups: []string{"root", "wheel", "sudo", "adm", "nogroup", "nobody"},
+	}
+	accountPolicyMu sync.RWMutex
+)
+
+// SetAccountPolicy sets the UID/GID ranges and protected accounts
+func SetAccountPolicy(policy AccountPolicy) {
+	accountPolicyMu.Lock()
+	defer accountPolicyMu.Unlock()
+	accountPolicy = policy
+}
+
+// GetAccountPolicy gets the UID/GID ranges and protected accounts
+func GetAccountPolicy() AccountPolicy {
+	accountPolicyMu.RLock()
+	defer accountPolicyMu.RUnlock()
+	return accountPolicy
+}
+
+// LoadLoginDefs reads UID_MIN, UID_MAX, GID_MIN and GID_MAX from a
+// login.defs file into policy, keeping the current values for missing keys
+func LoadLoginDefs(path string, policy *AccountPolicy) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("Failed to read %s: %v", path, err)
+	}
+	defer file.Close()
+
+	targets := map[string]*int{
+		"UID_MIN": &policy.UIDMin,
+		"UID_MAX": &policy.UIDMax,
+		"GID_MIN": &policy.GIDMin,
+		"GID_MAX": &policy.GIDMax,
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		target, ok := targets[fields[0]]
+		if !ok {
+			continue
+		}
+		if value, err := strconv.Atoi(fields[1]); err == nil {
+			*target = value
+		}
+	}
+
+	return scanner.Err()
+}
+
+// IsSystemUID reports whether a UID is outside the regular user range
+func (p AccountPolicy) IsSystemUID(uid int) bool {
+	return uid < p.UIDMin || uid > p.UIDMax
+}
+
+// IsSystemGID reports whether a GID is outside the regular group range
+func (p AccountPolicy) IsSystemGID(gid int) bool {
+	return gid < p.GIDMin || gid > p.GIDMax
+}
+
+// IsProtectedUser reports whether a user is on the protected list
+func (p AccountPolicy) IsProtectedUser(name string) bool {
+	return containsString(p.ProtectedUsers, name)
+}
+
+// IsProtectedGroup reports whether a group is on the protected list
+func (p AccountPolicy) IsProtectedGroup(name string) bool {
+	return containsString(p.ProtectedGroups, name)
+}
+
+// checkUserModifiable refuses protected users and users outside the regular UID range
+func checkUserModifiable(name string) error {
+	policy := GetAccountPolicy()
+	if policy.IsProtectedUser(name) {
+		return fmt.Errorf("User %s is protected and cannot be modified", name)
+	}
+
+	account, err := getBackend().Accounts.LookupUser(name)
+	if err == nil && policy.IsSystemUID(account.UID) {
+		return fmt.Errorf("User %s is a system account (UID %d outside %d-%d) and cannot be modified",
+			name, account.UID, policy.UIDMin, policy.UIDMax)
+	}
+
+	return nil
+}
+
+// checkGroupModifiable refuses protected groups and groups outside the regular GID range
+func checkGroupModifiable(name string) error {
+	policy := GetAccountPolicy()
+	if policy.IsProtectedGroup(name) {
+		return fmt.Errorf("Group %s is protected and cannot be modified", name)
+	}
+
+	group, err := getBackend().Accounts.LookupGroup(name)
+	if err == nil && policy.IsSystemGID(group.GID) {
+		return fmt.Errorf("Group %s is a system group (GID %d outside %d-%d) and cannot be modified",
+			name, group.GID, policy.GIDMin, policy.GIDMax)
+	}
+
+	return nil
+}
+
+// checkMembershipModifiable refuses membership changes that touch a
+// protected or system user or group
+func checkMembershipModifiable(userName, groupName string) error {
+	if err := checkGroupModifiable(groupName); err != nil {
+		return err
+	}
+	return checkUserModifiable(userName)
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
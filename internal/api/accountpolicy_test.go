@@ -0,0 +1,90 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadLoginDefs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "login.defs")
+	content := "# UID_MIN 1\nUID_MIN\t\t 500\nUID_MAX 29999\nSYS_GID_MIN 100\nGID_MIN 500\nGID_MAX bogus\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("write login.defs: %v", err)
+	}
+
+	policy := AccountPolicy{UIDMin: 1000, UIDMax: 60000, GIDMin: 1000, GIDMax: 60000}
+	if err := LoadLoginDefs(path, &policy); err != nil {
+		t.Fatalf("LoadLoginDefs: %v", err)
+	}
+
+	want := AccountPolicy{UIDMin: 500, UIDMax: 29999, GIDMin: 500, GIDMax: 60000}
+	if policy.UIDMin != want.UIDMin || policy.UIDMax != want.UIDMax || policy.GIDMin != want.GIDMin || policy.GIDMax != want.GIDMax {
+		t.Errorf("policy = %+v, want %+v", policy, want)
+	}
+}
+
+func TestProtectedAccountsAreRefused(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.AddGroup("wheel", 10)
+	fake.AddGroup("auditors", 5000)
+
+	previous := GetAccountPolicy()
+	SetAccountPolicy(AccountPolicy{
+		UIDMin: 1000, UIDMax: 1001, GIDMin: 1000, GIDMax: 4999,
+		ProtectedUsers:  []string{"alice"},
+		ProtectedGroups: []string{"wheel"},
+	})
+	t.Cleanup(func() { SetAccountPolicy(previous) })
+
+	// alice is protected by name and bob (UID 1002) by range
+	refused := []struct{ method, path, body string }{
+		{http.MethodDelete, "/users/alice", ""},
+		{http.MethodPost, "/users/alice/password", `{"password": "N3wSecret!"}`},
+		{http.MethodPost, "/users/alice/rename", `{"newName": "alicia"}`},
+		{http.MethodDelete, "/users/bob", ""},
+		{http.MethodDelete, "/groups/wheel", ""},
+		{http.MethodDelete, "/groups/auditors", ""},
+		{http.MethodPost, "/groups/auditors/rename", `{"newName": "audit"}`},
+		{http.MethodPost, "/groups/staff/users/alice", ""},
+		{http.MethodPut, "/groups/auditors/users", `{"users": []}`},
+		{http.MethodPut, "/groups/staff/users", `{"users": []}`},
+		{http.MethodPut, "/groups/staff/users", `{"users": ["alice", "bob"]}`},
+		{http.MethodPost, "/groups/wheel/mapping", `{"ntName": "Wheel"}`},
+		{http.MethodPost, "/groups/auditors/mapping", `{"ntName": "Auditors"}`},
+		{http.MethodDelete, "/groups/wheel/mapping", ""},
+		{http.MethodPost, "/groups/wheel/description", `{"description": "Admins"}`},
+	}
+	for _, req := range refused {
+		if rec := serve(h, req.method, req.path, req.body); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: status = %d, want 403; body: %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	var users UserListResponse
+	decode(t, serve(h, http.MethodGet, "/users", ""), &users)
+	for _, info := range users.Accounts {
+		switch info.Name {
+		case "alice":
+			if !info.Protected || info.IsSystem {
+				t.Errorf("alice = %+v", info)
+			}
+		case "bob":
+			if info.Protected || !info.IsSystem {
+				t.Errorf("bob = %+v", info)
+			}
+		}
+	}
+
+	var groups GroupListResponse
+	decode(t, serve(h, http.MethodGet, "/groups?includeSystem=true", ""), &groups)
+	for _, group := range groups.Groups {
+		if group.Name == "auditors" && !group.IsSystem {
+			t.Errorf("auditors = %+v", group)
+		}
+		if group.Name == "wheel" && (!group.IsSystem || !group.Protected) {
+			t.Errorf("wheel = %+v", group)
+		}
+	}
+}
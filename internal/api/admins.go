@@ -0,0 +1,575 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Credentials shipped in the default configuration
+const (
+	defaultAdminUsername = "admin"
+	defaultAdminPassword = "admin"
+)
+
+// maxAdminPasswordLength is the longest password bcrypt can hash
+const maxAdminPasswordLength = 72
+
+// Admin is a manager account allowed to use the management API
+type Admin struct {
+	Username           string    `json:"username"`
+	PasswordHash       string    `json:"passwordHash"`
+	Role               string    `json:"role"`
+	MustChangePassword bool      `json:"mustChangePassword"`
+	CreatedAt          time.Time `json:"createdAt"`
+	PasswordChangedAt  time.Time `json:"passwordChangedAt"`
+}
+
+// AdminInfo describes an admin without its password hash
+type AdminInfo struct {
+	Username           string    `json:"username"`
+	Role               string    `json:"role"`
+	MustChangePassword bool      `json:"mustChangePassword"`
+	CreatedAt          time.Time `json:"createdAt"`
+	PasswordChangedAt  time.Time `json:"passwordChangedAt"`
+}
+
+// AdminsResponse represents the response for admin listing
+type AdminsResponse struct {
+	Admins []AdminInfo `json:"admins"`
+}
+
+// AdminRequest represents a request to add an admin, a viewer by default
+type AdminRequest struct {
+	Username           string `json:"username"`
+	Password           string `json:"password"`
+	Role               string `json:"role"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+}
+
+// AdminPasswordRequest represents a password change of an admin. The
+// current password is only required when admins change their own.
+type AdminPasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	Password        string `json:"password"`
+}
+
+var (
+	// adminsMu serializes read-modify-write cycles of the admin store
+	adminsMu sync.Mutex
+	// adminHashCost is the bcrypt cost of new password hashes
+	adminHashCost = bcrypt.DefaultCost
+	// verifiedCredentials caches successful logins so bcrypt doesn't run on
+	// every request. Keys are HMACs of the credentials under a secret that
+	// only lives in this process, so the cache reveals nothing offline.
+	verifiedCredentials       = make(map[string]verifiedLogin)
+	verifiedCredentialsSecret = newCredentialsSecret()
+	verifiedCredentialsMu     sync.Mutex
+)
+
+// Bounds of the login cache
+const (
+	maxVerifiedCredentials = 256
+	verifiedCredentialsTTL = 5 * time.Minute
+)
+
+// verifiedLogin is a cached login with the hash it matched, which stops
+// matching when the password changes
+type verifiedLogin struct {
+	hash    string
+	expires time.Time
+}
+
+// dummyAdminHashes are compared against when a username is unknown, so
+// unknown and known usernames take the same time to reject
+var (
+	dummyAdminHashes   = make(map[int][]byte)
+	dummyAdminHashesMu sync.Mutex
+)
+
+// InitAdminStore creates the admin store from the configured credentials
+// when it has no admins yet
+func InitAdminStore() error {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+
+	admins, err := seedAdmins()
+	if err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		if admin.MustChangePassword && admin.Username == defaultAdminUsername {
+			log.Printf("Warning: admin %s still uses the default password and must change it at next login", admin.Username)
+		}
+	}
+	return nil
+}
+
+// ListAdmins returns the admins ordered by username
+func ListAdmins() ([]AdminInfo, error) {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+
+	admins, err := seedAdmins()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := make([]AdminInfo, 0, len(admins))
+	for _, admin := range admins {
+		infos = append(infos, AdminInfo{
+			Username:           admin.Username,
+			Role:               effectiveRole(admin.Role),
+			MustChangePassword: admin.MustChangePassword,
+			CreatedAt:          admin.CreatedAt,
+			PasswordChangedAt:  admin.PasswordChangedAt,
+		})
+	}
+	return infos, nil
+}
+
+// AddAdmin adds an admin with a role and a password checked against the
+// password policy
+func AddAdmin(username, password, role string, mustChangePassword bool) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	if err := validateAdminPassword(username, "", password); err != nil {
+		return err
+	}
+
+	return updateAdmins(func(admins []Admin) ([]Admin, error) {
+		if findAdmin(admins, username) >= 0 {
+			return nil, fmt.Errorf("Admin %s already exists", username)
+		}
+
+		hash, err := hashAdminPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		return append(admins, Admin{
+			Username:           username,
+			PasswordHash:       hash,
+			Role:               role,
+			MustChangePassword: mustChangePassword,
+			CreatedAt:          now,
+			PasswordChangedAt:  now,
+		}), nil
+	})
+}
+
+// RemoveAdmin removes an admin, refusing to remove the last full admin
+func RemoveAdmin(username string) error {
+	return updateAdmins(func(admins []Admin) ([]Admin, error) {
+		i := findAdmin(admins, username)
+		if i < 0 {
+			return nil, fmt.Errorf("Admin %s does not exist", username)
+		}
+		if isLastFullAdmin(admins, i) {
+			return nil, fmt.Errorf("Admin %s is the last full admin and cannot be removed", username)
+		}
+		return append(admins[:i], admins[i+1:]...), nil
+	})
+}
+
+// SetAdminRole changes the role of an admin, refusing to demote the last
+// full admin
+func SetAdminRole(username, role string) error {
+	if err := validateRole(role); err != nil {
+		return err
+	}
+
+	return updateAdmins(func(admins []Admin) ([]Admin, error) {
+		i := findAdmin(admins, username)
+		if i < 0 {
+			return nil, fmt.Errorf("Admin %s does not exist", username)
+		}
+		if role != RoleAdmin && isLastFullAdmin(admins, i) {
+			return nil, fmt.Errorf("Admin %s is the last full admin and must keep the %s role", username, RoleAdmin)
+		}
+		admins[i].Role = role
+		return admins, nil
+	})
+}
+
+// SetAdminPassword replaces the password of an admin
+func SetAdminPassword(username, password string, mustChangePassword bool) error {
+	return updateAdmins(func(admins []Admin) ([]Admin, error) {
+		i := findAdmin(admins, username)
+		if i < 0 {
+			return nil, fmt.Errorf("Admin %s does not exist", username)
+		}
+		if err := validateAdminPassword(username, "", password); err != nil {
+			return nil, err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(admins[i].PasswordHash), []byte(password)) == nil {
+			return nil, fmt.Errorf("New password must differ from the current password")
+		}
+
+		hash, err := hashAdminPassword(password)
+		if err != nil {
+			return nil, err
+		}
+		admins[i].PasswordHash = hash
+		admins[i].MustChangePassword = mustChangePassword
+		admins[i].PasswordChangedAt = time.Now().UTC()
+		return admins, nil
+	})
+}
+
+// GetAdmins lists the admins
+func (h *APIHandler) GetAdmins(w http.ResponseWriter, r *http.Request) {
+	admins, err := ListAdmins()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(AdminsResponse{Admins: admins})
+}
+
+// CreateAdmin adds an admin
+func (h *APIHandler) CreateAdmin(w http.ResponseWriter, r *http.Request) {
+	var request AdminRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if _, exists := lookupAdmin(request.Username); exists {
+		writeError(w, fmt.Sprintf("Admin %s already exists", request.Username), http.StatusConflict)
+		return
+	}
+
+	if request.Role == "" {
+		request.Role = RoleViewer
+	}
+
+	err := AddAdmin(request.Username, request.Password, request.Role, request.MustChangePassword)
+	recordAudit(r, "admin.create", request.Username, "", err)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Admin %s created", request.Username),
+	})
+}
+
+// DeleteAdmin removes an admin
+func (h *APIHandler) DeleteAdmin(w http.ResponseWriter, r *http.Request) {
+	username := getRouteParam(regexp.MustCompile(`^/admins/([^/]+)$`), r.URL.Path, 1)
+
+	if _, exists := lookupAdmin(username); !exists {
+		writeError(w, fmt.Sprintf("Admin %s does not exist", username), http.StatusNotFound)
+		return
+	}
+
+	err := RemoveAdmin(username)
+	recordAudit(r, "admin.delete", username, "", err)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Admin %s deleted", username),
+	})
+}
+
+// ChangeAdminPassword changes the own password, which requires the current
+// one, or resets another admin's password, who must change it at next login
+func (h *APIHandler) ChangeAdminPassword(w http.ResponseWriter, r *http.Request) {
+	username := getRouteParam(regexp.MustCompile(`^/admins/([^/]+)/password$`), r.URL.Path, 1)
+
+	current, ok := requestAdmin(r)
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var request AdminPasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	admin, exists := lookupAdmin(username)
+	if !exists {
+		writeError(w, fmt.Sprintf("Admin %s does not exist", username), http.StatusNotFound)
+		return
+	}
+
+	own := current.Username == username
+	// Every role may change its own password, only full admins reset others
+	if !own && !roleAllows(current.Role, PermissionAdmin) {
+		writeError(w, fmt.Sprintf("Role %s cannot reset the password of other admins", effectiveRole(current.Role)), http.StatusForbidden)
+		return
+	}
+	if own && bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(request.CurrentPassword)) != nil {
+		writeError(w, "Current password is incorrect", http.StatusForbidden)
+		return
+	}
+
+	err := SetAdminPassword(username, request.Password, !own)
+	recordAudit(r, "admin.password", username, map[bool]string{true: "changed", false: "reset"}[own], err)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Password of admin %s changed", username),
+	})
+}
+
+// authenticateAdmin checks credentials against the admin store
+func authenticateAdmin(username, password string) (Admin, bool) {
+	admin, exists := lookupAdmin(username)
+
+	mac := hmac.New(sha256.New, verifiedCredentialsSecret)
+	mac.Write([]byte(username + "\x00" + password))
+	key := hex.EncodeToString(mac.Sum(nil))
+
+	now := time.Now()
+	verifiedCredentialsMu.Lock()
+	login, cached := verifiedCredentials[key]
+	if cached && now.After(login.expires) {
+		delete(verifiedCredentials, key)
+		cached = false
+	}
+	verifiedCredentialsMu.Unlock()
+	// A cached login is only valid until the password changes
+	if exists && cached && login.hash == admin.PasswordHash {
+		return admin, true
+	}
+
+	if !exists {
+		bcrypt.CompareHashAndPassword(dummyAdminHash(), []byte(password))
+		return Admin{}, false
+	}
+	if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)) != nil {
+		return Admin{}, false
+	}
+
+	verifiedCredentialsMu.Lock()
+	if _, ok := verifiedCredentials[key]; !ok && len(verifiedCredentials) >= maxVerifiedCredentials {
+		evictVerifiedCredential(now)
+	}
+	verifiedCredentials[key] = verifiedLogin{hash: admin.PasswordHash, expires: now.Add(verifiedCredentialsTTL)}
+	verifiedCredentialsMu.Unlock()
+
+	return admin, true
+}
+
+// evictVerifiedCredential makes room in the login cache by dropping the
+// expired logins, or the one expiring first. The caller must hold
+// verifiedCredentialsMu.
+func evictVerifiedCredential(now time.Time) {
+	oldestKey := ""
+	var oldest time.Time
+	for key, login := range verifiedCredentials {
+		if now.After(login.expires) {
+			delete(verifiedCredentials, key)
+			continue
+		}
+		if oldestKey == "" || login.expires.Before(oldest) {
+			oldestKey, oldest = key, login.expires
+		}
+	}
+	if len(verifiedCredentials) >= maxVerifiedCredentials {
+		delete(verifiedCredentials, oldestKey)
+	}
+}
+
+// newCredentialsSecret returns the random key of the login cache
+func newCredentialsSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("Failed to generate the login cache key: %v", err))
+	}
+	return secret
+}
+
+// dummyAdminHash returns a hash of the current cost to reject unknown admins with
+func dummyAdminHash() []byte {
+	dummyAdminHashesMu.Lock()
+	defer dummyAdminHashesMu.Unlock()
+
+	if hash, ok := dummyAdminHashes[adminHashCost]; ok {
+		return hash
+	}
+	hash, _ := bcrypt.GenerateFromPassword([]byte("samba-manager"), adminHashCost)
+	dummyAdminHashes[adminHashCost] = hash
+	return hash
+}
+
+// lookupAdmin finds an admin in the store
+func lookupAdmin(username string) (Admin, bool) {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+
+	admins, err := seedAdmins()
+	if err != nil {
+		log.Printf("Failed to read admins: %v", err)
+		return Admin{}, false
+	}
+	if i := findAdmin(admins, username); i >= 0 {
+		return admins[i], true
+	}
+	return Admin{}, false
+}
+
+// updateAdmins applies update to the stored admins and saves them
+func updateAdmins(update func(admins []Admin) ([]Admin, error)) error {
+	adminsMu.Lock()
+	defer adminsMu.Unlock()
+
+	admins, err := seedAdmins()
+	if err != nil {
+		return err
+	}
+
+	admins, err = update(admins)
+	if err != nil {
+		return err
+	}
+
+	return saveAdmins(admins)
+}
+
+// seedAdmins loads the admins, creating the first one from the configured
+// credentials when the store is empty; adminsMu must be held
+func seedAdmins() ([]Admin, error) {
+	admins, err := loadAdmins()
+	if err != nil || len(admins) > 0 {
+		return admins, err
+	}
+
+	authConfigMu.RLock()
+	config := authConfig
+	authConfigMu.RUnlock()
+	if config.Username == "" || config.Password == "" {
+		return admins, nil
+	}
+
+	hash, err := hashAdminPassword(config.Password)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	admins = []Admin{{
+		Username:           config.Username,
+		PasswordHash:       hash,
+		Role:               RoleAdmin,
+		MustChangePassword: config.Username == defaultAdminUsername && config.Password == defaultAdminPassword,
+		CreatedAt:          now,
+		PasswordChangedAt:  now,
+	}}
+
+	if err := saveAdmins(admins); err != nil {
+		return nil, err
+	}
+	log.Printf("Created admin %s from the configured credentials in %s", config.Username, adminsPath())
+
+	return admins, nil
+}
+
+// adminsPath returns the file storing the admins
+func adminsPath() string {
+	return filepath.Join(GetDataDir(), "admins.json")
+}
+
+// loadAdmins reads the admin store; a missing file is empty
+func loadAdmins() ([]Admin, error) {
+	admins := []Admin{}
+
+	data, err := os.ReadFile(adminsPath())
+	if os.IsNotExist(err) {
+		return admins, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read admins: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &admins); err != nil {
+		return nil, fmt.Errorf("Failed to parse admins: %v", err)
+	}
+
+	return admins, nil
+}
+
+// saveAdmins writes the admin store readable by the manager only
+func saveAdmins(admins []Admin) error {
+	sort.Slice(admins, func(i, j int) bool {
+		return admins[i].Username < admins[j].Username
+	})
+
+	data, err := json.MarshalIndent(admins, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(adminsPath(), data, 0600)
+}
+
+// isLastFullAdmin reports whether the admin at index i is the only full admin
+func isLastFullAdmin(admins []Admin, i int) bool {
+	if effectiveRole(admins[i].Role) != RoleAdmin {
+		return false
+	}
+	for j, admin := range admins {
+		if j != i && effectiveRole(admin.Role) == RoleAdmin {
+			return false
+		}
+	}
+	return true
+}
+
+// findAdmin returns the index of an admin or -1
+func findAdmin(admins []Admin, username string) int {
+	for i, admin := range admins {
+		if admin.Username == username {
+			return i
+		}
+	}
+	return -1
+}
+
+// validateAdminPassword applies the password policy and bcrypt's length limit
+func validateAdminPassword(username, currentPassword, password string) error {
+	if len(password) > maxAdminPasswordLength {
+		return fmt.Errorf("Password must be at most %d bytes long", maxAdminPasswordLength)
+	}
+	return validatePassword(username, currentPassword, password, GetPasswordPolicy())
+}
+
+// hashAdminPassword hashes a password with bcrypt
+func hashAdminPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), adminHashCost)
+	if err != nil {
+		return "", fmt.Errorf("Failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
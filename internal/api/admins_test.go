@@ -0,0 +1,122 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveAuthenticated sends a request through the authentication middleware
+func serveAuthenticated(h http.Handler, method, path, body, username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.SetBasicAuth(username, password)
+	rec := httptest.NewRecorder()
+	BasicAuthMiddleware(http.StripPrefix("/api", h)).ServeHTTP(rec, req)
+	return rec
+}
+
+func TestBasicAuthUsesAdminStore(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	if rec := serveAuthenticated(h, http.MethodGet, "/api/status", "", "operator", "Operat0r-pass"); rec.Code != http.StatusOK {
+		t.Errorf("valid login: status = %d", rec.Code)
+	}
+	for _, credentials := range [][2]string{{"operator", "wrong"}, {"ghost", "Operat0r-pass"}, {"", ""}} {
+		if rec := serveAuthenticated(h, http.MethodGet, "/api/status", "", credentials[0], credentials[1]); rec.Code != http.StatusUnauthorized {
+			t.Errorf("login %v: status = %d", credentials, rec.Code)
+		}
+	}
+
+	data, err := os.ReadFile(adminsPath())
+	if err != nil {
+		t.Fatalf("read admins: %v", err)
+	}
+	if strings.Contains(string(data), "Operat0r-pass") || !strings.Contains(string(data), "$2a$") {
+		t.Errorf("admin store holds no bcrypt hash: %s", data)
+	}
+
+	// A changed password invalidates the cached login
+	if err := SetAdminPassword("operator", "An0ther-pass", false); err != nil {
+		t.Fatalf("set password: %v", err)
+	}
+	if rec := serveAuthenticated(h, http.MethodGet, "/api/status", "", "operator", "Operat0r-pass"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("old password: status = %d", rec.Code)
+	}
+}
+
+func TestDefaultCredentialsMustBeChanged(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	rec := serveAuthenticated(h, http.MethodGet, "/api/status", "", "admin", "admin")
+	if rec.Code != http.StatusForbidden || !strings.Contains(rec.Body.String(), "mustChangePassword") {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = serveAuthenticated(h, http.MethodPost, "/api/admins/admin/password", `{"currentPassword": "wrong", "password": "Adm1n-secret"}`, "admin", "admin")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("wrong current password: status = %d", rec.Code)
+	}
+	rec = serveAuthenticated(h, http.MethodPost, "/api/admins/admin/password", `{"currentPassword": "admin", "password": "Adm1n-secret"}`, "admin", "admin")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("change password: status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	if rec := serveAuthenticated(h, http.MethodGet, "/api/status", "", "admin", "Adm1n-secret"); rec.Code != http.StatusOK {
+		t.Errorf("new password: status = %d", rec.Code)
+	}
+}
+
+func TestLastAdminCannotBeRemoved(t *testing.T) {
+	newTestAPI(t)
+
+	if err := RemoveAdmin("operator"); err != nil {
+		t.Fatalf("remove operator: %v", err)
+	}
+	if err := RemoveAdmin("admin"); err == nil {
+		t.Error("removed the last admin")
+	}
+	if err := AddAdmin("admin", "Adm1n-secret", RoleAdmin, false); err == nil {
+		t.Error("added a duplicate admin")
+	}
+}
+
+func TestLoginCacheEvictsOneEntry(t *testing.T) {
+	newTestAPI(t)
+
+	verifiedCredentialsMu.Lock()
+	verifiedCredentials = make(map[string]verifiedLogin)
+	now := time.Now()
+	for i := 0; i < maxVerifiedCredentials; i++ {
+		verifiedCredentials[fmt.Sprintf("key%d", i)] = verifiedLogin{hash: "x", expires: now.Add(time.Duration(i+1) * time.Minute)}
+	}
+	verifiedCredentialsMu.Unlock()
+
+	if _, ok := authenticateAdmin("operator", "Operat0r-pass"); !ok {
+		t.Fatal("login failed")
+	}
+
+	verifiedCredentialsMu.Lock()
+	defer verifiedCredentialsMu.Unlock()
+	if len(verifiedCredentials) != maxVerifiedCredentials {
+		t.Errorf("cached logins = %d, want %d", len(verifiedCredentials), maxVerifiedCredentials)
+	}
+	if _, ok := verifiedCredentials["key0"]; ok {
+		t.Error("login expiring first was kept")
+	}
+	if _, ok := verifiedCredentials["key1"]; !ok {
+		t.Error("more than one login was evicted")
+	}
+	added := 0
+	for key := range verifiedCredentials {
+		if !strings.HasPrefix(key, "key") {
+			added++
+		}
+	}
+	if added != 1 {
+		t.Errorf("cached new logins = %d, want 1", added)
+	}
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AuditEntry records one administrative action
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Actor   string    `json:"actor"`
+	Client  string    `json:"client"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Detail  string    `json:"detail,omitempty"`
+	Success bool      `json:"success"`
+	Error   string    `json:"error,omitempty"`
+}
+
+// AuditLogResponse represents the response for audit log listing
+type AuditLogResponse struct {
+	Entries []AuditEntry `json:"entries"`
+}
+
+// defaultAuditLimit is the number of entries returned without ?limit=
+const defaultAuditLimit = 100
+
+// auditMu serializes appends to the audit log
+var auditMu sync.Mutex
+
+// auditLogPath returns the file storing the audit log
+func auditLogPath() string {
+	return filepath.Join(GetDataDir(), "audit.log")
+}
+
+// recordAudit appends an action and its outcome to the audit log. Failures
+// to write the log are logged but never fail the action itself.
+func recordAudit(r *http.Request, action, target, detail string, actionErr error) {
+	actor, _, _ := r.BasicAuth()
+	entry := AuditEntry{
+		Time:    time.Now().UTC(),
+		Actor:   actor,
+		Client:  r.RemoteAddr,
+		Action:  action,
+		Target:  target,
+		Detail:  detail,
+		Success: actionErr == nil,
+	}
+	if actionErr != nil {
+		entry.Error = actionErr.Error()
+	}
+
+	log.Printf("Audit: %s %s %s by %s: success=%v %s", entry.Action, entry.Target, entry.Detail, entry.Actor, entry.Success, entry.Error)
+
+	if err := appendAuditEntry(entry); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+}
+
+// appendAuditEntry writes one JSON line to the audit log
+func appendAuditEntry(entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	path := auditLogPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+// readAuditLog returns up to limit of the most recent entries, newest first
+func readAuditLog(limit int) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+
+	file, err := os.Open(auditLogPath())
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read audit log: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to read audit log: %v", err)
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+
+	return entries, nil
+}
+
+// GetAuditLog returns the most recent audit entries, ?limit= sets how many
+func (h *APIHandler) GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	limit := defaultAuditLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 {
+			writeError(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := readAuditLog(limit)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(AuditLogResponse{Entries: entries})
+}
@@ -2,18 +2,31 @@ package api
 
 import (
 	"net/http"
+	"regexp"
+	"strings"
+	"sync"
 )
 
-// AuthConfig contains authentication configuration
+// AuthConfig contains the credentials of the first admin, used when the
+// admin store is still empty
 type AuthConfig struct {
 	Username string
 	Password string
 }
 
-var authConfig AuthConfig
+var (
+	authConfig   AuthConfig
+	authConfigMu sync.RWMutex
+)
+
+// ownPasswordChangeRegex matches the password change allowed while an admin
+// must change its password
+var ownPasswordChangeRegex = regexp.MustCompile(`^/admins/([^/]+)/password$`)
 
 // SetAuthConfig sets the authentication configuration
 func SetAuthConfig(username, password string) {
+	authConfigMu.Lock()
+	defer authConfigMu.Unlock()
 	authConfig.Username = username
 	authConfig.Password = password
 }
@@ -34,7 +47,8 @@ func BasicAuthMiddleware(next http.Handler) http.Handler {
 		}
 
 		// Check credentials
-		if username != authConfig.Username || password != authConfig.Password {
+		admin, ok := authenticateAdmin(username, password)
+		if !ok {
 			// Never send WWW-Authenticate header - this prevents browser prompt
 			w.Header().Set("Content-Type", "application/json")
 			w.WriteHeader(http.StatusUnauthorized)
@@ -42,7 +56,32 @@ func BasicAuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Authentication successful, call the next handler
-		next.ServeHTTP(w, r)
+		// Admins with a default or reset password may only change it
+		if admin.MustChangePassword && !isOwnPasswordChange(r, admin.Username) && !isMeRequest(r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": "Password change required", "mustChangePassword": true}`))
+			return
+		}
+
+		// Authentication successful, call the next handler with the admin
+		// whose role the routes are checked against
+		next.ServeHTTP(w, withAdmin(r, admin))
 	})
 }
+
+// isOwnPasswordChange reports whether a request changes the password of an
+// admin, with or without the /api prefix
+func isOwnPasswordChange(r *http.Request, username string) bool {
+	if r.Method != http.MethodPost {
+		return false
+	}
+	match := ownPasswordChangeRegex.FindStringSubmatch(strings.TrimPrefix(r.URL.Path, "/api"))
+	return match != nil && match[1] == username
+}
+
+// isMeRequest reports whether a request asks who is logged in, which the GUI
+// needs to offer the password change
+func isMeRequest(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.TrimPrefix(r.URL.Path, "/api") == "/me"
+}
@@ -0,0 +1,295 @@
+package api
+
+import (
+	"os"
+	"sync"
+	"time"
+)
+
+// Account describes a Unix user account as resolved through NSS
+type Account struct {
+	Name  string
+	UID   int
+	GID   int
+	Home  string
+	Shell string
+}
+
+// DirEntry describes a directory entry with its ownership
+type DirEntry struct {
+	Name    string
+	Path    string
+	IsDir   bool
+	UID     int
+	GID     int
+	ModTime time.Time
+}
+
+// GroupEntry describes a Unix group as resolved through NSS
+type GroupEntry struct {
+	Name    string
+	GID     int
+	Members []string
+}
+
+// PassDB manages accounts in the Samba password database
+type PassDB interface {
+	ListUsers() ([]string, error)
+	AddUser(username, password string) error
+	DeleteUser(username string) error
+	SetPassword(username, password string) error
+	// ChangePassword changes a password only if currentPassword is correct
+	ChangePassword(username, currentPassword, newPassword string) error
+	// ExportHash returns the NT hash of a user's password
+	ExportHash(username string) (string, error)
+	// ImportHash adds an existing Unix user to passdb with the given NT hash
+	ImportHash(username, ntHash string) error
+}
+
+// AccountManager manages Unix users and groups
+type AccountManager interface {
+	LookupUser(name string) (Account, error)
+	ListUsers() ([]Account, error)
+	CreateUser(name string) error
+	DeleteUser(name string) error
+	RenameUser(oldName, newName string) error
+	SetUserHome(name, home string) error
+	LookupGroup(name string) (GroupEntry, error)
+	ListGroups() ([]GroupEntry, error)
+	CreateGroup(name string) error
+	DeleteGroup(name string) error
+	RenameGroup(oldName, newName string) error
+	AddGroupMember(group, user string) error
+	RemoveGroupMember(group, user string) error
+	// SetGroupMembers replaces the supplementary members of a group in one step
+	SetGroupMembers(group string, users []string) error
+}
+
+// ACLManager reads and modifies POSIX ACLs
+type ACLManager interface {
+	GetACL(path string) (ShareACLs, error)
+	// ClearACL removes all extended ACL entries recursively
+	ClearACL(path string) error
+	// ModifyACL applies a setfacl entry (e.g. "d:u:alice:rwx") recursively
+	ModifyACL(path, entry string) error
+	// RemoveACL removes an entry such as "g:staff" or "d:g:staff" recursively
+	RemoveACL(path, entry string) error
+}
+
+// FileSystem performs filesystem operations on share and home directories
+type FileSystem interface {
+	Stat(path string) (os.FileInfo, error)
+	MkdirAll(path string, perm os.FileMode) error
+	Chown(path string, uid, gid int) error
+	// Chmod accepts octal or symbolic modes
+	Chmod(path, mode string) error
+	// CopyTree copies the contents of src into dst owned by uid:gid
+	CopyTree(src, dst string, uid, gid int) error
+	ReadDir(path string) ([]DirEntry, error)
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	// Rename moves a file or directory, across filesystems if needed
+	Rename(src, dst string) error
+	RemoveAll(path string) error
+	// Archive writes a gzip-compressed tarball of the src directory to dst
+	Archive(src, dst string) error
+}
+
+// QuotaManager sets disk quotas
+type QuotaManager interface {
+	// SetUserQuota limits a user's block usage on the filesystem holding path
+	SetUserQuota(user, path string, softKB, hardKB uint64) error
+}
+
+// GroupMapping maps a Unix group to a Windows group SID
+type GroupMapping struct {
+	NTName    string `json:"ntName"`
+	SID       string `json:"sid"`
+	UnixGroup string `json:"unixGroup"`
+	// Type is domain, local or builtin
+	Type    string `json:"type"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// GroupMapper manages the Samba group mapping database
+type GroupMapper interface {
+	ListMappings() ([]GroupMapping, error)
+	// AddMapping creates a mapping; an empty SID lets Samba allocate one
+	AddMapping(mapping GroupMapping) error
+	DeleteMapping(ntName string) error
+}
+
+// SambaSession is an authenticated SMB session
+type SambaSession struct {
+	SessionID  string `json:"sessionId,omitempty"`
+	PID        string `json:"pid"`
+	User       string `json:"user"`
+	Group      string `json:"group"`
+	ClientIP   string `json:"clientIp"`
+	Protocol   string `json:"protocol"`
+	Encryption string `json:"encryption"`
+	Signing    string `json:"signing"`
+}
+
+// TreeConnect is a session's connection to a share
+type TreeConnect struct {
+	Share       string `json:"share"`
+	PID         string `json:"pid"`
+	SessionID   string `json:"sessionId,omitempty"`
+	User        string `json:"user"`
+	ClientIP    string `json:"clientIp"`
+	ConnectedAt string `json:"connectedAt"`
+	Encryption  string `json:"encryption"`
+	Signing     string `json:"signing"`
+}
+
+// OpenFile is a file held open by a client, with its share mode and lock
+type OpenFile struct {
+	PID       string `json:"pid"`
+	UID       int    `json:"uid"`
+	User      string `json:"user"`
+	Share     string `json:"share"`
+	SharePath string `json:"sharePath"`
+	Name      string `json:"name"`
+	DenyMode  string `json:"denyMode"`
+	Access    string `json:"access"`
+	// Lock is the oplock or lease type, such as BATCH or LEASE(RWH)
+	Lock     string `json:"lock"`
+	OpenedAt string `json:"openedAt"`
+}
+
+// SambaStatus is a snapshot of the server's clients
+type SambaStatus struct {
+	Sessions    []SambaSession
+	Connections []TreeConnect
+	OpenFiles   []OpenFile
+}
+
+// SessionMonitor reports the sessions, share connections and open files of smbd
+type SessionMonitor interface {
+	Status() (SambaStatus, error)
+}
+
+// JournalEntry is one message from the system journal
+type JournalEntry struct {
+	Cursor   string
+	Time     time.Time
+	Unit     string
+	Priority int
+	Message  string
+}
+
+// Journal reads service messages from the system journal
+type Journal interface {
+	// Entries returns up to limit of the newest entries of the units between
+	// since and until, oldest first, or only those after afterCursor when it
+	// is set. Zero times leave the range open.
+	Entries(units []string, afterCursor string, since, until time.Time, limit int) ([]JournalEntry, error)
+}
+
+// ServiceManager controls system services
+type ServiceManager interface {
+	IsInstalled(unit string) (bool, error)
+	IsActive(unit string) (bool, error)
+	IsEnabled(unit string) (bool, error)
+	ActiveSince(unit string) (time.Time, error)
+	Start(unit string) error
+	Stop(unit string) error
+	Restart(unit string) error
+	Enable(unit string) error
+	Disable(unit string) error
+}
+
+// SambaControl sends messages to running Samba daemons
+type SambaControl interface {
+	// ReloadConfig makes all daemons re-read smb.conf without dropping clients
+	ReloadConfig() error
+	// KillSession shuts down the smbd process serving a client, closing its files
+	KillSession(pid string) error
+	// CloseShare disconnects every client from a share
+	CloseShare(share string) error
+	// SetDebugLevel sets the debug level of "all", a daemon or a PID, such as "1 auth:5"
+	SetDebugLevel(destination, level string) error
+}
+
+// DiskUsage reports filesystem and directory usage
+type DiskUsage interface {
+	Filesystems() ([]DiskInfo, error)
+	// DirectorySize returns the human-readable size of a directory tree
+	DirectorySize(path string) (string, error)
+}
+
+// HealthProber runs the low-level probes of the health report
+type HealthProber interface {
+	// Dial opens and closes a TCP connection to a host:port address
+	Dial(address string, timeout time.Duration) error
+	// InterfaceAddrs returns the IP addresses of the interfaces matching a
+	// name or shell pattern such as eth*
+	InterfaceAddrs(pattern string) ([]string, error)
+	// Testparm validates a Samba configuration file and returns its warnings
+	Testparm(configPath string) ([]string, error)
+	// ListShares lists the shares of a host anonymously, which requires a
+	// working SMB negotiation
+	ListShares(host string) error
+	// NegotiateSMB2 sends an SMB2 NEGOTIATE to a host:port address and
+	// returns the dialect the server selected
+	NegotiateSMB2(address string, timeout time.Duration) (string, error)
+}
+
+// SystemBackend groups every system interaction used by the API
+type SystemBackend struct {
+	PassDB   PassDB
+	Accounts AccountManager
+	ACLs     ACLManager
+	Files    FileSystem
+	Services ServiceManager
+	Disks    DiskUsage
+	Quotas   QuotaManager
+	GroupMap GroupMapper
+	Control  SambaControl
+	Sessions SessionMonitor
+	Journal  Journal
+	Health   HealthProber
+}
+
+var (
+	backend   = NewSystemBackend()
+	backendMu sync.RWMutex
+)
+
+// NewSystemBackend returns a backend operating on the local host
+func NewSystemBackend() *SystemBackend {
+	return &SystemBackend{
+		PassDB:   systemPassDB{},
+		Accounts: systemAccounts{},
+		ACLs:     systemACLs{},
+		Files:    osFileSystem{},
+		Services: detectedServices(),
+		Disks:    dfDiskUsage{},
+		Quotas:   setquotaQuotas{},
+		GroupMap: netGroupMapper{},
+		Control:  smbcontrolMessages{},
+		Sessions: smbstatusMonitor{},
+		Journal:  journalctlJournal{},
+		Health:   systemProbes{},
+	}
+}
+
+// detectedServices returns the service manager of the detected init system
+func detectedServices() ServiceManager {
+	services, _ := NewServiceManager(InitSystemAuto)
+	return services
+}
+
+// SetBackend replaces the system backend used by all handlers
+func SetBackend(b *SystemBackend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+}
+
+// getBackend gets the system backend used by all handlers
+func getBackend() *SystemBackend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return backend
+}
@@ -0,0 +1,1034 @@
+package api
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FakeSystem is an in-memory system used to exercise the API without root
+// privileges or a Samba installation. All state is exported for inspection.
+type FakeSystem struct {
+	mu sync.Mutex
+
+	Passwords map[string]string       // passdb: username -> password
+	Accounts  map[string]Account      // Unix users
+	Groups    map[string]*GroupEntry  // Unix groups
+	ACLs      map[string][]ACLEntry   // path -> extended ACL entries
+	Dirs      map[string]fakeDir      // path -> directory metadata
+	Files     map[string][]byte       // path -> regular file content
+	Archives  map[string]string       // archive path -> archived directory
+	Units     map[string]bool         // installed unit -> enabled
+	Services  map[string]time.Time    // active unit -> start time
+	Restarts  map[string]int          // unit -> number of restarts
+	Reloads   int                     // number of reload-config messages
+	Killed    []string                // PIDs sent shutdown
+	Closed    []string                // shares sent close-share
+	Debug     map[string]string       // destination -> last debug level sent
+	Disks     []DiskInfo              // reported filesystems
+	DirSizes  map[string]string       // path -> du size
+	Quotas    map[string]uint64       // user -> hard block limit in KB
+	GroupMaps map[string]GroupMapping // NT group name -> mapping
+	Clients   SambaStatus             // reported sessions, connections and open files
+	Journal   []JournalEntry          // journal messages, oldest first
+	Refused   map[string]bool         // host:port addresses refusing connections
+	NICs      map[string][]string     // network interface -> addresses
+	Warnings  []string                // testparm warnings
+	ListErr   error                   // result of listing shares with smbclient
+	Failures  map[string]error        // "operation name" -> error returned instead
+	nextID    int
+}
+
+// fakeDir describes a directory in the fake filesystem
+type fakeDir struct {
+	Mode os.FileMode
+	UID  int
+	GID  int
+}
+
+// NewFakeSystem creates an empty fake system with smbd running
+func NewFakeSystem() *FakeSystem {
+	return &FakeSystem{
+		Passwords: make(map[string]string),
+		Accounts:  make(map[string]Account),
+		Groups:    make(map[string]*GroupEntry),
+		ACLs:      make(map[string][]ACLEntry),
+		Dirs:      make(map[string]fakeDir),
+		Files:     make(map[string][]byte),
+		Archives:  make(map[string]string),
+		Units:     map[string]bool{"smbd": true},
+		Services:  map[string]time.Time{"smbd": time.Now()},
+		Restarts:  make(map[string]int),
+		DirSizes:  make(map[string]string),
+		Quotas:    make(map[string]uint64),
+		GroupMaps: make(map[string]GroupMapping),
+		Debug:     make(map[string]string),
+		Refused:   make(map[string]bool),
+		NICs:      map[string][]string{"lo": {"127.0.0.1"}},
+		Failures:  make(map[string]error),
+		nextID:    1000,
+	}
+}
+
+// Backend returns a SystemBackend backed by the fake system
+func (f *FakeSystem) Backend() *SystemBackend {
+	return &SystemBackend{
+		PassDB:   fakePassDB{f},
+		Accounts: fakeAccounts{f},
+		ACLs:     fakeACLs{f},
+		Files:    fakeFileSystem{f},
+		Services: fakeServices{f},
+		Disks:    fakeDiskUsage{f},
+		Quotas:   fakeQuotas{f},
+		GroupMap: fakeGroupMapper{f},
+		Control:  fakeControl{f},
+		Sessions: fakeSessions{f},
+		Journal:  fakeJournal{f},
+		Health:   fakeProbes{f},
+	}
+}
+
+// AddUser adds a Unix account with a passdb entry
+func (f *FakeSystem) AddUser(name, password string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.addAccount(name)
+	f.Passwords[name] = password
+}
+
+// AddGroup adds a Unix group with the given GID and members
+func (f *FakeSystem) AddGroup(name string, gid int, members ...string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if members == nil {
+		members = []string{}
+	}
+	f.Groups[name] = &GroupEntry{Name: name, GID: gid, Members: members}
+}
+
+// addAccount creates a Unix account and its primary group; f.mu must be held
+func (f *FakeSystem) addAccount(name string) Account {
+	f.nextID++
+	account := Account{Name: name, UID: f.nextID, GID: f.nextID, Home: "/home/" + name, Shell: "/sbin/nologin"}
+	f.Accounts[name] = account
+	f.Groups[name] = &GroupEntry{Name: name, GID: f.nextID, Members: []string{}}
+	return account
+}
+
+// fakePassDB implements PassDB on a FakeSystem
+type fakePassDB struct{ f *FakeSystem }
+
+func (p fakePassDB) ListUsers() ([]string, error) {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	users := make([]string, 0, len(p.f.Passwords))
+	for name := range p.f.Passwords {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (p fakePassDB) AddUser(username, password string) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if _, ok := p.f.Accounts[username]; !ok {
+		return fmt.Errorf("Unix user %s does not exist", username)
+	}
+	if _, ok := p.f.Passwords[username]; ok {
+		return fmt.Errorf("User %s already exists in passdb", username)
+	}
+	p.f.Passwords[username] = password
+	return nil
+}
+
+func (p fakePassDB) DeleteUser(username string) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if _, ok := p.f.Passwords[username]; !ok {
+		return fmt.Errorf("User %s does not exist in passdb", username)
+	}
+	delete(p.f.Passwords, username)
+	return nil
+}
+
+func (p fakePassDB) SetPassword(username, password string) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if _, ok := p.f.Passwords[username]; !ok {
+		return fmt.Errorf("User %s does not exist in passdb", username)
+	}
+	p.f.Passwords[username] = password
+	return nil
+}
+
+func (p fakePassDB) ChangePassword(username, currentPassword, newPassword string) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if current, ok := p.f.Passwords[username]; !ok || current != currentPassword {
+		return fmt.Errorf("NT_STATUS_LOGON_FAILURE")
+	}
+	p.f.Passwords[username] = newPassword
+	return nil
+}
+
+// ExportHash returns a fake hash that ImportHash turns back into the password
+func (p fakePassDB) ExportHash(username string) (string, error) {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	password, ok := p.f.Passwords[username]
+	if !ok {
+		return "", fmt.Errorf("User %s does not exist in passdb", username)
+	}
+	return "NT:" + password, nil
+}
+
+func (p fakePassDB) ImportHash(username, ntHash string) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if err := p.f.Failures["ImportHash "+username]; err != nil {
+		return err
+	}
+	if _, ok := p.f.Accounts[username]; !ok {
+		return fmt.Errorf("Unix user %s does not exist", username)
+	}
+	if _, ok := p.f.Passwords[username]; ok {
+		return fmt.Errorf("User %s already exists in passdb", username)
+	}
+	p.f.Passwords[username] = strings.TrimPrefix(ntHash, "NT:")
+	return nil
+}
+
+// fakeAccounts implements AccountManager on a FakeSystem
+type fakeAccounts struct{ f *FakeSystem }
+
+func (a fakeAccounts) LookupUser(name string) (Account, error) {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	account, ok := a.f.Accounts[name]
+	if !ok {
+		return Account{}, fmt.Errorf("User %s does not exist", name)
+	}
+	return account, nil
+}
+
+func (a fakeAccounts) ListUsers() ([]Account, error) {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	accounts := make([]Account, 0, len(a.f.Accounts))
+	for _, account := range a.f.Accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i].UID < accounts[j].UID })
+	return accounts, nil
+}
+
+func (a fakeAccounts) CreateUser(name string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if _, ok := a.f.Accounts[name]; ok {
+		return fmt.Errorf("user '%s' already exists", name)
+	}
+	a.f.addAccount(name)
+	return nil
+}
+
+func (a fakeAccounts) DeleteUser(name string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	account, ok := a.f.Accounts[name]
+	if !ok {
+		return fmt.Errorf("user '%s' does not exist", name)
+	}
+	delete(a.f.Accounts, name)
+
+	// userdel removes the user's private group and memberships
+	if group, ok := a.f.Groups[name]; ok && group.GID == account.GID {
+		delete(a.f.Groups, name)
+	}
+	for _, group := range a.f.Groups {
+		group.Members = removeString(group.Members, name)
+	}
+	return nil
+}
+
+func (a fakeAccounts) RenameUser(oldName, newName string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if err := a.f.Failures["RenameUser "+oldName]; err != nil {
+		return err
+	}
+	account, ok := a.f.Accounts[oldName]
+	if !ok {
+		return fmt.Errorf("user '%s' does not exist", oldName)
+	}
+	if _, ok := a.f.Accounts[newName]; ok {
+		return fmt.Errorf("user '%s' already exists", newName)
+	}
+	delete(a.f.Accounts, oldName)
+	account.Name = newName
+	a.f.Accounts[newName] = account
+	for _, group := range a.f.Groups {
+		for i, member := range group.Members {
+			if member == oldName {
+				group.Members[i] = newName
+			}
+		}
+	}
+	return nil
+}
+
+func (a fakeAccounts) SetUserHome(name, home string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	account, ok := a.f.Accounts[name]
+	if !ok {
+		return fmt.Errorf("user '%s' does not exist", name)
+	}
+	account.Home = home
+	a.f.Accounts[name] = account
+	return nil
+}
+
+func (a fakeAccounts) LookupGroup(name string) (GroupEntry, error) {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	group, ok := a.f.Groups[name]
+	if !ok {
+		return GroupEntry{}, fmt.Errorf("Group %s does not exist", name)
+	}
+	return copyGroupEntry(group), nil
+}
+
+func (a fakeAccounts) ListGroups() ([]GroupEntry, error) {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	groups := make([]GroupEntry, 0, len(a.f.Groups))
+	for _, group := range a.f.Groups {
+		groups = append(groups, copyGroupEntry(group))
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].GID < groups[j].GID })
+	return groups, nil
+}
+
+func (a fakeAccounts) CreateGroup(name string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if _, ok := a.f.Groups[name]; ok {
+		return fmt.Errorf("group '%s' already exists", name)
+	}
+	a.f.nextID++
+	a.f.Groups[name] = &GroupEntry{Name: name, GID: a.f.nextID, Members: []string{}}
+	return nil
+}
+
+func (a fakeAccounts) DeleteGroup(name string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if _, ok := a.f.Groups[name]; !ok {
+		return fmt.Errorf("group '%s' does not exist", name)
+	}
+	delete(a.f.Groups, name)
+	return nil
+}
+
+func (a fakeAccounts) RenameGroup(oldName, newName string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	group, ok := a.f.Groups[oldName]
+	if !ok {
+		return fmt.Errorf("group '%s' does not exist", oldName)
+	}
+	if _, ok := a.f.Groups[newName]; ok {
+		return fmt.Errorf("group '%s' already exists", newName)
+	}
+	delete(a.f.Groups, oldName)
+	group.Name = newName
+	a.f.Groups[newName] = group
+	return nil
+}
+
+func (a fakeAccounts) AddGroupMember(group, user string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	entry, ok := a.f.Groups[group]
+	if !ok {
+		return fmt.Errorf("group '%s' does not exist", group)
+	}
+	if _, ok := a.f.Accounts[user]; !ok {
+		return fmt.Errorf("user '%s' does not exist", user)
+	}
+	entry.Members = append(removeString(entry.Members, user), user)
+	return nil
+}
+
+func (a fakeAccounts) RemoveGroupMember(group, user string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	entry, ok := a.f.Groups[group]
+	if !ok {
+		return fmt.Errorf("group '%s' does not exist", group)
+	}
+	for _, member := range entry.Members {
+		if member == user {
+			entry.Members = removeString(entry.Members, user)
+			return nil
+		}
+	}
+	return fmt.Errorf("user '%s' is not a member of '%s'", user, group)
+}
+
+func (a fakeAccounts) SetGroupMembers(group string, users []string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	entry, ok := a.f.Groups[group]
+	if !ok {
+		return fmt.Errorf("group '%s' does not exist", group)
+	}
+	for _, user := range users {
+		if _, ok := a.f.Accounts[user]; !ok {
+			return fmt.Errorf("user '%s' does not exist", user)
+		}
+	}
+	entry.Members = append([]string{}, users...)
+	return nil
+}
+
+// fakeACLs implements ACLManager on a FakeSystem
+type fakeACLs struct{ f *FakeSystem }
+
+func (a fakeACLs) GetACL(path string) (ShareACLs, error) {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	dir, ok := a.f.Dirs[path]
+	if !ok {
+		return ShareACLs{Path: path, Entries: []ACLEntry{}}, fmt.Errorf("%s: No such file or directory", path)
+	}
+	entries := append([]ACLEntry{}, a.f.ACLs[path]...)
+	return ShareACLs{
+		Path:    path,
+		Owner:   a.f.userName(dir.UID),
+		Group:   a.f.groupName(dir.GID),
+		Entries: entries,
+	}, nil
+}
+
+func (a fakeACLs) ClearACL(path string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if _, ok := a.f.Dirs[path]; !ok {
+		return fmt.Errorf("%s: No such file or directory", path)
+	}
+	delete(a.f.ACLs, path)
+	return nil
+}
+
+func (a fakeACLs) ModifyACL(path, entry string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if _, ok := a.f.Dirs[path]; !ok {
+		return fmt.Errorf("%s: No such file or directory", path)
+	}
+
+	// Entry format: [d:]u|g:name:perms
+	isDefault := strings.HasPrefix(entry, "d:")
+	parts := strings.Split(strings.TrimPrefix(entry, "d:"), ":")
+	if len(parts) != 3 {
+		return fmt.Errorf("Invalid ACL entry %s", entry)
+	}
+	entryType := map[string]string{"u": "user", "g": "group"}[parts[0]]
+	if entryType == "" {
+		return fmt.Errorf("Invalid ACL entry %s", entry)
+	}
+
+	// Replace any existing entry for the same principal
+	var entries []ACLEntry
+	for _, e := range a.f.ACLs[path] {
+		if e.Type != entryType || e.User != parts[1] || e.Default != isDefault {
+			entries = append(entries, e)
+		}
+	}
+	a.f.ACLs[path] = append(entries, ACLEntry{User: parts[1], Permission: parts[2], Type: entryType, Default: isDefault})
+	return nil
+}
+
+func (a fakeACLs) RemoveACL(path, entry string) error {
+	a.f.mu.Lock()
+	defer a.f.mu.Unlock()
+	if _, ok := a.f.Dirs[path]; !ok {
+		return fmt.Errorf("%s: No such file or directory", path)
+	}
+
+	// Entry format: [d:]u|g:name
+	isDefault := strings.HasPrefix(entry, "d:")
+	parts := strings.Split(strings.TrimPrefix(entry, "d:"), ":")
+	entryType := map[string]string{"u": "user", "g": "group"}[parts[0]]
+	if len(parts) != 2 || entryType == "" {
+		return fmt.Errorf("Invalid ACL entry %s", entry)
+	}
+
+	var entries []ACLEntry
+	for _, e := range a.f.ACLs[path] {
+		if e.Type != entryType || e.User != parts[1] || e.Default != isDefault {
+			entries = append(entries, e)
+		}
+	}
+	a.f.ACLs[path] = entries
+	return nil
+}
+
+// fakeFileSystem implements FileSystem on a FakeSystem
+type fakeFileSystem struct{ f *FakeSystem }
+
+func (fsys fakeFileSystem) Stat(path string) (os.FileInfo, error) {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	dir, ok := fsys.f.Dirs[filepath.Clean(path)]
+	if !ok {
+		return nil, &fs.PathError{Op: "stat", Path: path, Err: fs.ErrNotExist}
+	}
+	return fakeFileInfo{name: filepath.Base(path), mode: dir.Mode | fs.ModeDir}, nil
+}
+
+func (fsys fakeFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	for p := filepath.Clean(path); ; p = filepath.Dir(p) {
+		if _, ok := fsys.f.Dirs[p]; !ok {
+			fsys.f.Dirs[p] = fakeDir{Mode: perm}
+		}
+		if p == "/" || p == "." {
+			break
+		}
+	}
+	return nil
+}
+
+func (fsys fakeFileSystem) Chown(path string, uid, gid int) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	dir, ok := fsys.f.Dirs[filepath.Clean(path)]
+	if !ok {
+		return &fs.PathError{Op: "chown", Path: path, Err: fs.ErrNotExist}
+	}
+	if uid >= 0 {
+		dir.UID = uid
+	}
+	if gid >= 0 {
+		dir.GID = gid
+	}
+	fsys.f.Dirs[filepath.Clean(path)] = dir
+	return nil
+}
+
+func (fsys fakeFileSystem) Chmod(path, mode string) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	dir, ok := fsys.f.Dirs[filepath.Clean(path)]
+	if !ok {
+		return &fs.PathError{Op: "chmod", Path: path, Err: fs.ErrNotExist}
+	}
+	// Only octal modes are tracked, symbolic modes are accepted as-is
+	var perm uint32
+	if _, err := fmt.Sscanf(mode, "%o", &perm); err == nil {
+		dir.Mode = os.FileMode(perm)
+	}
+	fsys.f.Dirs[filepath.Clean(path)] = dir
+	return nil
+}
+
+func (fsys fakeFileSystem) CopyTree(src, dst string, uid, gid int) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	src = filepath.Clean(src)
+	if _, ok := fsys.f.Dirs[src]; !ok {
+		return &fs.PathError{Op: "lstat", Path: src, Err: fs.ErrNotExist}
+	}
+	for path, dir := range fsys.f.Dirs {
+		if rel, err := filepath.Rel(src, path); err == nil && rel != "." && !strings.HasPrefix(rel, "..") {
+			fsys.f.Dirs[filepath.Join(dst, rel)] = fakeDir{Mode: dir.Mode, UID: uid, GID: gid}
+		}
+	}
+	return nil
+}
+
+func (fsys fakeFileSystem) ReadDir(path string) ([]DirEntry, error) {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	path = filepath.Clean(path)
+	if _, ok := fsys.f.Dirs[path]; !ok {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+
+	var entries []DirEntry
+	for p, dir := range fsys.f.Dirs {
+		if p != path && filepath.Dir(p) == path {
+			entries = append(entries, DirEntry{Name: filepath.Base(p), Path: p, IsDir: true, UID: dir.UID, GID: dir.GID})
+		}
+	}
+	for p := range fsys.f.Files {
+		if filepath.Dir(p) == path {
+			entries = append(entries, DirEntry{Name: filepath.Base(p), Path: p})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries, nil
+}
+
+func (fsys fakeFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	if _, ok := fsys.f.Dirs[filepath.Dir(path)]; !ok {
+		return &fs.PathError{Op: "open", Path: path, Err: fs.ErrNotExist}
+	}
+	fsys.f.Files[path] = append([]byte{}, data...)
+	return nil
+}
+
+func (fsys fakeFileSystem) Rename(src, dst string) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	src, dst = filepath.Clean(src), filepath.Clean(dst)
+	if _, ok := fsys.f.Dirs[src]; !ok {
+		if data, ok := fsys.f.Files[src]; ok {
+			delete(fsys.f.Files, src)
+			fsys.f.Files[dst] = data
+			return nil
+		}
+		return &fs.PathError{Op: "rename", Path: src, Err: fs.ErrNotExist}
+	}
+	if _, ok := fsys.f.Dirs[dst]; ok {
+		return &fs.PathError{Op: "rename", Path: dst, Err: fs.ErrExist}
+	}
+	for p, dir := range fsys.f.Dirs {
+		if p == src || strings.HasPrefix(p, src+"/") {
+			delete(fsys.f.Dirs, p)
+			fsys.f.Dirs[dst+strings.TrimPrefix(p, src)] = dir
+		}
+	}
+	for p, entries := range fsys.f.ACLs {
+		if p == src || strings.HasPrefix(p, src+"/") {
+			delete(fsys.f.ACLs, p)
+			fsys.f.ACLs[dst+strings.TrimPrefix(p, src)] = entries
+		}
+	}
+	for p, data := range fsys.f.Files {
+		if strings.HasPrefix(p, src+"/") {
+			delete(fsys.f.Files, p)
+			fsys.f.Files[dst+strings.TrimPrefix(p, src)] = data
+		}
+	}
+	return nil
+}
+
+func (fsys fakeFileSystem) RemoveAll(path string) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	path = filepath.Clean(path)
+	for p := range fsys.f.Dirs {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(fsys.f.Dirs, p)
+			delete(fsys.f.ACLs, p)
+		}
+	}
+	for p := range fsys.f.Files {
+		if p == path || strings.HasPrefix(p, path+"/") {
+			delete(fsys.f.Files, p)
+		}
+	}
+	return nil
+}
+
+func (fsys fakeFileSystem) Archive(src, dst string) error {
+	fsys.f.mu.Lock()
+	defer fsys.f.mu.Unlock()
+	if _, ok := fsys.f.Dirs[filepath.Clean(src)]; !ok {
+		return fmt.Errorf("tar: %s: Cannot stat: No such file or directory", src)
+	}
+	if _, ok := fsys.f.Dirs[filepath.Dir(dst)]; !ok {
+		return fmt.Errorf("tar: %s: Cannot open: No such file or directory", dst)
+	}
+	fsys.f.Archives[dst] = filepath.Clean(src)
+	fsys.f.Files[dst] = []byte("archive of " + src)
+	return nil
+}
+
+// fakeFileInfo implements os.FileInfo for fake directories
+type fakeFileInfo struct {
+	name string
+	mode os.FileMode
+}
+
+func (i fakeFileInfo) Name() string       { return i.name }
+func (i fakeFileInfo) Size() int64        { return 4096 }
+func (i fakeFileInfo) Mode() os.FileMode  { return i.mode }
+func (i fakeFileInfo) ModTime() time.Time { return time.Time{} }
+func (i fakeFileInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i fakeFileInfo) Sys() interface{}   { return nil }
+
+// fakeServices implements ServiceManager on a FakeSystem
+type fakeServices struct{ f *FakeSystem }
+
+func (s fakeServices) IsInstalled(unit string) (bool, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	_, ok := s.f.Units[unit]
+	return ok, nil
+}
+
+func (s fakeServices) IsActive(unit string) (bool, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	_, ok := s.f.Services[unit]
+	return ok, nil
+}
+
+func (s fakeServices) ActiveSince(unit string) (time.Time, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	since, ok := s.f.Services[unit]
+	if !ok {
+		return time.Time{}, fmt.Errorf("%s is not active", unit)
+	}
+	return since, nil
+}
+
+func (s fakeServices) IsEnabled(unit string) (bool, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	return s.f.Units[unit], nil
+}
+
+// unit fails like systemctl for units without a unit file; callers hold the lock
+func (s fakeServices) unit(unit string) error {
+	if _, ok := s.f.Units[unit]; !ok {
+		return fmt.Errorf("Unit %s.service not found", unit)
+	}
+	return nil
+}
+
+func (s fakeServices) Start(unit string) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.unit(unit); err != nil {
+		return err
+	}
+	if _, ok := s.f.Services[unit]; !ok {
+		s.f.Services[unit] = time.Now()
+	}
+	return nil
+}
+
+func (s fakeServices) Stop(unit string) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.unit(unit); err != nil {
+		return err
+	}
+	delete(s.f.Services, unit)
+	return nil
+}
+
+func (s fakeServices) Restart(unit string) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.unit(unit); err != nil {
+		return err
+	}
+	s.f.Services[unit] = time.Now()
+	s.f.Restarts[unit]++
+	return nil
+}
+
+func (s fakeServices) Enable(unit string) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.unit(unit); err != nil {
+		return err
+	}
+	s.f.Units[unit] = true
+	return nil
+}
+
+func (s fakeServices) Disable(unit string) error {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	if err := s.unit(unit); err != nil {
+		return err
+	}
+	s.f.Units[unit] = false
+	return nil
+}
+
+// fakeDiskUsage implements DiskUsage on a FakeSystem
+type fakeDiskUsage struct{ f *FakeSystem }
+
+func (d fakeDiskUsage) Filesystems() ([]DiskInfo, error) {
+	d.f.mu.Lock()
+	defer d.f.mu.Unlock()
+	return append([]DiskInfo{}, d.f.Disks...), nil
+}
+
+func (d fakeDiskUsage) DirectorySize(path string) (string, error) {
+	d.f.mu.Lock()
+	defer d.f.mu.Unlock()
+	size, ok := d.f.DirSizes[path]
+	if !ok {
+		return "", fmt.Errorf("cannot access '%s': No such file or directory", path)
+	}
+	return size, nil
+}
+
+// fakeQuotas implements QuotaManager on a FakeSystem
+type fakeQuotas struct{ f *FakeSystem }
+
+func (q fakeQuotas) SetUserQuota(user, path string, softKB, hardKB uint64) error {
+	q.f.mu.Lock()
+	defer q.f.mu.Unlock()
+	q.f.Quotas[user] = hardKB
+	return nil
+}
+
+// fakeControl implements SambaControl on a FakeSystem
+type fakeControl struct{ f *FakeSystem }
+
+// ReloadConfig fails like smbcontrol when smbd isn't running
+func (c fakeControl) ReloadConfig() error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	if _, ok := c.f.Services["smbd"]; !ok {
+		return fmt.Errorf("Can't find pid for destination 'smbd'")
+	}
+	c.f.Reloads++
+	return nil
+}
+
+// KillSession drops every session, connection and open file of a process
+func (c fakeControl) KillSession(pid string) error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.Killed = append(c.f.Killed, pid)
+
+	clients := SambaStatus{}
+	for _, session := range c.f.Clients.Sessions {
+		if session.PID != pid {
+			clients.Sessions = append(clients.Sessions, session)
+		}
+	}
+	for _, tcon := range c.f.Clients.Connections {
+		if tcon.PID != pid {
+			clients.Connections = append(clients.Connections, tcon)
+		}
+	}
+	for _, file := range c.f.Clients.OpenFiles {
+		if file.PID != pid {
+			clients.OpenFiles = append(clients.OpenFiles, file)
+		}
+	}
+	c.f.Clients = clients
+	return nil
+}
+
+// SetDebugLevel records the level sent to a destination
+func (c fakeControl) SetDebugLevel(destination, level string) error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.Debug[destination] = level
+	return nil
+}
+
+// CloseShare drops the connections to a share
+func (c fakeControl) CloseShare(share string) error {
+	c.f.mu.Lock()
+	defer c.f.mu.Unlock()
+	c.f.Closed = append(c.f.Closed, share)
+
+	var connections []TreeConnect
+	for _, tcon := range c.f.Clients.Connections {
+		if tcon.Share != share {
+			connections = append(connections, tcon)
+		}
+	}
+	c.f.Clients.Connections = connections
+	return nil
+}
+
+// fakeSessions implements SessionMonitor on a FakeSystem
+type fakeSessions struct{ f *FakeSystem }
+
+func (s fakeSessions) Status() (SambaStatus, error) {
+	s.f.mu.Lock()
+	defer s.f.mu.Unlock()
+	return SambaStatus{
+		Sessions:    append([]SambaSession{}, s.f.Clients.Sessions...),
+		Connections: append([]TreeConnect{}, s.f.Clients.Connections...),
+		OpenFiles:   append([]OpenFile{}, s.f.Clients.OpenFiles...),
+	}, nil
+}
+
+// fakeJournal implements Journal on a FakeSystem
+type fakeJournal struct{ f *FakeSystem }
+
+func (j fakeJournal) Entries(units []string, afterCursor string, since, until time.Time, limit int) ([]JournalEntry, error) {
+	j.f.mu.Lock()
+	defer j.f.mu.Unlock()
+
+	var entries []JournalEntry
+	for _, entry := range j.f.Journal {
+		if afterCursor != "" && entry.Cursor <= afterCursor {
+			continue
+		}
+		if (!since.IsZero() && entry.Time.Before(since)) || (!until.IsZero() && entry.Time.After(until)) {
+			continue
+		}
+		for _, unit := range units {
+			if entry.Unit == unit || entry.Unit == unit+".service" {
+				entries = append(entries, entry)
+				break
+			}
+		}
+	}
+	if len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// fakeGroupMapper implements GroupMapper on a FakeSystem
+type fakeGroupMapper struct{ f *FakeSystem }
+
+func (g fakeGroupMapper) ListMappings() ([]GroupMapping, error) {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	mappings := make([]GroupMapping, 0, len(g.f.GroupMaps))
+	for _, mapping := range g.f.GroupMaps {
+		mappings = append(mappings, mapping)
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].NTName < mappings[j].NTName })
+	return mappings, nil
+}
+
+func (g fakeGroupMapper) AddMapping(mapping GroupMapping) error {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	if _, ok := g.f.Groups[mapping.UnixGroup]; !ok {
+		return fmt.Errorf("Can't lookup UNIX group %s", mapping.UnixGroup)
+	}
+	if _, ok := g.f.GroupMaps[mapping.NTName]; ok {
+		return fmt.Errorf("Group %s already mapped", mapping.NTName)
+	}
+	if mapping.SID == "" {
+		g.f.nextID++
+		mapping.SID = fmt.Sprintf("S-1-5-21-1-2-3-%d", g.f.nextID)
+	}
+	g.f.GroupMaps[mapping.NTName] = mapping
+	return nil
+}
+
+func (g fakeGroupMapper) DeleteMapping(ntName string) error {
+	g.f.mu.Lock()
+	defer g.f.mu.Unlock()
+	if _, ok := g.f.GroupMaps[ntName]; !ok {
+		return fmt.Errorf("Unable to find group %s", ntName)
+	}
+	delete(g.f.GroupMaps, ntName)
+	return nil
+}
+
+// userName returns the name of a UID; f.mu must be held
+func (f *FakeSystem) userName(uid int) string {
+	for _, account := range f.Accounts {
+		if account.UID == uid {
+			return account.Name
+		}
+	}
+	return fmt.Sprint(uid)
+}
+
+// groupName returns the name of a GID; f.mu must be held
+func (f *FakeSystem) groupName(gid int) string {
+	for _, group := range f.Groups {
+		if group.GID == gid {
+			return group.Name
+		}
+	}
+	return fmt.Sprint(gid)
+}
+
+// copyGroupEntry returns a copy of a group that does not share the member slice
+func copyGroupEntry(group *GroupEntry) GroupEntry {
+	return GroupEntry{Name: group.Name, GID: group.GID, Members: append([]string{}, group.Members...)}
+}
+
+// removeString returns list without any occurrence of s
+func removeString(list []string, s string) []string {
+	result := []string{}
+	for _, item := range list {
+		if item != s {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// fakeProbes reports the listening addresses and probe results of the fake system
+type fakeProbes struct{ f *FakeSystem }
+
+// Dial fails for refused addresses
+func (p fakeProbes) Dial(address string, timeout time.Duration) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if p.f.Refused[address] {
+		return fmt.Errorf("dial tcp %s: connect: connection refused", address)
+	}
+	return nil
+}
+
+// InterfaceAddrs returns the addresses of the matching interfaces
+func (p fakeProbes) InterfaceAddrs(pattern string) ([]string, error) {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	var addrs []string
+	for name, nicAddrs := range p.f.NICs {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			addrs = append(addrs, nicAddrs...)
+		}
+	}
+	if addrs == nil {
+		return nil, fmt.Errorf("no such network interface %s", pattern)
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// Testparm returns the configured warnings
+func (p fakeProbes) Testparm(configPath string) ([]string, error) {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if _, err := os.Stat(configPath); err != nil {
+		return nil, err
+	}
+	return p.f.Warnings, nil
+}
+
+// NegotiateSMB2 fails for refused addresses
+func (p fakeProbes) NegotiateSMB2(address string, timeout time.Duration) (string, error) {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	if p.f.Refused[address] {
+		return "", fmt.Errorf("dial tcp %s: connect: connection refused", address)
+	}
+	return "3.0.2", nil
+}
+
+// ListShares returns the configured result
+func (p fakeProbes) ListShares(host string) error {
+	p.f.mu.Lock()
+	defer p.f.mu.Unlock()
+	return p.f.ListErr
+}
@@ -0,0 +1,155 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// systemProbes probes the local Samba server over the network and through
+// the Samba command-line tools
+type systemProbes struct{}
+
+// Dial opens and closes a TCP connection
+func (systemProbes) Dial(address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// InterfaceAddrs returns the IP addresses of the matching network interfaces
+func (systemProbes) InterfaceAddrs(pattern string) ([]string, error) {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list network interfaces: %v", err)
+	}
+
+	var addrs []string
+	found := false
+	for _, iface := range interfaces {
+		if matched, _ := filepath.Match(pattern, iface.Name); !matched {
+			continue
+		}
+		found = true
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && !ipnet.IP.IsLinkLocalUnicast() {
+				addrs = append(addrs, ipnet.IP.String())
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("No network interface matches %s", pattern)
+	}
+
+	return addrs, nil
+}
+
+// Testparm runs testparm, which reports problems on stderr and exits non-zero
+// when the configuration can't be loaded
+func (systemProbes) Testparm(configPath string) ([]string, error) {
+	_, stderr, err := executeCapture(commandSpec{Name: "testparm", Args: []string{"-s", configPath}, Timeout: healthCommandTimeout})
+	return parseTestparmWarnings(stderr), err
+}
+
+// ListShares runs an anonymous smbclient share listing
+func (systemProbes) ListShares(host string) error {
+	_, err := execute(commandSpec{Name: "smbclient", Args: []string{"-L", host, "-N", "-g"}, Timeout: healthCommandTimeout})
+	return err
+}
+
+// smb2Dialects are the dialects offered by NegotiateSMB2. SMB 3.1.1 is left
+// out as it requires negotiate contexts.
+var smb2Dialects = []uint16{0x0202, 0x0210, 0x0300, 0x0302}
+
+// NegotiateSMB2 performs the first request of every SMB2 connection, which
+// needs no smbclient and no credentials
+func (systemProbes) NegotiateSMB2(address string, timeout time.Duration) (string, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(smb2NegotiateRequest()); err != nil {
+		return "", fmt.Errorf("Failed to send SMB2 NEGOTIATE: %v", err)
+	}
+
+	// Direct TCP framing: a zero byte and a 24-bit length
+	var frame [4]byte
+	if _, err := io.ReadFull(conn, frame[:]); err != nil {
+		return "", fmt.Errorf("Failed to read SMB2 NEGOTIATE response: %v", err)
+	}
+	length := int(frame[1])<<16 | int(frame[2])<<8 | int(frame[3])
+	if length < 64+8 || length > 1<<20 {
+		return "", fmt.Errorf("Invalid SMB2 NEGOTIATE response length %d", length)
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil {
+		return "", fmt.Errorf("Failed to read SMB2 NEGOTIATE response: %v", err)
+	}
+
+	return parseSMB2NegotiateResponse(response)
+}
+
+// smb2NegotiateRequest builds a framed SMB2 NEGOTIATE request
+func smb2NegotiateRequest() []byte {
+	header := make([]byte, 64)
+	copy(header, "\xfeSMB")
+	binary.LittleEndian.PutUint16(header[4:], 64) // StructureSize
+	binary.LittleEndian.PutUint16(header[14:], 1) // CreditRequest
+
+	body := make([]byte, 36, 36+2*len(smb2Dialects))
+	binary.LittleEndian.PutUint16(body[0:], 36) // StructureSize
+	binary.LittleEndian.PutUint16(body[2:], uint16(len(smb2Dialects)))
+	binary.LittleEndian.PutUint16(body[4:], 1) // SecurityMode: signing enabled
+	for _, dialect := range smb2Dialects {
+		body = binary.LittleEndian.AppendUint16(body, dialect)
+	}
+
+	message := append(header, body...)
+	frame := []byte{0, byte(len(message) >> 16), byte(len(message) >> 8), byte(len(message))}
+	return append(frame, message...)
+}
+
+// parseSMB2NegotiateResponse checks a NEGOTIATE response and returns the
+// selected dialect, such as 3.0.2
+func parseSMB2NegotiateResponse(response []byte) (string, error) {
+	if len(response) < 64+8 || string(response[:4]) != "\xfeSMB" {
+		return "", fmt.Errorf("Not an SMB2 response")
+	}
+	if command := binary.LittleEndian.Uint16(response[12:]); command != 0 {
+		return "", fmt.Errorf("Unexpected SMB2 command %d in NEGOTIATE response", command)
+	}
+	if status := binary.LittleEndian.Uint32(response[8:]); status != 0 {
+		return "", fmt.Errorf("SMB2 NEGOTIATE failed with status 0x%08x", status)
+	}
+
+	dialect := binary.LittleEndian.Uint16(response[64+4:])
+	return fmt.Sprintf("%d.%d.%d", dialect>>8, dialect>>4&0xf, dialect&0xf), nil
+}
+
+// parseTestparmWarnings keeps the warning and error lines of testparm's stderr
+func parseTestparmWarnings(stderr string) []string {
+	var warnings []string
+	scanner := bufio.NewScanner(strings.NewReader(stderr))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lower := strings.ToLower(line)
+		if strings.Contains(lower, "warning") || strings.Contains(lower, "error") || strings.Contains(lower, "unknown parameter") {
+			warnings = append(warnings, line)
+		}
+	}
+	return warnings
+}
@@ -0,0 +1,577 @@
+package api
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Init systems a ServiceManager can be built for
+const (
+	InitSystemAuto    = "auto"
+	InitSystemSystemd = "systemd"
+	InitSystemOpenRC  = "openrc"
+	InitSystemSysV    = "sysv"
+	InitSystemDirect  = "direct"
+)
+
+// NewServiceManager returns the service manager for an init system, detecting
+// it when name is empty or auto
+func NewServiceManager(name string) (ServiceManager, error) {
+	if name == "" || name == InitSystemAuto {
+		name = detectInitSystem()
+	}
+
+	switch name {
+	case InitSystemSystemd:
+		return systemdServices{}, nil
+	case InitSystemOpenRC:
+		return openrcServices{}, nil
+	case InitSystemSysV:
+		return sysvServices{}, nil
+	case InitSystemDirect:
+		return directServices{}, nil
+	}
+
+	return nil, fmt.Errorf("Unknown init system %s", name)
+}
+
+// SetInitSystem replaces the service manager of the current backend
+func SetInitSystem(name string) error {
+	services, err := NewServiceManager(name)
+	if err != nil {
+		return err
+	}
+
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	updated := *backend
+	updated.Services = services
+	backend = &updated
+
+	return nil
+}
+
+// detectInitSystem guesses the running init system from its runtime files
+func detectInitSystem() string {
+	// sd_booted(3) checks for this directory
+	if isDir("/run/systemd/system") {
+		return InitSystemSystemd
+	}
+	if isDir("/run/openrc") {
+		return InitSystemOpenRC
+	}
+	if _, err := os.Stat("/sbin/openrc-run"); err == nil {
+		return InitSystemOpenRC
+	}
+	if isDir("/etc/init.d") {
+		return InitSystemSysV
+	}
+	return InitSystemDirect
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// systemdServices controls services through systemctl
+type systemdServices struct{}
+
+// show returns the requested unit properties as reported by systemctl show
+func (systemdServices) show(unit string, properties ...string) (map[string]string, error) {
+	output, err := runCommand("systemctl", "show", unit, "--property="+strings.Join(properties, ","))
+	if err != nil {
+		return nil, err
+	}
+	return parseSystemdShow(output), nil
+}
+
+// IsInstalled reports whether systemd knows a unit file for the unit
+func (s systemdServices) IsInstalled(unit string) (bool, error) {
+	props, err := s.show(unit, "LoadState")
+	if err != nil {
+		return false, err
+	}
+	return props["LoadState"] == "loaded", nil
+}
+
+// IsActive reports whether a unit is active
+func (s systemdServices) IsActive(unit string) (bool, error) {
+	props, err := s.show(unit, "ActiveState")
+	if err != nil {
+		return false, err
+	}
+	return props["ActiveState"] == "active", nil
+}
+
+// IsEnabled reports whether a unit starts at boot
+func (s systemdServices) IsEnabled(unit string) (bool, error) {
+	props, err := s.show(unit, "UnitFileState")
+	if err != nil {
+		return false, err
+	}
+	return props["UnitFileState"] == "enabled", nil
+}
+
+// ActiveSince returns the time a unit last entered the active state. The
+// monotonic timestamp is used because the formatted one depends on locale
+// and time zone abbreviations Go can't resolve.
+func (s systemdServices) ActiveSince(unit string) (time.Time, error) {
+	props, err := s.show(unit, "ActiveEnterTimestampMonotonic")
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	usec, err := strconv.ParseInt(props["ActiveEnterTimestampMonotonic"], 10, 64)
+	if err != nil || usec == 0 {
+		return time.Time{}, fmt.Errorf("No start time reported for %s", unit)
+	}
+
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return boot.Add(time.Duration(usec) * time.Microsecond), nil
+}
+
+// Start starts a unit
+func (systemdServices) Start(unit string) error {
+	_, err := runCommand("systemctl", "start", unit)
+	return err
+}
+
+// Stop stops a unit
+func (systemdServices) Stop(unit string) error {
+	_, err := runCommand("systemctl", "stop", unit)
+	return err
+}
+
+// Restart restarts a unit
+func (systemdServices) Restart(unit string) error {
+	_, err := runCommand("systemctl", "restart", unit)
+	return err
+}
+
+// Enable makes a unit start at boot
+func (systemdServices) Enable(unit string) error {
+	_, err := runCommand("systemctl", "enable", unit)
+	return err
+}
+
+// Disable stops a unit from starting at boot
+func (systemdServices) Disable(unit string) error {
+	_, err := runCommand("systemctl", "disable", unit)
+	return err
+}
+
+// parseSystemdShow parses the key=value lines printed by systemctl show
+func parseSystemdShow(output string) map[string]string {
+	props := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if key, value, ok := strings.Cut(strings.TrimSpace(line), "="); ok {
+			props[key] = value
+		}
+	}
+	return props
+}
+
+// openrcServices controls services through rc-service and rc-update
+type openrcServices struct{}
+
+// openrcRunlevel is the runlevel services are enabled in
+const openrcRunlevel = "default"
+
+// IsInstalled reports whether an init script exists for the service
+func (openrcServices) IsInstalled(unit string) (bool, error) {
+	_, err := runCommand("rc-service", "--exists", unit)
+	return err == nil, nil
+}
+
+// IsActive reports whether the service is started
+func (openrcServices) IsActive(unit string) (bool, error) {
+	// status exits non-zero for stopped and crashed services
+	_, err := runCommand("rc-service", unit, "status")
+	return err == nil, nil
+}
+
+// IsEnabled reports whether the service is in the default runlevel
+func (openrcServices) IsEnabled(unit string) (bool, error) {
+	output, err := runCommand("rc-update", "show", openrcRunlevel)
+	if err != nil {
+		return false, err
+	}
+	return parseRCUpdateShow(output, unit), nil
+}
+
+// ActiveSince returns the start time of the service's daemon process
+func (openrcServices) ActiveSince(unit string) (time.Time, error) {
+	return daemonStartTime(unit)
+}
+
+// Start starts the service
+func (openrcServices) Start(unit string) error {
+	_, err := runCommand("rc-service", unit, "start")
+	return err
+}
+
+// Stop stops the service
+func (openrcServices) Stop(unit string) error {
+	_, err := runCommand("rc-service", unit, "stop")
+	return err
+}
+
+// Restart restarts the service
+func (openrcServices) Restart(unit string) error {
+	_, err := runCommand("rc-service", unit, "restart")
+	return err
+}
+
+// Enable adds the service to the default runlevel
+func (openrcServices) Enable(unit string) error {
+	_, err := runCommand("rc-update", "add", unit, openrcRunlevel)
+	return err
+}
+
+// Disable removes the service from the default runlevel
+func (openrcServices) Disable(unit string) error {
+	_, err := runCommand("rc-update", "del", unit, openrcRunlevel)
+	return err
+}
+
+// parseRCUpdateShow reports whether rc-update show lists a service, lines
+// look like "  samba | default"
+func parseRCUpdateShow(output, unit string) bool {
+	for _, line := range strings.Split(output, "\n") {
+		name, _, _ := strings.Cut(line, "|")
+		if strings.TrimSpace(name) == unit {
+			return true
+		}
+	}
+	return false
+}
+
+// sysvServices controls services through /etc/init.d scripts
+type sysvServices struct{}
+
+// sysvInitDir holds the init scripts
+const sysvInitDir = "/etc/init.d"
+
+// script returns the init script path of a service
+func (sysvServices) script(unit string) string {
+	return filepath.Join(sysvInitDir, unit)
+}
+
+// IsInstalled reports whether an init script exists for the service
+func (s sysvServices) IsInstalled(unit string) (bool, error) {
+	info, err := os.Stat(s.script(unit))
+	return err == nil && !info.IsDir(), nil
+}
+
+// IsActive reports whether the LSB status action succeeds
+func (s sysvServices) IsActive(unit string) (bool, error) {
+	_, err := runCommand(s.script(unit), "status")
+	return err == nil, nil
+}
+
+// IsEnabled reports whether a start link exists in a multi-user runlevel
+func (sysvServices) IsEnabled(unit string) (bool, error) {
+	for _, level := range []string{"2", "3", "4", "5"} {
+		links, _ := filepath.Glob(filepath.Join("/etc", "rc"+level+".d", "S[0-9][0-9]"+unit))
+		if len(links) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// ActiveSince returns the start time of the service's daemon process
+func (sysvServices) ActiveSince(unit string) (time.Time, error) {
+	return daemonStartTime(unit)
+}
+
+// Start starts the service
+func (s sysvServices) Start(unit string) error {
+	_, err := runCommand(s.script(unit), "start")
+	return err
+}
+
+// Stop stops the service
+func (s sysvServices) Stop(unit string) error {
+	_, err := runCommand(s.script(unit), "stop")
+	return err
+}
+
+// Restart restarts the service
+func (s sysvServices) Restart(unit string) error {
+	_, err := runCommand(s.script(unit), "restart")
+	return err
+}
+
+// Enable creates the runlevel links with update-rc.d or chkconfig
+func (sysvServices) Enable(unit string) error {
+	if _, err := exec.LookPath("update-rc.d"); err == nil {
+		_, err := runCommand("update-rc.d", unit, "enable")
+		return err
+	}
+	_, err := runCommand("chkconfig", unit, "on")
+	return err
+}
+
+// Disable removes the runlevel links with update-rc.d or chkconfig
+func (sysvServices) Disable(unit string) error {
+	if _, err := exec.LookPath("update-rc.d"); err == nil {
+		_, err := runCommand("update-rc.d", unit, "disable")
+		return err
+	}
+	_, err := runCommand("chkconfig", unit, "off")
+	return err
+}
+
+// daemonSpec describes how to run a service's daemon without an init system
+type daemonSpec struct {
+	Binary string
+	Args   []string
+	// Foreground daemons don't fork and are detached by the manager
+	Foreground bool
+}
+
+// daemonSpecs maps unit names to the daemon they run
+var daemonSpecs = map[string]daemonSpec{
+	"smbd":         {Binary: "smbd", Args: []string{"-D"}},
+	"smb":          {Binary: "smbd", Args: []string{"-D"}},
+	"nmbd":         {Binary: "nmbd", Args: []string{"-D"}},
+	"nmb":          {Binary: "nmbd", Args: []string{"-D"}},
+	"winbind":      {Binary: "winbindd", Args: []string{"-D"}},
+	"winbindd":     {Binary: "winbindd", Args: []string{"-D"}},
+	"samba-ad-dc":  {Binary: "samba", Args: []string{"-D"}},
+	"samba":        {Binary: "samba", Args: []string{"-D"}},
+	"wsdd":         {Binary: "wsdd", Foreground: true},
+	"wsdd2":        {Binary: "wsdd2", Args: []string{"-d"}},
+	"avahi-daemon": {Binary: "avahi-daemon", Args: []string{"-D"}},
+}
+
+// daemonBinary returns the process name a unit runs
+func daemonBinary(unit string) string {
+	if spec, ok := daemonSpecs[unit]; ok {
+		return spec.Binary
+	}
+	return unit
+}
+
+// daemonStartTime returns the start time of the oldest process of a unit's daemon
+func daemonStartTime(unit string) (time.Time, error) {
+	pids := findProcesses(daemonBinary(unit))
+	if len(pids) == 0 {
+		return time.Time{}, fmt.Errorf("%s is not running", unit)
+	}
+
+	boot, err := bootTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var oldest time.Time
+	for _, pid := range pids {
+		data, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+		if err != nil {
+			continue
+		}
+		ticks, err := parseProcStatStart(string(data))
+		if err != nil {
+			continue
+		}
+		// USER_HZ is 100 on every Linux architecture Samba runs on
+		started := boot.Add(time.Duration(ticks) * time.Second / 100)
+		if oldest.IsZero() || started.Before(oldest) {
+			oldest = started
+		}
+	}
+	if oldest.IsZero() {
+		return time.Time{}, fmt.Errorf("No start time found for %s", unit)
+	}
+
+	return oldest, nil
+}
+
+// bootTime reads the system boot time from /proc/stat
+func bootTime() (time.Time, error) {
+	data, err := os.ReadFile("/proc/stat")
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to read boot time: %v", err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, ok := strings.CutPrefix(line, "btime "); ok {
+			seconds, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("Failed to parse boot time: %v", err)
+			}
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("No boot time in /proc/stat")
+}
+
+// parseProcStatStart returns the start time field of /proc/<pid>/stat in clock
+// ticks after boot. The command name may contain spaces and parentheses, so
+// fields are counted from the last closing parenthesis.
+func parseProcStatStart(stat string) (uint64, error) {
+	end := strings.LastIndex(stat, ")")
+	if end < 0 {
+		return 0, fmt.Errorf("Malformed process stat")
+	}
+	// Fields after the name start with state (field 3); starttime is field 22
+	fields := strings.Fields(stat[end+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("Malformed process stat")
+	}
+	return strconv.ParseUint(fields[19], 10, 64)
+}
+
+// findProcesses returns the PIDs of processes whose command name is name
+func findProcesses(name string) []int {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil
+	}
+
+	// The kernel truncates command names to 15 characters
+	if len(name) > 15 {
+		name = name[:15]
+	}
+
+	var pids []int
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		comm, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		// avahi-daemon renames itself to "avahi-daemon: running [host]"
+		command := strings.TrimSpace(string(comm))
+		if command == name || strings.HasPrefix(command, name+":") {
+			pids = append(pids, pid)
+		}
+	}
+
+	return pids
+}
+
+// directServices runs Samba daemons as plain processes, for containers and
+// hosts without a supported init system
+type directServices struct{}
+
+// directStopTimeout bounds how long Stop waits for a daemon to exit
+const directStopTimeout = 10 * time.Second
+
+// binaryPath finds a daemon binary in PATH or the sbin directories
+func (directServices) binaryPath(unit string) (string, error) {
+	binary := daemonBinary(unit)
+	if path, err := exec.LookPath(binary); err == nil {
+		return path, nil
+	}
+	for _, dir := range []string{"/usr/sbin", "/sbin", "/usr/local/sbin"} {
+		path := filepath.Join(dir, binary)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not installed", binary)
+}
+
+// IsInstalled reports whether the daemon binary exists
+func (d directServices) IsInstalled(unit string) (bool, error) {
+	_, err := d.binaryPath(unit)
+	return err == nil, nil
+}
+
+// IsActive reports whether a daemon process is running
+func (directServices) IsActive(unit string) (bool, error) {
+	return len(findProcesses(daemonBinary(unit))) > 0, nil
+}
+
+// IsEnabled is always false, there is no boot configuration to inspect
+func (directServices) IsEnabled(unit string) (bool, error) {
+	return false, nil
+}
+
+// ActiveSince returns the start time of the daemon process
+func (directServices) ActiveSince(unit string) (time.Time, error) {
+	return daemonStartTime(unit)
+}
+
+// Start runs the daemon unless it is already running
+func (d directServices) Start(unit string) error {
+	if active, _ := d.IsActive(unit); active {
+		return nil
+	}
+
+	path, err := d.binaryPath(unit)
+	if err != nil {
+		return err
+	}
+
+	spec := daemonSpecs[unit]
+	if !spec.Foreground {
+		_, err := runCommand(path, spec.Args...)
+		return err
+	}
+
+	cmd := exec.Command(path, spec.Args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("Failed to start %s: %v", path, err)
+	}
+	// Reap the process when it exits
+	go cmd.Wait()
+
+	return nil
+}
+
+// Stop terminates every process of the daemon and waits for them to exit
+func (directServices) Stop(unit string) error {
+	name := daemonBinary(unit)
+	for _, pid := range findProcesses(name) {
+		if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+			return fmt.Errorf("Failed to stop %s (pid %d): %v", name, pid, err)
+		}
+	}
+
+	deadline := time.Now().Add(directStopTimeout)
+	for len(findProcesses(name)) > 0 {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s did not exit within %s", name, directStopTimeout)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// Restart stops and starts the daemon
+func (d directServices) Restart(unit string) error {
+	if err := d.Stop(unit); err != nil {
+		return err
+	}
+	return d.Start(unit)
+}
+
+// Enable is unsupported without an init system
+func (directServices) Enable(unit string) error {
+	return fmt.Errorf("Boot startup of %s can't be configured without an init system", unit)
+}
+
+// Disable is unsupported without an init system
+func (directServices) Disable(unit string) error {
+	return fmt.Errorf("Boot startup of %s can't be configured without an init system", unit)
+}
@@ -0,0 +1,48 @@
+package api
+
+import "testing"
+
+func TestParseSystemdShow(t *testing.T) {
+	props := parseSystemdShow("LoadState=loaded\nActiveState=active\nExecMainStatus=0\nDescription=Samba SMB Daemon = smbd\n")
+	if props["LoadState"] != "loaded" || props["ActiveState"] != "active" || props["Description"] != "Samba SMB Daemon = smbd" {
+		t.Errorf("props = %v", props)
+	}
+}
+
+func TestParseRCUpdateShow(t *testing.T) {
+	output := "            crond | default\n            samba | default\n         sshd-dsa | default\n"
+	if !parseRCUpdateShow(output, "samba") {
+		t.Errorf("samba not found")
+	}
+	if parseRCUpdateShow(output, "sshd") {
+		t.Errorf("sshd matched sshd-dsa")
+	}
+}
+
+func TestParseProcStatStart(t *testing.T) {
+	stat := "1234 (smbd: (client)) S 1 1234 1234 0 -1 4194624 2000 0 0 0 12 5 0 0 20 0 1 0 98765 123456789 1500 18446744073709551615"
+	ticks, err := parseProcStatStart(stat)
+	if err != nil || ticks != 98765 {
+		t.Errorf("parseProcStatStart = %d, %v", ticks, err)
+	}
+	if _, err := parseProcStatStart("1234 (smbd) S 1"); err == nil {
+		t.Errorf("expected error for truncated stat")
+	}
+}
+
+func TestNewServiceManager(t *testing.T) {
+	for name, want := range map[string]ServiceManager{
+		InitSystemSystemd: systemdServices{},
+		InitSystemOpenRC:  openrcServices{},
+		InitSystemSysV:    sysvServices{},
+		InitSystemDirect:  directServices{},
+	} {
+		got, err := NewServiceManager(name)
+		if err != nil || got != want {
+			t.Errorf("NewServiceManager(%q) = %T, %v", name, got, err)
+		}
+	}
+	if _, err := NewServiceManager("upstart"); err == nil {
+		t.Errorf("expected error for unknown init system")
+	}
+}
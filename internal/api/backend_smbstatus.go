@@ -0,0 +1,325 @@
+package api
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// smbstatusMonitor reads client state through smbstatus
+type smbstatusMonitor struct{}
+
+// Status prefers the JSON output of Samba 4.16 and later and falls back to
+// parsing the text tables of older releases
+func (smbstatusMonitor) Status() (SambaStatus, error) {
+	if output, err := runCommand("smbstatus", "--json"); err == nil {
+		if status, err := parseSmbstatusJSON(output); err == nil {
+			return status, nil
+		}
+	}
+
+	output, err := runCommand("smbstatus")
+	if err != nil {
+		return SambaStatus{}, err
+	}
+	return parseSmbstatusText(output), nil
+}
+
+// flexString accepts JSON strings and numbers, smbstatus has used both for IDs
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	switch v := value.(type) {
+	case string:
+		*s = flexString(v)
+	case float64:
+		*s = flexString(strconv.FormatFloat(v, 'f', -1, 64))
+	}
+	return nil
+}
+
+// smbstatusServerID identifies the smbd process serving a client
+type smbstatusServerID struct {
+	PID flexString `json:"pid"`
+}
+
+// smbstatusCrypto describes the encryption or signing of a session or tree connect
+type smbstatusCrypto struct {
+	Cipher string `json:"cipher"`
+	Degree string `json:"degree"`
+}
+
+// String renders the setting like the text output, e.g. partial(AES-128-CMAC)
+func (c smbstatusCrypto) String() string {
+	switch {
+	case c.Degree == "" || c.Degree == "none":
+		return "-"
+	case c.Cipher == "":
+		return c.Degree
+	}
+	return c.Degree + "(" + c.Cipher + ")"
+}
+
+// smbstatusFlags is a set of flags with its text summary
+type smbstatusFlags struct {
+	Text  string `json:"text"`
+	Read  bool   `json:"READ"`
+	Write bool   `json:"WRITE"`
+}
+
+// smbstatusJSON is the part of smbstatus --json the manager uses
+type smbstatusJSON struct {
+	Sessions map[string]struct {
+		SessionID     flexString        `json:"session_id"`
+		ServerID      smbstatusServerID `json:"server_id"`
+		Username      string            `json:"username"`
+		Groupname     string            `json:"groupname"`
+		RemoteMachine string            `json:"remote_machine"`
+		Dialect       string            `json:"session_dialect"`
+		Encryption    smbstatusCrypto   `json:"encryption"`
+		Signing       smbstatusCrypto   `json:"signing"`
+	} `json:"sessions"`
+	Tcons map[string]struct {
+		Service     string            `json:"service"`
+		ServerID    smbstatusServerID `json:"server_id"`
+		SessionID   flexString        `json:"session_id"`
+		Machine     string            `json:"machine"`
+		ConnectedAt string            `json:"connected_at"`
+		Encryption  smbstatusCrypto   `json:"encryption"`
+		Signing     smbstatusCrypto   `json:"signing"`
+	} `json:"tcons"`
+	OpenFiles map[string]struct {
+		ServicePath string `json:"service_path"`
+		Filename    string `json:"filename"`
+		Opens       map[string]struct {
+			ServerID   smbstatusServerID `json:"server_id"`
+			UID        flexString        `json:"uid"`
+			ShareMode  smbstatusFlags    `json:"sharemode"`
+			AccessMask smbstatusFlags    `json:"access_mask"`
+			Oplock     smbstatusFlags    `json:"oplock"`
+			Lease      smbstatusFlags    `json:"lease"`
+			OpenedAt   string            `json:"opened_at"`
+		} `json:"opens"`
+	} `json:"open_files"`
+}
+
+// parseSmbstatusJSON converts smbstatus --json output
+func parseSmbstatusJSON(output string) (SambaStatus, error) {
+	var raw smbstatusJSON
+	if err := json.Unmarshal([]byte(output), &raw); err != nil {
+		return SambaStatus{}, err
+	}
+
+	status := SambaStatus{Sessions: []SambaSession{}, Connections: []TreeConnect{}, OpenFiles: []OpenFile{}}
+
+	for _, s := range raw.Sessions {
+		status.Sessions = append(status.Sessions, SambaSession{
+			SessionID:  string(s.SessionID),
+			PID:        string(s.ServerID.PID),
+			User:       s.Username,
+			Group:      s.Groupname,
+			ClientIP:   s.RemoteMachine,
+			Protocol:   s.Dialect,
+			Encryption: s.Encryption.String(),
+			Signing:    s.Signing.String(),
+		})
+	}
+
+	for _, t := range raw.Tcons {
+		status.Connections = append(status.Connections, TreeConnect{
+			Share:       t.Service,
+			PID:         string(t.ServerID.PID),
+			SessionID:   string(t.SessionID),
+			ClientIP:    t.Machine,
+			ConnectedAt: t.ConnectedAt,
+			Encryption:  t.Encryption.String(),
+			Signing:     t.Signing.String(),
+		})
+	}
+
+	for _, file := range raw.OpenFiles {
+		for _, open := range file.Opens {
+			uid, _ := strconv.Atoi(string(open.UID))
+			lock := open.Oplock.Text
+			if lock == "LEASE" && open.Lease.Text != "" {
+				lock = "LEASE(" + open.Lease.Text + ")"
+			}
+			if lock == "" {
+				lock = "NONE"
+			}
+			status.OpenFiles = append(status.OpenFiles, OpenFile{
+				PID:       string(open.ServerID.PID),
+				UID:       uid,
+				SharePath: file.ServicePath,
+				Name:      file.Filename,
+				DenyMode:  denyModeFromShareMode(open.ShareMode),
+				Access:    accessFromMask(open.AccessMask),
+				Lock:      lock,
+				OpenedAt:  open.OpenedAt,
+			})
+		}
+	}
+
+	sortSambaStatus(&status)
+	return status, nil
+}
+
+// denyModeFromShareMode converts the share mode granted to other openers into
+// the DENY_* names of the text output
+func denyModeFromShareMode(mode smbstatusFlags) string {
+	switch {
+	case mode.Read && mode.Write:
+		return "DENY_NONE"
+	case mode.Read:
+		return "DENY_WRITE"
+	case mode.Write:
+		return "DENY_READ"
+	}
+	return "DENY_ALL"
+}
+
+// accessFromMask converts an access mask into the R/W names of the text output
+func accessFromMask(mask smbstatusFlags) string {
+	switch {
+	case strings.Contains(mask.Text, "R") && strings.Contains(mask.Text, "W"):
+		return "RDWR"
+	case strings.Contains(mask.Text, "W"):
+		return "WRONLY"
+	}
+	return "RDONLY"
+}
+
+// parseSmbstatusText parses the session, share and lock tables printed by
+// smbstatus without options. Each table is a header line, a dashed line and
+// rows up to the next blank line.
+func parseSmbstatusText(output string) SambaStatus {
+	status := SambaStatus{Sessions: []SambaSession{}, Connections: []TreeConnect{}, OpenFiles: []OpenFile{}}
+
+	lines := strings.Split(output, "\n")
+	header := ""
+	inTable := false
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "---") {
+			if i > 0 {
+				header = strings.TrimSpace(lines[i-1])
+			}
+			inTable = true
+			continue
+		}
+		if trimmed == "" {
+			inTable = false
+			continue
+		}
+		if !inTable {
+			continue
+		}
+
+		fields := strings.Fields(trimmed)
+		switch {
+		case strings.Contains(header, "Username"):
+			if session, ok := parseSessionLine(fields); ok {
+				status.Sessions = append(status.Sessions, session)
+			}
+		case strings.HasPrefix(header, "Service"):
+			if tcon, ok := parseTreeConnectLine(fields); ok {
+				status.Connections = append(status.Connections, tcon)
+			}
+		case strings.Contains(header, "DenyMode"):
+			if file, ok := parseLockLine(fields); ok {
+				status.OpenFiles = append(status.OpenFiles, file)
+			}
+		}
+	}
+
+	sortSambaStatus(&status)
+	return status
+}
+
+// parseSessionLine parses "PID Username Group Machine (address) Protocol Encryption Signing"
+func parseSessionLine(fields []string) (SambaSession, bool) {
+	if len(fields) < 4 {
+		return SambaSession{}, false
+	}
+
+	session := SambaSession{PID: fields[0], User: fields[1], Group: fields[2], ClientIP: fields[3]}
+	rest := fields[4:]
+	if len(rest) > 0 && strings.HasPrefix(rest[0], "(") {
+		rest = rest[1:]
+	}
+	// Releases before 4.4 have no encryption and signing columns
+	for i, target := range []*string{&session.Protocol, &session.Encryption, &session.Signing} {
+		if i < len(rest) {
+			*target = rest[i]
+		}
+	}
+
+	return session, true
+}
+
+// parseTreeConnectLine parses "Service pid Machine Connected-at... Encryption Signing"
+func parseTreeConnectLine(fields []string) (TreeConnect, bool) {
+	if len(fields) < 6 {
+		return TreeConnect{}, false
+	}
+
+	n := len(fields)
+	return TreeConnect{
+		Share:       fields[0],
+		PID:         fields[1],
+		ClientIP:    fields[2],
+		ConnectedAt: strings.Join(fields[3:n-2], " "),
+		Encryption:  fields[n-2],
+		Signing:     fields[n-1],
+	}, true
+}
+
+// parseLockLine parses "Pid User(ID) DenyMode Access R/W Oplock SharePath Name Time",
+// where the name may contain spaces and the time has five fields
+func parseLockLine(fields []string) (OpenFile, bool) {
+	if len(fields) < 13 {
+		return OpenFile{}, false
+	}
+	uid, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return OpenFile{}, false
+	}
+
+	n := len(fields)
+	return OpenFile{
+		PID:       fields[0],
+		UID:       uid,
+		DenyMode:  fields[2],
+		Access:    fields[4],
+		Lock:      fields[5],
+		SharePath: fields[6],
+		Name:      strings.Join(fields[7:n-5], " "),
+		OpenedAt:  strings.Join(fields[n-5:], " "),
+	}, true
+}
+
+// sortSambaStatus orders the snapshot so responses are stable
+func sortSambaStatus(status *SambaStatus) {
+	sort.Slice(status.Sessions, func(i, j int) bool {
+		return status.Sessions[i].PID < status.Sessions[j].PID
+	})
+	sort.Slice(status.Connections, func(i, j int) bool {
+		a, b := status.Connections[i], status.Connections[j]
+		if a.Share != b.Share {
+			return a.Share < b.Share
+		}
+		return a.PID < b.PID
+	})
+	sort.Slice(status.OpenFiles, func(i, j int) bool {
+		a, b := status.OpenFiles[i], status.OpenFiles[j]
+		if a.SharePath+a.Name != b.SharePath+b.Name {
+			return a.SharePath+a.Name < b.SharePath+b.Name
+		}
+		return a.PID < b.PID
+	})
+}
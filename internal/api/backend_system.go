@@ -0,0 +1,784 @@
+package api
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// systemPassDB manages passdb through pdbedit and smbpasswd
+type systemPassDB struct{}
+
+// ListUsers returns all usernames in passdb
+func (systemPassDB) ListUsers() ([]string, error) {
+	output, err := runCommand(SMB_USER_LIST_CMD, "-L")
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.Contains(line, ":") {
+			username := strings.TrimSpace(strings.Split(line, ":")[0])
+			if username != "" && !strings.HasPrefix(username, "#") {
+				users = append(users, username)
+			}
+		}
+	}
+
+	return users, nil
+}
+
+// AddUser adds an existing Unix user to passdb and sets its password
+func (systemPassDB) AddUser(username, password string) error {
+	passwordInput := fmt.Sprintf("%s\n%s\n", password, password)
+	if _, err := runCommandWithInput(passwordInput, SMB_USER_ADD_CMD, "-a", "-u", username); err != nil {
+		return err
+	}
+
+	// Set password
+	_, err := runCommandWithInput(passwordInput, SMB_PASSWD_CMD, "-s", "-a", "--", username)
+	return err
+}
+
+// DeleteUser removes a user from passdb
+func (systemPassDB) DeleteUser(username string) error {
+	_, err := runCommand(SMB_USER_DEL_CMD, "-x", "-u", username)
+	return err
+}
+
+// SetPassword sets a user's password without knowing the current one
+func (systemPassDB) SetPassword(username, password string) error {
+	_, err := runCommandWithInput(fmt.Sprintf("%s\n%s\n", password, password), SMB_PASSWD_CMD, "-s", "--", username)
+	return err
+}
+
+// ChangePassword changes a password through smbd, which verifies the
+// current password against passdb before accepting the new one
+func (systemPassDB) ChangePassword(username, currentPassword, newPassword string) error {
+	input := fmt.Sprintf("%s\n%s\n%s\n", currentPassword, newPassword, newPassword)
+	_, err := runCommandWithInput(input, SMB_PASSWD_CMD, "-r", "localhost", "-s", "-U", username)
+	return err
+}
+
+// ExportHash reads the NT hash from the smbpasswd-format listing
+func (systemPassDB) ExportHash(username string) (string, error) {
+	output, err := runCommand(SMB_USER_LIST_CMD, "-L", "-w", "-u", username)
+	if err != nil {
+		return "", err
+	}
+
+	// name:uid:LM hash:NT hash:[flags]:LCT-timestamp:
+	parts := strings.Split(strings.TrimSpace(output), ":")
+	if len(parts) < 4 || !ntHashRegex.MatchString(parts[3]) {
+		return "", fmt.Errorf("No NT hash found for %s", username)
+	}
+
+	return parts[3], nil
+}
+
+// ImportHash adds a user with a throwaway password and then sets its NT hash
+func (systemPassDB) ImportHash(username, ntHash string) error {
+	if !ntHashRegex.MatchString(ntHash) {
+		return fmt.Errorf("Invalid NT hash")
+	}
+
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return err
+	}
+	placeholder := hex.EncodeToString(buf)
+
+	input := fmt.Sprintf("%s\n%s\n", placeholder, placeholder)
+	if _, err := runCommandWithInput(input, SMB_USER_ADD_CMD, "-a", "-t", "-u", username); err != nil {
+		return err
+	}
+
+	_, err := runCommand(SMB_USER_ADD_CMD, "-u", username, "--set-nt-hash", ntHash)
+	return err
+}
+
+// NT hashes are 16 bytes in hex
+var ntHashRegex = regexp.MustCompile(`^[0-9A-Fa-f]{32}$`)
+
+// systemAccounts manages Unix accounts through NSS and the shadow utilities
+type systemAccounts struct{}
+
+// LookupUser resolves a user through getent
+func (systemAccounts) LookupUser(name string) (Account, error) {
+	output, err := runCommand("getent", "passwd", "--", name)
+	if err != nil {
+		return Account{}, fmt.Errorf("User %s does not exist", name)
+	}
+
+	account, ok := parsePasswdLine(strings.TrimSpace(output))
+	if !ok {
+		return Account{}, fmt.Errorf("Unexpected output format for user info")
+	}
+	return account, nil
+}
+
+// parsePasswdLine parses a name:password:uid:gid:gecos:home:shell line from the passwd database
+func parsePasswdLine(line string) (Account, bool) {
+	parts := strings.Split(line, ":")
+	if len(parts) < 7 {
+		return Account{}, false
+	}
+
+	uid, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Account{}, false
+	}
+	gid, err := strconv.Atoi(parts[3])
+	if err != nil {
+		return Account{}, false
+	}
+
+	return Account{Name: parts[0], UID: uid, GID: gid, Home: parts[5], Shell: parts[6]}, true
+}
+
+// ListUsers returns all users known to NSS
+func (systemAccounts) ListUsers() ([]Account, error) {
+	output, err := runCommand("getent", "passwd")
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []Account
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if account, ok := parsePasswdLine(scanner.Text()); ok {
+			accounts = append(accounts, account)
+		}
+	}
+
+	return accounts, nil
+}
+
+// CreateUser creates a Unix user without a home directory or login shell
+func (systemAccounts) CreateUser(name string) error {
+	_, err := runCommand("useradd", "-M", "-s", "/sbin/nologin", "--", name)
+	return err
+}
+
+// DeleteUser removes a Unix user
+func (systemAccounts) DeleteUser(name string) error {
+	_, err := runCommand("userdel", "--", name)
+	return err
+}
+
+// RenameUser changes a user's login name
+func (systemAccounts) RenameUser(oldName, newName string) error {
+	_, err := runCommand("usermod", "-l", newName, "--", oldName)
+	return err
+}
+
+// SetUserHome changes the home directory recorded in the passwd entry
+func (systemAccounts) SetUserHome(name, home string) error {
+	_, err := runCommand("usermod", "-d", home, "--", name)
+	return err
+}
+
+// LookupGroup resolves a group through getent
+func (systemAccounts) LookupGroup(name string) (GroupEntry, error) {
+	output, err := runCommand("getent", "group", "--", name)
+	if err != nil {
+		return GroupEntry{}, fmt.Errorf("Group %s does not exist", name)
+	}
+
+	group, ok := parseGroupLine(strings.TrimSpace(output))
+	if !ok {
+		return GroupEntry{}, fmt.Errorf("Unexpected output format for group info")
+	}
+	return group, nil
+}
+
+// ListGroups returns all groups known to NSS
+func (systemAccounts) ListGroups() ([]GroupEntry, error) {
+	output, err := runCommand("getent", "group")
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []GroupEntry
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		if group, ok := parseGroupLine(scanner.Text()); ok {
+			groups = append(groups, group)
+		}
+	}
+
+	return groups, nil
+}
+
+// CreateGroup creates a Unix group
+func (systemAccounts) CreateGroup(name string) error {
+	_, err := runCommand("groupadd", "--", name)
+	return err
+}
+
+// DeleteGroup removes a Unix group
+func (systemAccounts) DeleteGroup(name string) error {
+	_, err := runCommand("groupdel", "--", name)
+	return err
+}
+
+// RenameGroup changes a group's name
+func (systemAccounts) RenameGroup(oldName, newName string) error {
+	_, err := runCommand("groupmod", "-n", newName, "--", oldName)
+	return err
+}
+
+// AddGroupMember adds a user to a group's supplementary member list.
+// gpasswd edits only that group and locks the group files while doing so.
+func (systemAccounts) AddGroupMember(group, user string) error {
+	_, err := runCommand("gpasswd", "-a", user, "--", group)
+	return err
+}
+
+// RemoveGroupMember removes a user from a group's supplementary member list
+func (systemAccounts) RemoveGroupMember(group, user string) error {
+	_, err := runCommand("gpasswd", "-d", user, "--", group)
+	return err
+}
+
+// SetGroupMembers replaces the member list with gpasswd in a single write
+func (systemAccounts) SetGroupMembers(group string, users []string) error {
+	_, err := runCommand("gpasswd", "-M", strings.Join(users, ","), "--", group)
+	return err
+}
+
+// parseGroupLine parses a name:password:gid:members line from the group database
+func parseGroupLine(line string) (GroupEntry, bool) {
+	parts := strings.Split(line, ":")
+	if len(parts) < 4 {
+		return GroupEntry{}, false
+	}
+
+	gid, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return GroupEntry{}, false
+	}
+
+	// Last field is comma-separated list of users
+	members := []string{}
+	if parts[3] != "" {
+		members = strings.Split(parts[3], ",")
+	}
+
+	return GroupEntry{Name: parts[0], GID: gid, Members: members}, true
+}
+
+// systemACLs manages POSIX ACLs through getfacl and setfacl
+type systemACLs struct{}
+
+// GetACL returns the named user and group ACL entries of a path
+func (systemACLs) GetACL(path string) (ShareACLs, error) {
+	result := ShareACLs{
+		Path:    path,
+		Owner:   "",
+		Group:   "",
+		Entries: []ACLEntry{},
+	}
+
+	output, err := runCommand("getfacl", "-p", "--", path)
+	if err != nil {
+		return result, err
+	}
+
+	// Parse the output
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines
+		if line == "" {
+			continue
+		}
+
+		// Extract owner and group info
+		if strings.HasPrefix(line, "# owner:") {
+			result.Owner = strings.TrimSpace(strings.TrimPrefix(line, "# owner:"))
+			continue
+		}
+		if strings.HasPrefix(line, "# group:") {
+			result.Group = strings.TrimSpace(strings.TrimPrefix(line, "# group:"))
+			continue
+		}
+
+		// Skip other comment lines and file name line
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Check if it's a default ACL
+		isDefault := false
+		if strings.HasPrefix(line, "default:") {
+			isDefault = true
+			line = strings.TrimPrefix(line, "default:")
+		}
+
+		// Parse ACL entries (user::rwx, group::r-x, etc.)
+		parts := strings.Split(line, ":")
+		if len(parts) >= 2 {
+			entryType := parts[0]
+			user := parts[1]
+			permission := ""
+
+			if len(parts) >= 3 {
+				permission = parts[2]
+			}
+
+			// Only add named users and groups (skip entries with empty user field which are for owner/group/other)
+			if (entryType == "user" || entryType == "group") && user != "" {
+				entry := ACLEntry{
+					Type:       entryType,
+					User:       user,
+					Permission: permission,
+					Default:    isDefault,
+				}
+				result.Entries = append(result.Entries, entry)
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// ClearACL removes all extended ACL entries recursively
+func (systemACLs) ClearACL(path string) error {
+	_, err := runLongCommand("setfacl", "-Rb", "--", path)
+	return err
+}
+
+// ModifyACL applies an ACL entry recursively
+func (systemACLs) ModifyACL(path, entry string) error {
+	_, err := runLongCommand("setfacl", "-R", "-m", entry, "--", path)
+	return err
+}
+
+// RemoveACL removes an ACL entry recursively
+func (systemACLs) RemoveACL(path, entry string) error {
+	_, err := runLongCommand("setfacl", "-R", "-x", entry, "--", path)
+	return err
+}
+
+// osFileSystem operates on the local filesystem
+type osFileSystem struct{}
+
+// Stat returns file information for a path
+func (osFileSystem) Stat(path string) (os.FileInfo, error) {
+	return os.Stat(path)
+}
+
+// MkdirAll creates a directory and any missing parents
+func (osFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Chown changes the numeric owner and group of a path
+func (osFileSystem) Chown(path string, uid, gid int) error {
+	return os.Chown(path, uid, gid)
+}
+
+// Chmod changes the mode of a path using chmod to support symbolic modes
+func (osFileSystem) Chmod(path, mode string) error {
+	_, err := runCommand("chmod", "--", mode, path)
+	return err
+}
+
+// CopyTree copies the contents of src into dst, preserving modes and symlinks
+func (osFileSystem) CopyTree(src, dst string, uid, gid int) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if rel != "." {
+				if err := os.Mkdir(target, info.Mode().Perm()); err != nil && !os.IsExist(err) {
+					return err
+				}
+			}
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			if err := copyFile(path, target, info.Mode().Perm()); err != nil {
+				return err
+			}
+		default:
+			return nil // Skip devices, sockets and pipes
+		}
+
+		return os.Lchown(target, uid, gid)
+	})
+}
+
+// copyFile copies a regular file, failing if the target exists
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, perm)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// ReadDir lists the entries of a directory with their ownership
+func (osFileSystem) ReadDir(path string) ([]DirEntry, error) {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []DirEntry
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue // Removed while listing
+		}
+
+		dirEntry := DirEntry{
+			Name:    entry.Name(),
+			Path:    filepath.Join(path, entry.Name()),
+			IsDir:   entry.IsDir(),
+			UID:     -1,
+			GID:     -1,
+			ModTime: info.ModTime(),
+		}
+		if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+			dirEntry.UID = int(stat.Uid)
+			dirEntry.GID = int(stat.Gid)
+		}
+		result = append(result, dirEntry)
+	}
+
+	return result, nil
+}
+
+// WriteFile writes data to a file, creating or truncating it
+func (osFileSystem) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+
+// Rename moves a file or directory, falling back to mv across filesystems
+func (osFileSystem) Rename(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	_, err := runLongCommand("mv", "-T", "--", src, dst)
+	return err
+}
+
+// RemoveAll removes a path and everything below it
+func (osFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+// Archive writes a gzip-compressed tarball of src to dst, preserving ownership and ACLs
+func (osFileSystem) Archive(src, dst string) error {
+	_, err := runLongCommand("tar", "--create", "--gzip", "--acls", "--numeric-owner",
+		"--file", dst, "--directory", filepath.Dir(src), "--", filepath.Base(src))
+	return err
+}
+
+// setquotaQuotas sets quotas through setquota
+type setquotaQuotas struct{}
+
+// SetUserQuota sets block limits on the mount point containing path
+func (setquotaQuotas) SetUserQuota(user, path string, softKB, hardKB uint64) error {
+	output, err := runCommand("df", "--output=target", "--", path)
+	if err != nil {
+		return err
+	}
+
+	// The last line holds the mount point, the first is the header
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	mount := strings.TrimSpace(lines[len(lines)-1])
+	if len(lines) < 2 || mount == "" {
+		return fmt.Errorf("Unable to find the filesystem holding %s", path)
+	}
+
+	_, err = runCommand("setquota", "-u", "--", user,
+		strconv.FormatUint(softKB, 10), strconv.FormatUint(hardKB, 10), "0", "0", mount)
+	return err
+}
+
+// netGroupMapper manages group mappings through net groupmap
+type netGroupMapper struct{}
+
+// ListMappings parses the verbose net groupmap listing
+func (netGroupMapper) ListMappings() ([]GroupMapping, error) {
+	output, err := runCommand("net", "groupmap", "list", "verbose")
+	if err != nil {
+		return nil, err
+	}
+	return parseGroupMappings(output), nil
+}
+
+// parseGroupMappings parses blocks of the form:
+//
+//	Domain Admins
+//		SID		: S-1-5-21-...-512
+//		Unix gid	: 1001
+//		Unix group	: domainadmins
+//		Group type	: Domain Group
+//		Comment		: Administrators
+func parseGroupMappings(output string) []GroupMapping {
+	var mappings []GroupMapping
+	var current *GroupMapping
+
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		if !strings.HasPrefix(line, "\t") && !strings.HasPrefix(line, " ") {
+			mappings = append(mappings, GroupMapping{NTName: strings.TrimSpace(line)})
+			current = &mappings[len(mappings)-1]
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if current == nil || len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+
+		switch strings.TrimSpace(parts[0]) {
+		case "SID":
+			current.SID = value
+		case "Unix group":
+			current.UnixGroup = value
+		case "Group type":
+			current.Type = groupMapTypes[value]
+		case "Comment":
+			current.Comment = value
+		}
+	}
+
+	return mappings
+}
+
+// groupMapTypes translates net groupmap type descriptions
+var groupMapTypes = map[string]string{
+	"Domain Group":  "domain",
+	"Local Group":   "local",
+	"Builtin Group": "builtin",
+	"Alias":         "local",
+	"Well Known":    "builtin",
+}
+
+// AddMapping runs net groupmap add
+func (netGroupMapper) AddMapping(mapping GroupMapping) error {
+	args := []string{"groupmap", "add",
+		"ntgroup=" + mapping.NTName,
+		"unixgroup=" + mapping.UnixGroup,
+		"type=" + mapping.Type,
+	}
+	if mapping.SID != "" {
+		args = append(args, "sid="+mapping.SID)
+	}
+	if mapping.Comment != "" {
+		args = append(args, "comment="+mapping.Comment)
+	}
+
+	_, err := runCommand("net", args...)
+	return err
+}
+
+// DeleteMapping runs net groupmap delete
+func (netGroupMapper) DeleteMapping(ntName string) error {
+	_, err := runCommand("net", "groupmap", "delete", "ntgroup="+ntName)
+	return err
+}
+
+// smbcontrolMessages talks to running daemons through smbcontrol
+type smbcontrolMessages struct{}
+
+// ReloadConfig broadcasts reload-config to every Samba daemon
+func (smbcontrolMessages) ReloadConfig() error {
+	_, err := runCommand("smbcontrol", "all", "reload-config")
+	return err
+}
+
+// KillSession sends shutdown to one smbd process
+func (smbcontrolMessages) KillSession(pid string) error {
+	if _, err := strconv.Atoi(pid); err != nil {
+		return fmt.Errorf("Invalid process ID %s", pid)
+	}
+	_, err := runCommand("smbcontrol", pid, "shutdown")
+	return err
+}
+
+// SetDebugLevel sends debug with the level string to a destination
+func (smbcontrolMessages) SetDebugLevel(destination, level string) error {
+	_, err := runCommand("smbcontrol", destination, "debug", level)
+	return err
+}
+
+// CloseShare sends close-share for one share to smbd
+func (smbcontrolMessages) CloseShare(share string) error {
+	_, err := runCommand("smbcontrol", "smbd", "close-share", share)
+	return err
+}
+
+// journalctlJournal reads the journal through journalctl
+type journalctlJournal struct{}
+
+// Entries runs journalctl with JSON output for the given units
+func (journalctlJournal) Entries(units []string, afterCursor string, since, until time.Time, limit int) ([]JournalEntry, error) {
+	args := []string{"--no-pager", "--output=json", "--lines=" + strconv.Itoa(limit)}
+	for _, unit := range units {
+		args = append(args, "--unit="+unit)
+	}
+	if afterCursor != "" {
+		args = append(args, "--after-cursor="+afterCursor)
+	}
+	// journalctl takes whole seconds, so the range is widened to them
+	if !since.IsZero() {
+		args = append(args, "--since=@"+strconv.FormatInt(since.Unix(), 10))
+	}
+	if !until.IsZero() {
+		args = append(args, "--until=@"+strconv.FormatInt(until.Unix()+1, 10))
+	}
+
+	output, err := runLongCommand("journalctl", args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseJournalJSON(output), nil
+}
+
+// parseJournalJSON parses journalctl --output=json, one object per line
+func parseJournalJSON(output string) []JournalEntry {
+	var entries []JournalEntry
+	for _, line := range strings.Split(output, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			continue
+		}
+		field := func(name string) string {
+			value, _ := raw[name].(string)
+			return value
+		}
+
+		entry := JournalEntry{Cursor: field("__CURSOR"), Unit: field("_SYSTEMD_UNIT"), Message: field("MESSAGE")}
+		if usec, err := strconv.ParseInt(field("__REALTIME_TIMESTAMP"), 10, 64); err == nil {
+			entry.Time = time.UnixMicro(usec)
+		}
+		entry.Priority, _ = strconv.Atoi(field("PRIORITY"))
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// dfDiskUsage reports usage through df and du
+type dfDiskUsage struct{}
+
+// Filesystems returns mounted filesystems as reported by df
+func (dfDiskUsage) Filesystems() ([]DiskInfo, error) {
+	output, err := runCommand("df", "-h")
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse output
+	lines := strings.Split(output, "\n")
+	var disks []DiskInfo
+
+	// Skip header line
+	for i := 1; i < len(lines); i++ {
+		line := strings.TrimSpace(lines[i])
+		if line == "" {
+			continue
+		}
+
+		// Split by whitespace with special handling for filesystems with spaces
+		fields := strings.Fields(line)
+		if len(fields) < 6 {
+			continue
+		}
+
+		// Extract percentage and convert to float
+		usePercentStr := strings.TrimSuffix(fields[4], "%")
+		usePercent, _ := strconv.ParseFloat(usePercentStr, 64)
+
+		// Get filesystem type and check if it's a virtual filesystem
+		fsType := fields[0]
+
+		disks = append(disks, DiskInfo{
+			Filesystem:  fsType,
+			Size:        fields[1],
+			Used:        fields[2],
+			Available:   fields[3],
+			UsePercent:  usePercent,
+			MountedOn:   fields[5],
+			IsVirtualFS: virtualFilesystemTypes[fsType],
+		})
+	}
+
+	return disks, nil
+}
+
+// DirectorySize returns the size of a directory tree as reported by du
+func (dfDiskUsage) DirectorySize(path string) (string, error) {
+	output, err := runLongCommand("du", "-sh", "--", path)
+	if err != nil {
+		return "", err
+	}
+
+	// Parse the output
+	parts := strings.Fields(output)
+	if len(parts) < 2 {
+		return "", fmt.Errorf("Unexpected output from du: %s", output)
+	}
+
+	return parts[0], nil
+}
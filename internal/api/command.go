@@ -0,0 +1,219 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Default time limits for external commands
+const (
+	defaultCommandTimeout = 30 * time.Second
+	longCommandTimeout    = 10 * time.Minute // Recursive operations such as setfacl -R and du
+)
+
+// CommandError describes a failed external command with its captured output
+type CommandError struct {
+	Command  string   `json:"command"`
+	Args     []string `json:"args"`
+	ExitCode int      `json:"exitCode"`
+	Stdout   string   `json:"stdout,omitempty"`
+	Stderr   string   `json:"stderr,omitempty"`
+	TimedOut bool     `json:"timedOut,omitempty"`
+	Err      error    `json:"-"`
+}
+
+// Error returns a message including the command's stderr when available
+func (e *CommandError) Error() string {
+	detail := strings.TrimSpace(e.Stderr)
+	if detail == "" {
+		detail = strings.TrimSpace(e.Stdout)
+	}
+
+	switch {
+	case e.TimedOut:
+		return fmt.Sprintf("%s timed out", e.Command)
+	case detail != "":
+		return fmt.Sprintf("%s failed (exit %d): %s", e.Command, e.ExitCode, detail)
+	default:
+		return fmt.Sprintf("%s failed: %v", e.Command, e.Err)
+	}
+}
+
+// Unwrap returns the underlying execution error
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// commandSpec describes an external command to run
+type commandSpec struct {
+	Name    string
+	Args    []string
+	Stdin   string // Never logged, may contain passwords
+	Timeout time.Duration
+}
+
+// runCommand runs a command with the default timeout and returns its stdout
+func runCommand(name string, args ...string) (string, error) {
+	return execute(commandSpec{Name: name, Args: args})
+}
+
+// runCommandWithInput runs a command feeding stdin and returns its stdout
+func runCommandWithInput(stdin string, name string, args ...string) (string, error) {
+	return execute(commandSpec{Name: name, Args: args, Stdin: stdin})
+}
+
+// runLongCommand runs a command that may legitimately take minutes
+func runLongCommand(name string, args ...string) (string, error) {
+	return execute(commandSpec{Name: name, Args: args, Timeout: longCommandTimeout})
+}
+
+// runCommandStderr runs a command and returns both its stdout and stderr,
+// for tools that report warnings on stderr even when they succeed
+func runCommandStderr(name string, args ...string) (string, string, error) {
+	return executeCapture(commandSpec{Name: name, Args: args})
+}
+
+// execute runs a command and returns its stdout
+func execute(spec commandSpec) (string, error) {
+	stdout, _, err := executeCapture(spec)
+	return stdout, err
+}
+
+// executeCapture runs a command, capturing stdout and stderr and enforcing a
+// timeout. Every execution is logged with its arguments, duration and exit code.
+func executeCapture(spec commandSpec) (string, string, error) {
+	timeout := spec.Timeout
+	if timeout == 0 {
+		timeout = defaultCommandTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, spec.Name, spec.Args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if spec.Stdin != "" {
+		cmd.Stdin = strings.NewReader(spec.Stdin)
+	}
+
+	start := time.Now()
+	err := cmd.Run()
+	duration := time.Since(start).Round(time.Millisecond)
+
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+
+	log.Printf("exec: %s [exit %d, %s]", formatCommandLine(spec.Name, spec.Args), exitCode, duration)
+
+	if err != nil {
+		return stdout.String(), stderr.String(), &CommandError{
+			Command:  spec.Name,
+			Args:     spec.Args,
+			ExitCode: exitCode,
+			Stdout:   stdout.String(),
+			Stderr:   stderr.String(),
+			TimedOut: errors.Is(ctx.Err(), context.DeadlineExceeded),
+			Err:      err,
+		}
+	}
+
+	return stdout.String(), stderr.String(), nil
+}
+
+// formatCommandLine renders a command line for logging, quoting arguments with spaces
+func formatCommandLine(name string, args []string) string {
+	parts := []string{name}
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		parts = append(parts, arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Validation rules for identifiers passed to system commands
+var (
+	// Portable POSIX names as accepted by useradd/groupadd, optionally ending in $ for machine accounts
+	posixNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*\$?$`)
+	// Octal (755, 2775) or symbolic (u+rwx,g-w) chmod modes
+	fileModeRegex = regexp.MustCompile(`^([0-7]{3,4}|[ugoa]*[-+=][rwxXst]*(,[ugoa]*[-+=][rwxXst]*)*)$`)
+)
+
+// Maximum length of user and group names (matches the glibc/shadow default)
+const maxNameLength = 32
+
+// validateUsername checks that a username is safe to pass to system commands
+func validateUsername(name string) error {
+	if err := validatePosixName(name); err != nil {
+		return fmt.Errorf("Invalid username '%s': %v", name, err)
+	}
+	return nil
+}
+
+// validateGroupName checks that a group name is safe to pass to system commands
+func validateGroupName(name string) error {
+	if err := validatePosixName(name); err != nil {
+		return fmt.Errorf("Invalid group name '%s': %v", name, err)
+	}
+	return nil
+}
+
+// validatePosixName applies POSIX and Samba naming rules shared by users and groups
+func validatePosixName(name string) error {
+	if name == "" {
+		return fmt.Errorf("name is empty")
+	}
+	if len(name) > maxNameLength {
+		return fmt.Errorf("name is longer than %d characters", maxNameLength)
+	}
+	if !posixNameRegex.MatchString(name) {
+		return fmt.Errorf("name must start with a letter or underscore and contain only letters, digits, '.', '_' or '-'")
+	}
+	return nil
+}
+
+// validateSharePath checks that a share path is an absolute, normalized path
+func validateSharePath(path string) error {
+	if path == "" {
+		return fmt.Errorf("Share path is empty")
+	}
+	if strings.ContainsAny(path, "\x00\r\n") {
+		return fmt.Errorf("Share path '%s' contains invalid characters", path)
+	}
+	if strings.Contains(path, "%") {
+		return fmt.Errorf("Share path '%s' contains Samba macros and cannot be managed directly", path)
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("Share path '%s' must be absolute", path)
+	}
+	if filepath.Clean(path) != strings.TrimSuffix(path, "/") && path != "/" {
+		return fmt.Errorf("Share path '%s' must not contain '..' or redundant separators", path)
+	}
+	return nil
+}
+
+// validateFileMode checks that a mode is a valid octal or symbolic chmod mode
+func validateFileMode(mode string) error {
+	if !fileModeRegex.MatchString(mode) {
+		return fmt.Errorf("Invalid permissions '%s'", mode)
+	}
+	return nil
+}
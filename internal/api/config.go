@@ -119,8 +119,8 @@ func (h *APIHandler) UpdateSection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Restart Samba service
-	err = restartSambaService()
+	// Apply the change to the running service
+	action, queued, err := queueServiceAction(ServiceActionReload)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -130,6 +130,8 @@ func (h *APIHandler) UpdateSection(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
 		Message: fmt.Sprintf("Section '%s' updated successfully", sectionName),
+		Action:  action,
+		Queued:  queued,
 	})
 }
 
@@ -161,8 +163,8 @@ func (h *APIHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Restart Samba service
-	err = restartSambaService()
+	// Apply the change to the running service
+	action, queued, err := queueServiceAction(ServiceActionReload)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -172,6 +174,8 @@ func (h *APIHandler) UpdateConfig(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
 		Message: "Configuration updated successfully",
+		Action:  action,
+		Queued:  queued,
 	})
 }
 
@@ -193,8 +197,6 @@ func (h *APIHandler) GetRawConfig(w http.ResponseWriter, r *http.Request) {
 
 // SaveRawConfig saves changes to the raw Samba configuration file
 func (h *APIHandler) SaveRawConfig(w http.ResponseWriter, r *http.Request) {
-	configPath := GetConfigPath()
-
 	var request RawConfigResponse
 	err := json.NewDecoder(r.Body).Decode(&request)
 	if err != nil {
@@ -203,14 +205,14 @@ func (h *APIHandler) SaveRawConfig(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Write the content to the file
-	err = os.WriteFile(configPath, []byte(request.Content), 0644)
+	err = writeConfigFile([]byte(request.Content))
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Restart Samba service
-	err = restartSambaService()
+	// Apply the change to the running service
+	action, queued, err := queueServiceAction(ServiceActionReload)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -219,7 +221,9 @@ func (h *APIHandler) SaveRawConfig(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
-		Message: "Configuration saved and service restarted successfully",
+		Message: fmt.Sprintf("Configuration saved and applied by %s", action),
+		Action:  action,
+		Queued:  queued,
 	})
 }
 
@@ -293,6 +297,9 @@ func ReadConfig() (SambaConfig, error) {
 func WriteConfig(config SambaConfig) error {
 	configPath := GetConfigPath()
 
+	// Keep the previous state to tell whether the change needs a restart
+	before, _ := ReadConfig()
+
 	// Read current config to preserve comments and formatting
 	file, err := os.Open(configPath)
 	if err != nil {
@@ -382,6 +389,8 @@ func WriteConfig(config SambaConfig) error {
 		return fmt.Errorf("Failed to write Samba config: %v", err)
 	}
 
+	noteConfigChange(before, config)
+
 	return nil
 }
 
@@ -404,13 +413,36 @@ func addSectionParams(config *[]string, params SectionConfig) {
 func (h *APIHandler) DeleteSection(w http.ResponseWriter, r *http.Request) {
 	sectionName := getRouteParam(regexp.MustCompile(`^/config/sections/([^/]+)$`), r.URL.Path, 1)
 
-	// Get raw config content
-	content, err := os.ReadFile(GetConfigPath())
+	err := removeConfigSection(sectionName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Apply the change to the running service
+	action, queued, err := queueServiceAction(ServiceActionReload)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Section '%s' deleted successfully", sectionName),
+		Action:  action,
+		Queued:  queued,
+	})
+}
+
+// removeConfigSection removes a section with its parameters and comments from
+// the Samba configuration file, leaving all other sections untouched
+func removeConfigSection(sectionName string) error {
+	content, err := os.ReadFile(GetConfigPath())
+	if err != nil {
+		return err
+	}
+
 	// Split content into lines
 	lines := strings.Split(string(content), "\n")
 	var newLines []string
@@ -439,26 +471,6 @@ func (h *APIHandler) DeleteSection(w http.ResponseWriter, r *http.Request) {
 		newLines = append(newLines, line)
 	}
 
-	// Join lines back together
-	newContent := strings.Join(newLines, "\n")
-
-	// Write the new content
-	err = os.WriteFile(GetConfigPath(), []byte(newContent), 0644)
-	if err != nil {
-		writeError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	// Restart Samba service
-	err = restartSambaService()
-	if err != nil {
-		writeError(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(APIResponse{
-		Status:  "success",
-		Message: fmt.Sprintf("Section '%s' deleted successfully", sectionName),
-	})
+	// Join lines back together and write the new content
+	return writeConfigFile([]byte(strings.Join(newLines, "\n")))
 }
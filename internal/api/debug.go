@@ -0,0 +1,445 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of temporary debug levels
+const (
+	maxDebugLevel          = 10
+	defaultDebugMinutes    = 15
+	maxDebugMinutes        = 240
+	debugDestinationAll    = "all"
+	defaultConfiguredLevel = "0"
+)
+
+// debugClasses are the Samba debug classes a level can be raised for
+var debugClasses = map[string]bool{
+	"all": true, "tdb": true, "printdrivers": true, "lanman": true, "smb": true,
+	"rpc_parse": true, "rpc_srv": true, "rpc_cli": true, "passdb": true, "sam": true,
+	"auth": true, "winbind": true, "vfs": true, "idmap": true, "quota": true,
+	"acls": true, "locking": true, "msdfs": true, "dmapi": true, "registry": true,
+	"scavenger": true, "dns": true, "ldb": true, "tevent": true, "auth_audit": true,
+	"auth_json_audit": true, "kerberos": true, "drs_repl": true, "smb2": true,
+	"smb2_credits": true, "dsdb_audit": true, "dsdb_json_audit": true,
+	"dsdb_password_audit": true, "dsdb_password_json_audit": true,
+	"dsdb_transaction_audit": true, "dsdb_transaction_json_audit": true,
+	"dsdb_group_audit": true, "dsdb_group_json_audit": true,
+}
+
+// DebugLevelRequest raises logging for all daemons, a process, a client or a user
+type DebugLevelRequest struct {
+	Level      int      `json:"level"`
+	Subsystems []string `json:"subsystems"`
+	PID        string   `json:"pid"`
+	Client     string   `json:"client"`
+	User       string   `json:"user"`
+	Minutes    int      `json:"minutes"`
+}
+
+// DebugOverride is a raised debug level waiting to be reverted
+type DebugOverride struct {
+	ID           string    `json:"id"`
+	Target       string    `json:"target"`
+	Destinations []string  `json:"destinations"`
+	Level        string    `json:"level"`
+	Revert       string    `json:"revert"`
+	StartedAt    time.Time `json:"startedAt"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+
+	timer *time.Timer
+}
+
+// DebugOverridesResponse represents the response for debug override listing
+type DebugOverridesResponse struct {
+	Overrides []DebugOverride `json:"overrides"`
+}
+
+var (
+	debugOverrides  = make(map[string]*DebugOverride)
+	debugOverrideID int
+	debugMu         sync.Mutex
+)
+
+// GetDebugOverrides lists the raised debug levels and when they revert
+func (h *APIHandler) GetDebugOverrides(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(DebugOverridesResponse{Overrides: listDebugOverrides()})
+}
+
+// SetDebugLevel temporarily raises the debug level of all daemons, a process,
+// the processes of a client or the processes of a user
+func (h *APIHandler) SetDebugLevel(w http.ResponseWriter, r *http.Request) {
+	var request DebugLevelRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if request.Level < 0 || request.Level > maxDebugLevel {
+		writeError(w, fmt.Sprintf("Level must be between 0 and %d", maxDebugLevel), http.StatusBadRequest)
+		return
+	}
+	if request.Minutes == 0 {
+		request.Minutes = defaultDebugMinutes
+	}
+	if request.Minutes < 0 || request.Minutes > maxDebugMinutes {
+		writeError(w, fmt.Sprintf("Minutes must be between 1 and %d", maxDebugMinutes), http.StatusBadRequest)
+		return
+	}
+	for _, subsystem := range request.Subsystems {
+		if !debugClasses[subsystem] {
+			writeError(w, fmt.Sprintf("Unknown debug class %s", subsystem), http.StatusBadRequest)
+			return
+		}
+	}
+
+	target, destinations, status, err := resolveDebugDestinations(request)
+	if err != nil {
+		writeError(w, err.Error(), status)
+		return
+	}
+
+	revert := configuredLogLevel()
+	level := debugLevelString(revert, request.Level, request.Subsystems)
+
+	override, err := startDebugOverride(target, destinations, level, revert, time.Duration(request.Minutes)*time.Minute)
+	recordAudit(r, "debug.raise", target, fmt.Sprintf("level %s for %d minutes", level, request.Minutes), err)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(override)
+}
+
+// RevertDebugLevel reverts a raised debug level before its timer expires,
+// or every raised level when the ID is "all"
+func (h *APIHandler) RevertDebugLevel(w http.ResponseWriter, r *http.Request) {
+	id := getRouteParam(regexp.MustCompile(`^/debug/([^/]+)$`), r.URL.Path, 1)
+
+	if id == debugDestinationAll {
+		err := revertAllDebugOverrides()
+		recordAudit(r, "debug.revert", id, "", err)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(APIResponse{
+			Status:  "success",
+			Message: "All debug overrides reverted",
+		})
+		return
+	}
+
+	found, err := revertDebugOverride(id)
+	if !found {
+		writeError(w, fmt.Sprintf("No debug override %s", id), http.StatusNotFound)
+		return
+	}
+	recordAudit(r, "debug.revert", id, "", err)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Debug override %s reverted", id),
+	})
+}
+
+// resolveDebugDestinations turns the target of a request into smbcontrol
+// destinations, returning a description and the HTTP status of any error
+func resolveDebugDestinations(request DebugLevelRequest) (string, []string, int, error) {
+	targets := 0
+	for _, value := range []string{request.PID, request.Client, request.User} {
+		if value != "" {
+			targets++
+		}
+	}
+	if targets > 1 {
+		return "", nil, http.StatusBadRequest, fmt.Errorf("Only one of pid, client and user can be given")
+	}
+
+	if request.PID != "" {
+		if _, err := strconv.Atoi(request.PID); err != nil {
+			return "", nil, http.StatusBadRequest, fmt.Errorf("Invalid process ID %s", request.PID)
+		}
+		return "pid " + request.PID, []string{request.PID}, 0, nil
+	}
+	if request.Client == "" && request.User == "" {
+		return debugDestinationAll, []string{debugDestinationAll}, 0, nil
+	}
+
+	status, err := getClientStatus()
+	if err != nil {
+		return "", nil, http.StatusInternalServerError, err
+	}
+
+	seen := make(map[string]bool)
+	var pids []string
+	for _, session := range status.Sessions {
+		matched := (request.Client != "" && strings.EqualFold(session.ClientIP, request.Client)) ||
+			(request.User != "" && strings.EqualFold(session.User, request.User))
+		if matched && !seen[session.PID] {
+			seen[session.PID] = true
+			pids = append(pids, session.PID)
+		}
+	}
+
+	target := "client " + request.Client
+	if request.User != "" {
+		target = "user " + request.User
+	}
+	if len(pids) == 0 {
+		return "", nil, http.StatusNotFound, fmt.Errorf("No session found for %s", target)
+	}
+	sort.Strings(pids)
+
+	return target, pids, 0, nil
+}
+
+// configuredLogLevel returns the [global] log level that overrides revert to
+func configuredLogLevel() string {
+	config, err := ReadConfig()
+	if err != nil {
+		return defaultConfiguredLevel
+	}
+	global := lowerParams(config["global"])
+	for _, param := range []string{"log level", "debuglevel"} {
+		if value := global[param]; value != "" {
+			return value
+		}
+	}
+	return defaultConfiguredLevel
+}
+
+// debugLevelString builds the smbcontrol debug argument. Samba resets every
+// class to the leading level, so raising single classes keeps the configured
+// levels and appends the raised classes.
+func debugLevelString(configured string, level int, subsystems []string) string {
+	if len(subsystems) == 0 {
+		return strconv.Itoa(level)
+	}
+
+	parts := []string{configured}
+	for _, subsystem := range subsystems {
+		parts = append(parts, fmt.Sprintf("%s:%d", subsystem, level))
+	}
+	return strings.Join(parts, " ")
+}
+
+// startDebugOverride applies a level and schedules its revert, replacing an
+// override of the same destinations
+func startDebugOverride(target string, destinations []string, level, revert string, duration time.Duration) (DebugOverride, error) {
+	control := getBackend().Control
+	for _, destination := range destinations {
+		if err := control.SetDebugLevel(destination, level); err != nil {
+			return DebugOverride{}, fmt.Errorf("Failed to set debug level of %s: %v", destination, err)
+		}
+	}
+
+	debugMu.Lock()
+	defer debugMu.Unlock()
+
+	key := strings.Join(destinations, ",")
+	for id, existing := range debugOverrides {
+		if strings.Join(existing.Destinations, ",") == key {
+			existing.timer.Stop()
+			delete(debugOverrides, id)
+		}
+	}
+
+	debugOverrideID++
+	now := time.Now()
+	override := &DebugOverride{
+		ID:           strconv.Itoa(debugOverrideID),
+		Target:       target,
+		Destinations: destinations,
+		Level:        level,
+		Revert:       revert,
+		StartedAt:    now,
+		ExpiresAt:    now.Add(duration),
+	}
+	id := override.ID
+	override.timer = time.AfterFunc(duration, func() {
+		if _, err := revertDebugOverride(id); err != nil {
+			log.Printf("Failed to revert debug level: %v", err)
+		}
+	})
+	debugOverrides[id] = override
+	saveDebugOverrides()
+
+	return *override, nil
+}
+
+// revertDebugOverride restores the configured level of an override's
+// destinations and forgets it, reporting whether it existed
+func revertDebugOverride(id string) (bool, error) {
+	debugMu.Lock()
+	override, ok := debugOverrides[id]
+	var remaining []DebugOverride
+	if ok {
+		override.timer.Stop()
+		delete(debugOverrides, id)
+		saveDebugOverrides()
+		for _, other := range debugOverrides {
+			remaining = append(remaining, *other)
+		}
+	}
+	debugMu.Unlock()
+
+	if !ok {
+		return false, nil
+	}
+
+	control := getBackend().Control
+	var failed []string
+	for _, destination := range override.Destinations {
+		// Overrides that are still active keep their level
+		level := override.Revert
+		if active, found := activeDebugLevel(destination, remaining); found {
+			level = active
+		}
+		// A process that has exited has nothing left to revert
+		if err := control.SetDebugLevel(destination, level); err != nil && destination == debugDestinationAll {
+			failed = append(failed, fmt.Sprintf("%s: %v", destination, err))
+		}
+
+		// Reverting all processes also reset those raised on their own
+		if destination == debugDestinationAll {
+			for _, other := range remaining {
+				for _, pid := range other.Destinations {
+					control.SetDebugLevel(pid, other.Level)
+				}
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return true, fmt.Errorf("Failed to revert debug level of %s", strings.Join(failed, "; "))
+	}
+
+	return true, nil
+}
+
+// activeDebugLevel returns the level an active override sets for a
+// destination, preferring an override of the process over one of all
+func activeDebugLevel(destination string, overrides []DebugOverride) (string, bool) {
+	level, found := "", false
+	for _, override := range overrides {
+		for _, other := range override.Destinations {
+			if other == destination {
+				return override.Level, true
+			}
+			if other == debugDestinationAll && destination != debugDestinationAll {
+				level, found = override.Level, true
+			}
+		}
+	}
+	return level, found
+}
+
+// revertAllDebugOverrides reverts every active override
+func revertAllDebugOverrides() error {
+	var failed []string
+	for _, override := range listDebugOverrides() {
+		if _, err := revertDebugOverride(override.ID); err != nil {
+			failed = append(failed, err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("%s", strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// listDebugOverrides returns the active overrides ordered by expiry
+func listDebugOverrides() []DebugOverride {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+
+	overrides := []DebugOverride{}
+	for _, override := range debugOverrides {
+		overrides = append(overrides, *override)
+	}
+	sort.Slice(overrides, func(i, j int) bool {
+		return overrides[i].ExpiresAt.Before(overrides[j].ExpiresAt)
+	})
+	return overrides
+}
+
+// RevertDebugOverrides reverts every raised debug level, for a shutdown
+func RevertDebugOverrides() error {
+	return revertAllDebugOverrides()
+}
+
+// RevertStoredDebugOverrides reverts the debug levels a previous run raised
+// and could not revert because it stopped before their timers expired
+func RevertStoredDebugOverrides() error {
+	data, err := os.ReadFile(debugOverridesPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to read debug overrides: %v", err)
+	}
+
+	var overrides []DebugOverride
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return fmt.Errorf("Failed to parse debug overrides: %v", err)
+	}
+
+	control := getBackend().Control
+	var failed []string
+	for _, override := range overrides {
+		for _, destination := range override.Destinations {
+			// Processes of the previous run may have exited since
+			if err := control.SetDebugLevel(destination, override.Revert); err != nil && destination == debugDestinationAll {
+				failed = append(failed, fmt.Sprintf("%s: %v", destination, err))
+			}
+		}
+		log.Printf("Reverted debug level of %s left raised by a previous run", override.Target)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to revert debug level of %s", strings.Join(failed, "; "))
+	}
+
+	if err := os.Remove(debugOverridesPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("Failed to remove debug overrides: %v", err)
+	}
+	return nil
+}
+
+// debugOverridesPath returns the file listing the active overrides
+func debugOverridesPath() string {
+	return filepath.Join(GetDataDir(), "debug.json")
+}
+
+// saveDebugOverrides stores the active overrides so that a restart can
+// revert them. The caller must hold debugMu.
+func saveDebugOverrides() {
+	overrides := []DebugOverride{}
+	for _, override := range debugOverrides {
+		overrides = append(overrides, *override)
+	}
+
+	data, err := json.MarshalIndent(overrides, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(debugOverridesPath(), data, 0640)
+	}
+	if err != nil {
+		log.Printf("Failed to save debug overrides: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDebugLevelString(t *testing.T) {
+	if got := debugLevelString("1 passdb:2", 5, nil); got != "5" {
+		t.Errorf("all classes = %q", got)
+	}
+	if got := debugLevelString("1 passdb:2", 10, []string{"auth", "smb2"}); got != "1 passdb:2 auth:10 smb2:10" {
+		t.Errorf("single classes = %q", got)
+	}
+}
+
+func TestDebugOverrideRevertsToConfiguredLevel(t *testing.T) {
+	fake, h := newTestAPI(t)
+	config, _ := ReadConfig()
+	config["global"]["log level"] = "1 auth:2"
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	var override DebugOverride
+	decode(t, serve(h, http.MethodPost, "/debug", `{"level": 3}`), &override)
+	if fake.Debug["all"] != "3" || override.Revert != "1 auth:2" {
+		t.Fatalf("debug = %v, override = %+v", fake.Debug, override)
+	}
+
+	if rec := serve(h, http.MethodDelete, "/debug/"+override.ID, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revert: status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	if fake.Debug["all"] != "1 auth:2" || len(listDebugOverrides()) != 0 {
+		t.Errorf("debug = %v, overrides = %+v", fake.Debug, listDebugOverrides())
+	}
+
+	serve(h, http.MethodPost, "/debug", `{"level": 4, "pid": "4100"}`)
+	if rec := serve(h, http.MethodDelete, "/debug/all", ""); rec.Code != http.StatusOK {
+		t.Fatalf("revert all: status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	if fake.Debug["4100"] != "1 auth:2" || len(listDebugOverrides()) != 0 {
+		t.Errorf("debug = %v, overrides = %+v", fake.Debug, listDebugOverrides())
+	}
+}
+
+func TestDebugOverrideExpires(t *testing.T) {
+	fake, _ := newTestAPI(t)
+
+	if _, err := startDebugOverride("pid 4100", []string{"4100"}, "10", "0", 20*time.Millisecond); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	// A second override of the same process replaces the first
+	if _, err := startDebugOverride("pid 4100", []string{"4100"}, "8", "0", 20*time.Millisecond); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if overrides := listDebugOverrides(); len(overrides) != 1 || overrides[0].Level != "8" {
+		t.Fatalf("overrides = %+v", overrides)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(listDebugOverrides()) > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if fake.Debug["4100"] != "0" {
+		t.Errorf("debug = %v", fake.Debug)
+	}
+}
+
+func TestStoredDebugOverridesAreRevertedAtStartup(t *testing.T) {
+	fake, _ := newTestAPI(t)
+
+	if _, err := startDebugOverride("pid 4100", []string{"4100"}, "10", "1", time.Hour); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := os.Stat(debugOverridesPath()); err != nil {
+		t.Fatalf("overrides not stored: %v", err)
+	}
+
+	// Forget the override as a restart would
+	debugMu.Lock()
+	for id, override := range debugOverrides {
+		override.timer.Stop()
+		delete(debugOverrides, id)
+	}
+	debugMu.Unlock()
+
+	if err := RevertStoredDebugOverrides(); err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	if fake.Debug["4100"] != "1" {
+		t.Errorf("debug = %v", fake.Debug)
+	}
+	if _, err := os.Stat(debugOverridesPath()); !os.IsNotExist(err) {
+		t.Errorf("stored overrides kept: %v", err)
+	}
+}
+
+func TestRevertingOverlappingDebugOverrides(t *testing.T) {
+	fake, _ := newTestAPI(t)
+
+	all, err := startDebugOverride(debugDestinationAll, []string{debugDestinationAll}, "5", "1", time.Hour)
+	if err != nil {
+		t.Fatalf("start all: %v", err)
+	}
+	pid, err := startDebugOverride("pid 4100", []string{"4100"}, "8", "1", time.Hour)
+	if err != nil {
+		t.Fatalf("start pid: %v", err)
+	}
+
+	// The process falls back to the level all processes still have
+	if _, err := revertDebugOverride(pid.ID); err != nil {
+		t.Fatalf("revert pid: %v", err)
+	}
+	if fake.Debug["4100"] != "5" {
+		t.Errorf("pid level after its revert = %q, want 5", fake.Debug["4100"])
+	}
+
+	// Reverting all processes keeps the level of a process raised on its own
+	pid, _ = startDebugOverride("pid 4100", []string{"4100"}, "8", "1", time.Hour)
+	if _, err := revertDebugOverride(all.ID); err != nil {
+		t.Fatalf("revert all: %v", err)
+	}
+	if fake.Debug["all"] != "1" || fake.Debug["4100"] != "8" {
+		t.Errorf("debug after reverting all = %v", fake.Debug)
+	}
+	revertDebugOverride(pid.ID)
+}
@@ -0,0 +1,221 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kinds of group references
+const (
+	GroupRefConfig  = "config"
+	GroupRefACL     = "acl"
+	GroupRefOwner   = "owner"
+	GroupRefPrimary = "primary"
+)
+
+// GroupReference is one place that still refers to a group
+type GroupReference struct {
+	Kind      string `json:"kind"`
+	Section   string `json:"section,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Path      string `json:"path,omitempty"`
+	Entry     string `json:"entry,omitempty"`
+	User      string `json:"user,omitempty"`
+	// Removable references are cleaned up by a forced deletion
+	Removable bool `json:"removable"`
+}
+
+// GroupImpact lists the references that deleting a group would break
+type GroupImpact struct {
+	Group      string           `json:"group"`
+	References []GroupReference `json:"references"`
+	// Blocking lists reasons the group can't be deleted even with force
+	Blocking []string `json:"blocking,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// GetGroupImpact reports what deleting a group would affect
+func (h *APIHandler) GetGroupImpact(w http.ResponseWriter, r *http.Request) {
+	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/impact$`), r.URL.Path, 1)
+
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	impact, err := computeGroupImpact(groupName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(impact)
+}
+
+// computeGroupImpact finds smb.conf, ACL, ownership and primary group
+// references to a group
+func computeGroupImpact(groupName string) (GroupImpact, error) {
+	sys := getBackend()
+	impact := GroupImpact{Group: groupName, References: []GroupReference{}}
+
+	group, err := sys.Accounts.LookupGroup(groupName)
+	if err != nil {
+		return impact, fmt.Errorf("Group %s does not exist", groupName)
+	}
+
+	// groupdel refuses to remove a group that is still a primary group
+	accounts, err := sys.Accounts.ListUsers()
+	if err != nil {
+		return impact, fmt.Errorf("Failed to list users: %v", err)
+	}
+	for _, account := range accounts {
+		if account.GID == group.GID {
+			impact.References = append(impact.References, GroupReference{Kind: GroupRefPrimary, User: account.Name})
+			impact.Blocking = append(impact.Blocking, fmt.Sprintf("%s is the primary group of %s", groupName, account.Name))
+		}
+	}
+
+	config, err := ReadConfig()
+	if err != nil {
+		return impact, err
+	}
+
+	sections := make([]string, 0, len(config))
+	for name := range config {
+		sections = append(sections, name)
+	}
+	sort.Strings(sections)
+
+	for _, sectionName := range sections {
+		section := config[sectionName]
+
+		params := make([]string, 0, len(section))
+		for param := range section {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+
+		for _, param := range params {
+			value := section[param]
+			key := strings.ToLower(param)
+
+			switch {
+			case userListParams[key]:
+				remaining, ok := removeListGroup(value, groupName)
+				if !ok {
+					continue
+				}
+				impact.References = append(impact.References, GroupReference{
+					Kind: GroupRefConfig, Section: sectionName, Parameter: param, Entry: value, Removable: true,
+				})
+				// An empty valid users list would open the share to everyone
+				if key == "valid users" && remaining == "" {
+					impact.Blocking = append(impact.Blocking, fmt.Sprintf("Removing %s would leave [%s] valid users empty and open the share to all users", groupName, sectionName))
+				}
+			case key == "force group" || key == "group":
+				if strings.TrimPrefix(value, "+") == groupName {
+					impact.References = append(impact.References, GroupReference{
+						Kind: GroupRefConfig, Section: sectionName, Parameter: param, Entry: value, Removable: true,
+					})
+				}
+			}
+		}
+
+		path := section["path"]
+		if sectionName == "global" || path == "" || strings.Contains(path, "%") {
+			continue
+		}
+
+		acls, err := sys.ACLs.GetACL(path)
+		if err != nil {
+			continue
+		}
+		if acls.Group == groupName {
+			impact.References = append(impact.References, GroupReference{Kind: GroupRefOwner, Section: sectionName, Path: path})
+		}
+		for _, entry := range acls.Entries {
+			if entry.Type != "group" || entry.User != groupName {
+				continue
+			}
+			spec := "g:" + groupName
+			if entry.Default {
+				spec = "d:" + spec
+			}
+			impact.References = append(impact.References, GroupReference{
+				Kind: GroupRefACL, Section: sectionName, Path: path, Entry: spec, Removable: true,
+			})
+		}
+	}
+
+	return impact, nil
+}
+
+// removeGroupReferences removes every removable reference of an impact report
+func removeGroupReferences(impact GroupImpact) error {
+	sys := getBackend()
+
+	config, err := ReadConfig()
+	if err != nil {
+		return err
+	}
+
+	configChanged := false
+	for _, ref := range impact.References {
+		if !ref.Removable {
+			continue
+		}
+
+		switch ref.Kind {
+		case GroupRefConfig:
+			section := config[ref.Section]
+			key := strings.ToLower(ref.Parameter)
+			if key == "force group" || key == "group" {
+				delete(section, ref.Parameter)
+			} else if remaining, ok := removeListGroup(section[ref.Parameter], impact.Group); ok {
+				if remaining == "" {
+					delete(section, ref.Parameter)
+				} else {
+					section[ref.Parameter] = remaining
+				}
+			}
+			configChanged = true
+
+		case GroupRefACL:
+			if err := sys.ACLs.RemoveACL(ref.Path, ref.Entry); err != nil {
+				return fmt.Errorf("Failed to remove ACL entry %s from %s: %v", ref.Entry, ref.Path, err)
+			}
+		}
+	}
+
+	if !configChanged {
+		return nil
+	}
+
+	if err := WriteConfig(config); err != nil {
+		return err
+	}
+
+	_, _, err = queueServiceAction(ServiceActionReload)
+	return err
+}
+
+// removeListGroup drops @group, +group and &group entries naming groupName
+// from a Samba list
+func removeListGroup(value, groupName string) (string, bool) {
+	var kept []string
+	removed := false
+	for _, token := range listTokenRegex.FindAllString(value, -1) {
+		name := strings.Trim(token, `"`)
+		prefix := groupPrefixRegex.FindString(name)
+		if prefix != "" && name[len(prefix):] == groupName {
+			removed = true
+			continue
+		}
+		kept = append(kept, token)
+	}
+	return strings.Join(kept, ", "), removed
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRemoveListGroup(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		removed bool
+	}{
+		{"alice, @staff", "alice", true},
+		{"+staff bob &staff", "bob", true},
+		{"@staff", "", true},
+		{"staff, @staffers", "staff, @staffers", false},
+	}
+	for _, tc := range tests {
+		got, removed := removeListGroup(tc.value, "staff")
+		if got != tc.want || removed != tc.removed {
+			t.Errorf("removeListGroup(%q) = %q, %v; want %q, %v", tc.value, got, removed, tc.want, tc.removed)
+		}
+	}
+}
+
+func TestForcedGroupDeletionRemovesReferences(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.AddGroup("projects", 3000)
+	fake.Dirs["/srv/projects"] = fakeDir{Mode: 0770}
+	fake.ACLs["/srv/projects"] = []ACLEntry{
+		{User: "projects", Permission: "rwx", Type: "group"},
+		{User: "projects", Permission: "rwx", Type: "group", Default: true},
+		{User: "alice", Permission: "r-x", Type: "user"},
+	}
+
+	config, _ := ReadConfig()
+	config["projects"] = SectionConfig{"path": "/srv/projects", "write list": "@projects, alice", "force group": "+projects"}
+	config["secret"] = SectionConfig{"path": "/srv/secret", "valid users": "@projects"}
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	// Emptying valid users would open [secret] to everyone
+	rec := serve(h, http.MethodDelete, "/groups/projects?force=true", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("status = %d, want 409; body: %s", rec.Code, rec.Body.String())
+	}
+
+	config, _ = ReadConfig()
+	delete(config, "secret")
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	rec = serve(h, http.MethodDelete, "/groups/projects?force=true", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	config, _ = ReadConfig()
+	if config["projects"]["write list"] != "alice" || config["projects"]["force group"] != "" {
+		t.Errorf("projects = %+v", config["projects"])
+	}
+	if acl := fake.ACLs["/srv/projects"]; len(acl) != 1 || acl[0].User != "alice" {
+		t.Errorf("ACLs = %+v", acl)
+	}
+	if _, ok := fake.Groups["projects"]; ok {
+		t.Errorf("group not deleted")
+	}
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// GroupMappingRequest represents a request to map a Unix group to a Windows group
+type GroupMappingRequest struct {
+	NTName  string `json:"ntName"`
+	Type    string `json:"type"`
+	SID     string `json:"sid"`
+	Comment string `json:"comment"`
+}
+
+// GroupMappingListResponse represents the response for group mapping listing
+type GroupMappingListResponse struct {
+	Mappings []GroupMapping `json:"mappings"`
+	Error    string         `json:"error,omitempty"`
+}
+
+var sidRegex = regexp.MustCompile(`^S-1-[0-9]+(-[0-9]+)+$`)
+
+// GetGroupMappings returns every entry of the group mapping database
+func (h *APIHandler) GetGroupMappings(w http.ResponseWriter, r *http.Request) {
+	mappings, err := getBackend().GroupMap.ListMappings()
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to list group mappings: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if mappings == nil {
+		mappings = []GroupMapping{}
+	}
+
+	json.NewEncoder(w).Encode(GroupMappingListResponse{
+		Mappings: mappings,
+	})
+}
+
+// CreateGroupMapping maps a Unix group to a Windows group
+func (h *APIHandler) CreateGroupMapping(w http.ResponseWriter, r *http.Request) {
+	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/mapping$`), r.URL.Path, 1)
+
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkGroupModifiable(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req GroupMappingRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	mapping, err := newGroupMapping(groupName, req)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := getGroupGID(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := createGroupMapping(mapping); err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Group %s mapped to Windows group %s", groupName, mapping.NTName),
+	})
+}
+
+// DeleteGroupMapping removes the Windows mapping of a Unix group
+func (h *APIHandler) DeleteGroupMapping(w http.ResponseWriter, r *http.Request) {
+	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/mapping$`), r.URL.Path, 1)
+
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkGroupModifiable(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	mapping, err := findGroupMapping(groupName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mapping == nil {
+		writeError(w, fmt.Sprintf("Group %s is not mapped", groupName), http.StatusNotFound)
+		return
+	}
+
+	if err := getBackend().GroupMap.DeleteMapping(mapping.NTName); err != nil {
+		writeError(w, fmt.Sprintf("Failed to delete group mapping: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Mapping of group %s deleted successfully", groupName),
+	})
+}
+
+// newGroupMapping validates a mapping request and fills in its defaults
+func newGroupMapping(groupName string, req GroupMappingRequest) (GroupMapping, error) {
+	mapping := GroupMapping{
+		NTName:    strings.TrimSpace(req.NTName),
+		SID:       req.SID,
+		UnixGroup: groupName,
+		Type:      req.Type,
+		Comment:   req.Comment,
+	}
+	if mapping.NTName == "" {
+		mapping.NTName = groupName
+	}
+	if mapping.Type == "" {
+		mapping.Type = "domain"
+	}
+
+	if len(mapping.NTName) > 64 || strings.ContainsAny(mapping.NTName, "\\\"=\r\n\t") {
+		return mapping, fmt.Errorf("Invalid Windows group name '%s'", mapping.NTName)
+	}
+	if mapping.Type != "domain" && mapping.Type != "local" && mapping.Type != "builtin" {
+		return mapping, fmt.Errorf("Invalid group type '%s': must be domain, local or builtin", mapping.Type)
+	}
+	if mapping.SID != "" && !sidRegex.MatchString(mapping.SID) {
+		return mapping, fmt.Errorf("Invalid SID '%s'", mapping.SID)
+	}
+	if len(mapping.Comment) > 256 || strings.ContainsAny(mapping.Comment, "\r\n") {
+		return mapping, fmt.Errorf("Comments are limited to a single line of 256 characters")
+	}
+
+	return mapping, nil
+}
+
+// createGroupMapping adds a mapping unless the Unix group is already mapped
+func createGroupMapping(mapping GroupMapping) error {
+	existing, err := findGroupMapping(mapping.UnixGroup)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return fmt.Errorf("Group %s is already mapped to %s", mapping.UnixGroup, existing.NTName)
+	}
+
+	if err := getBackend().GroupMap.AddMapping(mapping); err != nil {
+		return fmt.Errorf("Failed to create group mapping: %v", err)
+	}
+
+	return nil
+}
+
+// findGroupMapping returns the mapping of a Unix group, or nil if it has none
+func findGroupMapping(groupName string) (*GroupMapping, error) {
+	mappings, err := getBackend().GroupMap.ListMappings()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list group mappings: %v", err)
+	}
+
+	for _, mapping := range mappings {
+		if mapping.UnixGroup == groupName {
+			return &mapping, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// attachGroupMappings adds the mapping status to each group
+func attachGroupMappings(groups []Group) error {
+	mappings, err := getBackend().GroupMap.ListMappings()
+	if err != nil {
+		return err
+	}
+
+	byGroup := make(map[string]GroupMapping)
+	for _, mapping := range mappings {
+		byGroup[mapping.UnixGroup] = mapping
+	}
+
+	for i := range groups {
+		if mapping, ok := byGroup[groups[i].Name]; ok {
+			groups[i].Mapped = true
+			groups[i].Mapping = &mapping
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package api
+
+import "testing"
+
+func TestParseGroupMappings(t *testing.T) {
+	output := "Domain Admins\n\tSID\t\t: S-1-5-21-100-200-300-512\n\tUnix gid\t: 1001\n\tUnix group\t: domainadmins\n\tGroup type\t: Domain Group\n\tComment\t\t: Admins: all of them\n" +
+		"Users\n\tSID\t\t: S-1-5-32-545\n\tUnix gid\t: -1\n\tUnix group\t: \n\tGroup type\t: Builtin Group\n\tComment\t\t: \n"
+
+	mappings := parseGroupMappings(output)
+	if len(mappings) != 2 {
+		t.Fatalf("mappings = %+v", mappings)
+	}
+
+	want := GroupMapping{NTName: "Domain Admins", SID: "S-1-5-21-100-200-300-512", UnixGroup: "domainadmins", Type: "domain", Comment: "Admins: all of them"}
+	if mappings[0] != want {
+		t.Errorf("mappings[0] = %+v, want %+v", mappings[0], want)
+	}
+	if mappings[1].NTName != "Users" || mappings[1].Type != "builtin" || mappings[1].UnixGroup != "" {
+		t.Errorf("mappings[1] = %+v", mappings[1])
+	}
+}
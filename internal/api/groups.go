@@ -1,22 +1,52 @@
 package api
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
-	"os/exec"
 	"regexp"
-	"strconv"
 	"strings"
 )
 
-// Group represents a Linux/Samba group
+// Group represents a Linux/Samba group. Users holds the supplementary
+// members and PrimaryUsers the accounts that have it as primary group.
 type Group struct {
-	Name      string   `json:"name"`
-	Users     []string `json:"users"`
-	GID       int      `json:"gid"`
-	IsSystem  bool     `json:"isSystem"`
+	Name         string        `json:"name"`
+	Users        []string      `json:"users"`
+	PrimaryUsers []string      `json:"primaryUsers"`
+	GID          int           `json:"gid"`
+	IsSystem     bool          `json:"isSystem"`
+	Protected    bool          `json:"protected"`
+	Description  string        `json:"description,omitempty"`
+	Mapped       bool          `json:"mapped"`
+	Mapping      *GroupMapping `json:"mapping,omitempty"`
+}
+
+// CreateGroupRequest represents an optional group creation body
+type CreateGroupRequest struct {
+	Mapping     *GroupMappingRequest `json:"mapping"`
+	Description string               `json:"description"`
+}
+
+// GroupDescriptionRequest represents a request to set a group description
+type GroupDescriptionRequest struct {
+	Description string `json:"description"`
+}
+
+// GroupMembersRequest represents the full member list of a group
+type GroupMembersRequest struct {
+	Users []string `json:"users"`
+}
+
+// GroupMembersResponse reports how a group's member list changed
+type GroupMembersResponse struct {
+	Status  string   `json:"status"`
+	Message string   `json:"message,omitempty"`
+	Users   []string `json:"users"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
 }
 
 // GroupListResponse represents the response for group listing
@@ -36,21 +66,76 @@ func (h *APIHandler) GetGroups(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	json.NewEncoder(w).Encode(GroupListResponse{
-		Groups: groups,
-	})
+	// Groups are still listed when the mapping database can't be read
+	response := GroupListResponse{Groups: groups}
+	if err := attachGroupMappings(groups); err != nil {
+		response.Error = fmt.Sprintf("Group mappings unavailable: %v", err)
+	}
+
+	json.NewEncoder(w).Encode(response)
 }
 
 // CreateGroup creates a new Samba group
 func (h *APIHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)$`), r.URL.Path, 1)
 
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional and only needed to map the group
+	var req CreateGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateGroupDescription(req.Description); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var mapping GroupMapping
+	if req.Mapping != nil {
+		var err error
+		mapping, err = newGroupMapping(groupName, *req.Mapping)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	err := createSambaGroup(groupName)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	if req.Description != "" {
+		if err := setGroupDescription(groupName, req.Description); err != nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(APIResponse{
+				Status:  "warning",
+				Message: "Group created successfully",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	if req.Mapping != nil {
+		if err := createGroupMapping(mapping); err != nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(APIResponse{
+				Status:  "warning",
+				Message: "Group created successfully",
+				Error:   fmt.Sprintf("Group was not mapped: %v", err),
+			})
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
@@ -62,28 +147,62 @@ func (h *APIHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
 	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)$`), r.URL.Path, 1)
 
-	// Check if it's a system group
-	gid, err := getGroupGID(groupName)
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check that the group exists and is not protected
+	if _, err := getGroupGID(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := checkGroupModifiable(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// Refuse to break access silently; force removes the references first
+	impact, err := computeGroupImpact(groupName)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	if (gid < 1000 || gid == 65534) {
-		writeError(w, "Cannot delete system groups (GID < 1000)", http.StatusForbidden)
+	force := r.URL.Query().Get("force") == "true"
+	if len(impact.Blocking) > 0 || (len(impact.References) > 0 && !force) {
+		impact.Error = fmt.Sprintf("Group %s is still referenced", groupName)
+		if len(impact.Blocking) == 0 {
+			impact.Error += "; use force=true to remove the references"
+		}
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(impact)
 		return
 	}
 
+	if force {
+		if err := removeGroupReferences(impact); err != nil {
+			writeError(w, fmt.Sprintf("Failed to remove references to group %s: %v", groupName, err), http.StatusInternalServerError)
+			return
+		}
+	}
+
 	err = deleteSambaGroup(groupName)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	message := "Group deleted successfully"
+	if len(impact.References) > 0 {
+		message = fmt.Sprintf("%s, %d references removed", message, len(impact.References))
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
-		Message: "Group deleted successfully",
+		Message: message,
 	})
 }
 
@@ -92,6 +211,24 @@ func (h *APIHandler) AddUserToGroup(w http.ResponseWriter, r *http.Request) {
 	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`), r.URL.Path, 1)
 	userName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`), r.URL.Path, 2)
 
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateUsername(userName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, _, err := groupMembership(userName, groupName); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := checkMembershipModifiable(userName, groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	err := addUserToSambaGroup(userName, groupName)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
@@ -110,7 +247,34 @@ func (h *APIHandler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request)
 	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`), r.URL.Path, 1)
 	userName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`), r.URL.Path, 2)
 
-	err := removeUserFromSambaGroup(userName, groupName)
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := validateUsername(userName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	supplementary, primary, err := groupMembership(userName, groupName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err := checkMembershipModifiable(userName, groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if !supplementary {
+		if primary {
+			writeError(w, fmt.Sprintf("Group %s is the primary group of %s and can only be changed by changing the user's primary group", groupName, userName), http.StatusConflict)
+		} else {
+			writeError(w, fmt.Sprintf("User %s is not a member of group %s", userName, groupName), http.StatusNotFound)
+		}
+		return
+	}
+
+	err = removeUserFromSambaGroup(userName, groupName)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -123,74 +287,259 @@ func (h *APIHandler) RemoveUserFromGroup(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// getGroupGID gets the GID of a group
-func getGroupGID(groupName string) (int, error) {
-	cmd := exec.Command("getent", "group", groupName)
-	output, err := cmd.CombinedOutput()
+// SetGroupDescription sets the manager-side description of a group
+func (h *APIHandler) SetGroupDescription(w http.ResponseWriter, r *http.Request) {
+	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/description$`), r.URL.Path, 1)
+
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkGroupModifiable(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req GroupDescriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateGroupDescription(req.Description); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := getGroupGID(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if err := setGroupDescription(groupName, req.Description); err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Description of group %s updated successfully", groupName),
+	})
+}
+
+// SetGroupUsers replaces the member list of a group
+func (h *APIHandler) SetGroupUsers(w http.ResponseWriter, r *http.Request) {
+	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/users$`), r.URL.Path, 1)
+
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkGroupModifiable(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req GroupMembersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Users == nil {
+		writeError(w, "Invalid JSON format: a users list is required", http.StatusBadRequest)
+		return
+	}
+
+	group, err := getBackend().Accounts.LookupGroup(groupName)
 	if err != nil {
-		return 0, fmt.Errorf("Failed to get group info: %v", err)
+		writeError(w, fmt.Sprintf("Group %s does not exist", groupName), http.StatusNotFound)
+		return
+	}
+
+	// Check every user before changing anything
+	users, err := normalizeGroupMembers(req.Users)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Protected and system users can neither join nor leave the group
+	added := stringsNotIn(users, group.Members)
+	removed := stringsNotIn(group.Members, users)
+	for _, name := range append(append([]string{}, added...), removed...) {
+		if err := checkUserModifiable(name); err != nil {
+			writeError(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	if err := getBackend().Accounts.SetGroupMembers(groupName, users); err != nil {
+		writeError(w, fmt.Sprintf("Failed to set group members: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(GroupMembersResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Members of group %s updated successfully", groupName),
+		Users:   users,
+		Added:   added,
+		Removed: removed,
+	})
+}
+
+// normalizeGroupMembers validates and de-duplicates a member list, checking
+// that every user exists
+func normalizeGroupMembers(names []string) ([]string, error) {
+	seen := make(map[string]bool)
+	users := []string{}
+	for _, name := range names {
+		if err := validateUsername(name); err != nil {
+			return nil, err
+		}
+		if seen[name] {
+			continue
+		}
+		if _, err := getBackend().Accounts.LookupUser(name); err != nil {
+			return nil, fmt.Errorf("User %s does not exist", name)
+		}
+		seen[name] = true
+		users = append(users, name)
 	}
+	return users, nil
+}
 
-	parts := strings.Split(strings.TrimSpace(string(output)), ":")
-	if len(parts) < 3 {
-		return 0, fmt.Errorf("Unexpected output format for group info")
+// stringsNotIn returns the values of a that are not in b
+func stringsNotIn(a, b []string) []string {
+	in := make(map[string]bool)
+	for _, value := range b {
+		in[value] = true
 	}
+	result := []string{}
+	for _, value := range a {
+		if !in[value] {
+			result = append(result, value)
+		}
+	}
+	return result
+}
 
-	gid, err := strconv.Atoi(parts[2])
+// validateGroupDescription checks that a description is a single short line
+func validateGroupDescription(description string) error {
+	if len(description) > 256 || strings.ContainsAny(description, "\r\n") {
+		return fmt.Errorf("Descriptions are limited to a single line of 256 characters")
+	}
+	return nil
+}
+
+// setGroupDescription stores a group description, removing it when empty
+func setGroupDescription(groupName, description string) error {
+	err := updateGroupMetadata(func(metadata map[string]GroupMetadata) {
+		entry := metadata[groupName]
+		entry.Description = description
+		if entry == (GroupMetadata{}) {
+			delete(metadata, groupName)
+		} else {
+			metadata[groupName] = entry
+		}
+	})
 	if err != nil {
-		return 0, fmt.Errorf("Failed to parse GID: %v", err)
+		return fmt.Errorf("Failed to save group description: %v", err)
+	}
+	return nil
+}
+
+// groupMembership reports whether a user is a supplementary member of a group
+// and whether the group is the user's primary group
+func groupMembership(userName, groupName string) (supplementary, primary bool, err error) {
+	sys := getBackend()
+
+	group, err := sys.Accounts.LookupGroup(groupName)
+	if err != nil {
+		return false, false, fmt.Errorf("Group %s does not exist", groupName)
+	}
+	account, err := sys.Accounts.LookupUser(userName)
+	if err != nil {
+		return false, false, fmt.Errorf("User %s does not exist", userName)
+	}
+
+	for _, member := range group.Members {
+		if member == userName {
+			supplementary = true
+			break
+		}
 	}
 
-	return gid, nil
+	return supplementary, account.GID == group.GID, nil
+}
+
+// getGroupGID gets the GID of a group
+func getGroupGID(groupName string) (int, error) {
+	if err := validateGroupName(groupName); err != nil {
+		return 0, err
+	}
+
+	group, err := getBackend().Accounts.LookupGroup(groupName)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to get group info: %v", err)
+	}
+
+	return group.GID, nil
 }
 
 // getSambaGroups returns a list of all Samba groups
 func getSambaGroups(includeSystem bool) ([]Group, error) {
 	// Get all groups from system
-	cmd := exec.Command("getent", "group")
-	output, err := cmd.CombinedOutput()
+	entries, err := getBackend().Accounts.ListGroups()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to list groups: %v", err)
 	}
 
-	// Parse the output
+	// Index accounts by primary group
+	primaryUsers := make(map[int][]string)
+	accounts, err := getBackend().Accounts.ListUsers()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list users: %v", err)
+	}
+	for _, account := range accounts {
+		primaryUsers[account.GID] = append(primaryUsers[account.GID], account.Name)
+	}
+
+	// Descriptions are optional, a missing or unreadable store is not fatal
+	metadata, err := loadGroupMetadata()
+	if err != nil {
+		log.Printf("Failed to load group metadata: %v", err)
+	}
+
+	policy := GetAccountPolicy()
+
 	var groups []Group
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
-		parts := strings.Split(line, ":")
-		if len(parts) >= 4 {
-			groupName := parts[0]
-
-			// Parse GID
-			gid, err := strconv.Atoi(parts[2])
-			if err != nil {
-				continue // Skip if GID can't be parsed
-			}
-
-			// Check if it's a system group
-			isSystem := (gid < 1000 || gid == 65534)
-
-			// Skip system groups if not included
-			if isSystem && !includeSystem {
-				continue
-			}
-
-			// Get user list (last field is comma-separated list of users)
-			users := []string{}
-			userList := parts[3]
-			if userList != "" {
-				users = strings.Split(userList, ",")
-			}
-
-			group := Group{
-				Name:     groupName,
-				Users:    users,
-				GID:      gid,
-				IsSystem: isSystem,
-			}
-			groups = append(groups, group)
+	for _, entry := range entries {
+		// Check if it's a system group
+		isSystem := policy.IsSystemGID(entry.GID)
+
+		// Skip system groups if not included
+		if isSystem && !includeSystem {
+			continue
+		}
+
+		users := entry.Members
+		if users == nil {
+			users = []string{}
 		}
+
+		primary := primaryUsers[entry.GID]
+		if primary == nil {
+			primary = []string{}
+		}
+
+		group := Group{
+			Name:         entry.Name,
+			Users:        users,
+			PrimaryUsers: primary,
+			GID:          entry.GID,
+			IsSystem:     isSystem,
+			Protected:    policy.IsProtectedGroup(entry.Name),
+			Description:  metadata[entry.Name].Description,
+		}
+		groups = append(groups, group)
 	}
 
 	return groups, nil
@@ -198,9 +547,12 @@ func getSambaGroups(includeSystem bool) ([]Group, error) {
 
 // createSambaGroup creates a new Samba group
 func createSambaGroup(groupName string) error {
+	if err := validateGroupName(groupName); err != nil {
+		return err
+	}
+
 	// Create the group
-	cmd := exec.Command("groupadd", groupName)
-	err := cmd.Run()
+	err := getBackend().Accounts.CreateGroup(groupName)
 	if err != nil {
 		return fmt.Errorf("Failed to create group: %v", err)
 	}
@@ -210,31 +562,50 @@ func createSambaGroup(groupName string) error {
 
 // deleteSambaGroup deletes a Samba group
 func deleteSambaGroup(groupName string) error {
-	// Check if it's a system group
-	gid, err := getGroupGID(groupName)
-	if err != nil {
+	// Check that the group exists and is not protected
+	if _, err := getGroupGID(groupName); err != nil {
+		return err
+	}
+
+	if err := checkGroupModifiable(groupName); err != nil {
 		return err
 	}
 
-	if (gid < 1000 || gid == 65534) {
-		return fmt.Errorf("Cannot delete system groups (GID < 1000)")
+	// Remove the mapping first so it never points at a missing group
+	mapping, err := findGroupMapping(groupName)
+	if err != nil {
+		return err
+	}
+	if mapping != nil {
+		if err := getBackend().GroupMap.DeleteMapping(mapping.NTName); err != nil {
+			return fmt.Errorf("Failed to delete group mapping: %v", err)
+		}
 	}
 
 	// Delete the group
-	cmd := exec.Command("groupdel", groupName)
-	err = cmd.Run()
+	err = getBackend().Accounts.DeleteGroup(groupName)
 	if err != nil {
 		return fmt.Errorf("Failed to delete group: %v", err)
 	}
 
+	if err := setGroupDescription(groupName, ""); err != nil {
+		log.Printf("Failed to remove metadata of group %s: %v", groupName, err)
+	}
+
 	return nil
 }
 
 // addUserToSambaGroup adds a user to a group
 func addUserToSambaGroup(userName, groupName string) error {
+	if err := validateUsername(userName); err != nil {
+		return err
+	}
+	if err := validateGroupName(groupName); err != nil {
+		return err
+	}
+
 	// Add user to group
-	cmd := exec.Command("usermod", "-a", "-G", groupName, userName)
-	err := cmd.Run()
+	err := getBackend().Accounts.AddGroupMember(groupName, userName)
 	if err != nil {
 		return fmt.Errorf("Failed to add user to group: %v", err)
 	}
@@ -244,37 +615,14 @@ func addUserToSambaGroup(userName, groupName string) error {
 
 // removeUserFromSambaGroup removes a user from a group
 func removeUserFromSambaGroup(userName, groupName string) error {
-	// Get all groups for user
-	cmd := exec.Command("groups", userName)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Failed to get user groups: %v", err)
-	}
-
-	// Parse output to get current groups
-	outputStr := strings.TrimSpace(string(output))
-	groupsStr := strings.Split(outputStr, ":")
-	if len(groupsStr) < 2 {
-		return fmt.Errorf("Unexpected output from groups command: %s", outputStr)
+	if err := validateUsername(userName); err != nil {
+		return err
 	}
-
-	groupsList := strings.Split(strings.TrimSpace(groupsStr[1]), " ")
-	var newGroups []string
-	for _, g := range groupsList {
-		g = strings.TrimSpace(g)
-		if g != "" && g != groupName {
-			newGroups = append(newGroups, g)
-		}
+	if err := validateGroupName(groupName); err != nil {
+		return err
 	}
 
-	// Set new groups for user (removing the specified group)
-	if len(newGroups) > 0 {
-		cmd = exec.Command("usermod", "-G", strings.Join(newGroups, ","), userName)
-	} else {
-		// If user has no groups, set empty groups
-		cmd = exec.Command("usermod", "-G", "", userName)
-	}
-	err = cmd.Run()
+	err := getBackend().Accounts.RemoveGroupMember(groupName, userName)
 	if err != nil {
 		return fmt.Errorf("Failed to remove user from group: %v", err)
 	}
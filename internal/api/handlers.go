@@ -20,12 +20,15 @@ type APIResponse struct {
 	Status  string `json:"status,omitempty"`
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
+	Action  string `json:"action,omitempty"`
+	Queued  bool   `json:"queued,omitempty"`
 }
 
 // UserListResponse represents the response for user listing
 type UserListResponse struct {
-	Users []string `json:"users"`
-	Error string   `json:"error,omitempty"`
+	Users    []string   `json:"users"`
+	Accounts []UserInfo `json:"accounts"`
+	Error    string     `json:"error,omitempty"`
 }
 
 // ServiceStatusResponse represents the Samba service status
@@ -35,6 +38,9 @@ type ServiceStatusResponse struct {
 	Status   string                 `json:"status"`
 	Metadata map[string]interface{} `json:"metadata,omitempty"`
 	Error    string                 `json:"error,omitempty"`
+
+	PendingAction *PendingServiceAction `json:"pendingAction,omitempty"`
+	LastAction    *ServiceActionResult  `json:"lastAction,omitempty"`
 }
 
 // PasswordRequest represents a password change request
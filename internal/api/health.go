@@ -0,0 +1,262 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Results of a health check
+const (
+	HealthPass = "pass"
+	HealthWarn = "warn"
+	HealthFail = "fail"
+)
+
+// Time limits of the probes, which run in parallel and stay well below the
+// server's write timeout so that a hung smbd is reported instead of dropping
+// the request
+const (
+	healthDialTimeout    = 2 * time.Second
+	healthCommandTimeout = 5 * time.Second
+)
+
+// defaultSMBPorts are the ports smbd listens on without "smb ports"
+var defaultSMBPorts = []int{445, 139}
+
+// HealthCheck is the result of one probe
+type HealthCheck struct {
+	Name      string   `json:"name"`
+	Target    string   `json:"target,omitempty"`
+	Status    string   `json:"status"`
+	Message   string   `json:"message"`
+	Details   []string `json:"details,omitempty"`
+	LatencyMs float64  `json:"latencyMs"`
+}
+
+// HealthReport combines the probes into an overall status
+type HealthReport struct {
+	Status    string        `json:"status"`
+	Healthy   bool          `json:"healthy"`
+	Checks    []HealthCheck `json:"checks"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// GetHealth probes smbd beyond its service state. It answers 503 when a
+// check fails so monitoring systems can use the status code alone.
+func (h *APIHandler) GetHealth(w http.ResponseWriter, r *http.Request) {
+	report := runHealthChecks()
+	if !report.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
+
+// runHealthChecks runs every probe concurrently and keeps their order
+func runHealthChecks() HealthReport {
+	probes := getBackend().Health
+
+	global := map[string]string{}
+	if config, err := ReadConfig(); err == nil {
+		global = lowerParams(config["global"])
+	}
+
+	checks := []func() HealthCheck{checkSmbdActive, checkTestparm}
+
+	addresses, err := healthProbeAddresses(global, probes)
+	if err != nil {
+		checks = append(checks, func() HealthCheck {
+			return HealthCheck{Name: "listen", Status: HealthFail, Message: err.Error()}
+		})
+	}
+	for _, address := range addresses {
+		for _, port := range smbPorts(global) {
+			target := net.JoinHostPort(address, strconv.Itoa(port))
+			checks = append(checks, func() HealthCheck {
+				return checkListening(probes, target)
+			})
+		}
+	}
+
+	// Bound to specific interfaces, smbd may not answer on the loopback address
+	host := "127.0.0.1"
+	if len(addresses) > 0 {
+		host = addresses[0]
+	}
+	checks = append(checks, func() HealthCheck {
+		return checkShareListing(probes, host)
+	})
+
+	results := make([]HealthCheck, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func() HealthCheck) {
+			defer wg.Done()
+			start := time.Now()
+			results[i] = check()
+			results[i].LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := HealthReport{Status: HealthPass, Checks: results, CheckedAt: time.Now()}
+	for _, result := range results {
+		if result.Status == HealthFail {
+			report.Status = HealthFail
+			break
+		}
+		if result.Status == HealthWarn {
+			report.Status = HealthWarn
+		}
+	}
+	report.Healthy = report.Status != HealthFail
+
+	return report
+}
+
+// checkSmbdActive checks the service manager state of smbd
+func checkSmbdActive() HealthCheck {
+	smbd, _ := findSambaUnit("smbd")
+	unit, installed := resolveUnit(smbd)
+	check := HealthCheck{Name: "service", Target: unit}
+	if !installed {
+		check.Target = smbd.Name
+		check.Status, check.Message = HealthFail, "smbd is not installed"
+		return check
+	}
+
+	active, err := getBackend().Services.IsActive(unit)
+	switch {
+	case err != nil:
+		check.Status, check.Message = HealthFail, fmt.Sprintf("Failed to query %s: %v", unit, err)
+	case !active:
+		check.Status, check.Message = HealthFail, fmt.Sprintf("%s is not running", unit)
+	default:
+		check.Status, check.Message = HealthPass, fmt.Sprintf("%s is running", unit)
+	}
+	return check
+}
+
+// checkTestparm checks that smb.conf loads without warnings
+func checkTestparm() HealthCheck {
+	check := HealthCheck{Name: "config", Target: "testparm"}
+
+	warnings, err := getBackend().Health.Testparm(GetConfigPath())
+	check.Details = warnings
+	switch {
+	case err != nil:
+		check.Status, check.Message = HealthFail, fmt.Sprintf("smb.conf does not load: %v", err)
+	case len(warnings) > 0:
+		check.Status, check.Message = HealthWarn, fmt.Sprintf("smb.conf loads with %d warnings", len(warnings))
+	default:
+		check.Status, check.Message = HealthPass, "smb.conf loads without warnings"
+	}
+	return check
+}
+
+// checkListening checks that a TCP port accepts connections
+func checkListening(probes HealthProber, address string) HealthCheck {
+	check := HealthCheck{Name: "listen", Target: address}
+	if err := probes.Dial(address, healthDialTimeout); err != nil {
+		check.Status, check.Message = HealthFail, fmt.Sprintf("Not accepting connections: %v", err)
+		return check
+	}
+	check.Status, check.Message = HealthPass, "Accepting connections"
+	return check
+}
+
+// checkShareListing checks that a client can negotiate SMB and list shares.
+// A refused anonymous listing still proves that negotiation works.
+func checkShareListing(probes HealthProber, host string) HealthCheck {
+	check := HealthCheck{Name: "smb", Target: host}
+
+	err := probes.ListShares(host)
+
+	// smbclient is a separate package that servers often lack, negotiating
+	// natively still proves that smbd answers
+	if errors.Is(err, exec.ErrNotFound) {
+		dialect, err := probes.NegotiateSMB2(net.JoinHostPort(host, "445"), healthCommandTimeout)
+		if err != nil {
+			check.Status, check.Message = HealthFail, fmt.Sprintf("SMB2 negotiation failed: %v", err)
+		} else {
+			check.Status, check.Message = HealthPass, fmt.Sprintf("SMB2 negotiation succeeded with dialect %s (smbclient not installed, shares not listed)", dialect)
+		}
+		return check
+	}
+
+	switch {
+	case err == nil:
+		check.Status, check.Message = HealthPass, "Anonymous share listing succeeded"
+	case strings.Contains(err.Error(), "NT_STATUS_ACCESS_DENIED") || strings.Contains(err.Error(), "NT_STATUS_LOGON_FAILURE"):
+		check.Status, check.Message = HealthWarn, "SMB negotiation succeeded but anonymous share listing was refused"
+	default:
+		check.Status, check.Message = HealthFail, fmt.Sprintf("Failed to list shares: %v", err)
+	}
+	return check
+}
+
+// healthProbeAddresses returns the addresses smbd should listen on: the
+// configured interfaces with "bind interfaces only", otherwise localhost
+func healthProbeAddresses(global map[string]string, probes HealthProber) ([]string, error) {
+	interfaces := strings.TrimSpace(global["interfaces"])
+	if !parseSambaBool(global["bind interfaces only"], false) || interfaces == "" {
+		return []string{"127.0.0.1"}, nil
+	}
+
+	seen := make(map[string]bool)
+	var addresses []string
+	add := func(address string) {
+		if !seen[address] {
+			seen[address] = true
+			addresses = append(addresses, address)
+		}
+	}
+
+	for _, token := range strings.FieldsFunc(interfaces, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	}) {
+		// Entries look like eth0, 10.0.0.5/24 or eth0;speed=1000000000
+		token = strings.SplitN(token, ";", 2)[0]
+		name := strings.SplitN(token, "/", 2)[0]
+		if ip := net.ParseIP(name); ip != nil {
+			add(ip.String())
+			continue
+		}
+		ifaceAddrs, err := probes.InterfaceAddrs(name)
+		if err != nil {
+			continue
+		}
+		for _, address := range ifaceAddrs {
+			add(address)
+		}
+	}
+
+	if len(addresses) == 0 {
+		return nil, fmt.Errorf("No address found for interfaces %s", interfaces)
+	}
+	return addresses, nil
+}
+
+// smbPorts returns the ports of "smb ports"
+func smbPorts(global map[string]string) []int {
+	var ports []int
+	for _, field := range strings.FieldsFunc(global["smb ports"], func(r rune) bool {
+		return r == ' ' || r == '\t' || r == ','
+	}) {
+		if port, err := strconv.Atoi(field); err == nil && port > 0 && port < 65536 {
+			ports = append(ports, port)
+		}
+	}
+	if len(ports) == 0 {
+		return defaultSMBPorts
+	}
+	return ports
+}
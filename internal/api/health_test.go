@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os/exec"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// healthTargets maps each check of a report to its status
+func healthTargets(report HealthReport) map[string]string {
+	targets := make(map[string]string)
+	for _, check := range report.Checks {
+		targets[check.Name+" "+check.Target] = check.Status
+	}
+	return targets
+}
+
+func TestHealthFailsWhenPortIsClosed(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Refused["127.0.0.1:445"] = true
+
+	rec := serve(h, http.MethodGet, "/health", "")
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	var report HealthReport
+	decode(t, rec, &report)
+	targets := healthTargets(report)
+	if report.Healthy || targets["listen 127.0.0.1:445"] != HealthFail || targets["listen 127.0.0.1:139"] != HealthPass {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestHealthWarnings(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Warnings = []string{"WARNING: The 'netbios name' is too long (max. 15 chars)."}
+	fake.ListErr = errors.New("smbclient failed (exit 1): session setup failed: NT_STATUS_ACCESS_DENIED")
+
+	rec := serve(h, http.MethodGet, "/health", "")
+	var report HealthReport
+	decode(t, rec, &report)
+	targets := healthTargets(report)
+	if rec.Code != http.StatusOK || report.Status != HealthWarn || targets["config testparm"] != HealthWarn || targets["smb 127.0.0.1"] != HealthWarn {
+		t.Errorf("status = %d, report = %+v", rec.Code, report)
+	}
+
+	delete(fake.Services, "smbd")
+	decode(t, serve(h, http.MethodGet, "/health", ""), &report)
+	if report.Status != HealthFail || healthTargets(report)["service smbd"] != HealthFail {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestHealthProbeAddresses(t *testing.T) {
+	fake := NewFakeSystem()
+	fake.NICs["eth0"] = []string{"10.0.0.5", "fd00::5"}
+	fake.NICs["eth1"] = []string{"10.1.0.5"}
+	probes := fake.Backend().Health
+
+	tests := []struct {
+		global map[string]string
+		want   []string
+	}{
+		{map[string]string{"interfaces": "eth0"}, []string{"127.0.0.1"}},
+		{map[string]string{"interfaces": "lo eth*;speed=1000, 192.168.1.10/24", "bind interfaces only": "yes"},
+			[]string{"127.0.0.1", "10.0.0.5", "10.1.0.5", "fd00::5", "192.168.1.10"}},
+	}
+	for _, tt := range tests {
+		got, err := healthProbeAddresses(tt.global, probes)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("healthProbeAddresses(%v) = %v, %v; want %v", tt.global, got, err, tt.want)
+		}
+	}
+
+	if _, err := healthProbeAddresses(map[string]string{"interfaces": "wlan0", "bind interfaces only": "yes"}, probes); err == nil {
+		t.Error("expected an error for an unknown interface")
+	}
+	if ports := smbPorts(map[string]string{"smb ports": "445"}); !reflect.DeepEqual(ports, []int{445}) {
+		t.Errorf("smbPorts = %v", ports)
+	}
+}
+
+func TestHealthTestparmChecksConfiguredFile(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	var report HealthReport
+	decode(t, serve(h, http.MethodGet, "/health", ""), &report)
+	if targets := healthTargets(report); targets["config testparm"] != HealthPass {
+		t.Fatalf("report = %+v", report)
+	}
+
+	SetConfigPath(GetConfigPath() + ".missing")
+	decode(t, serve(h, http.MethodGet, "/health", ""), &report)
+	if targets := healthTargets(report); targets["config testparm"] != HealthFail {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestHealthNegotiatesWithoutSmbclient(t *testing.T) {
+	fake, h := newTestAPI(t)
+	_, fake.ListErr = execute(commandSpec{Name: "samba-manager-missing-smbclient"})
+	if !errors.Is(fake.ListErr, exec.ErrNotFound) {
+		t.Fatalf("missing binary error = %v", fake.ListErr)
+	}
+
+	rec := serve(h, http.MethodGet, "/health", "")
+	var report HealthReport
+	decode(t, rec, &report)
+	if rec.Code != http.StatusOK || healthTargets(report)["smb 127.0.0.1"] != HealthPass {
+		t.Fatalf("status = %d, report = %+v", rec.Code, report)
+	}
+
+	fake.Refused["127.0.0.1:445"] = true
+	decode(t, serve(h, http.MethodGet, "/health", ""), &report)
+	if healthTargets(report)["smb 127.0.0.1"] != HealthFail {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestSMB2NegotiateAgainstServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var frame [4]byte
+		io.ReadFull(conn, frame[:])
+		request := make([]byte, int(frame[1])<<16|int(frame[2])<<8|int(frame[3]))
+		io.ReadFull(conn, request)
+		if binary.LittleEndian.Uint16(request[64+2:]) != uint16(len(smb2Dialects)) {
+			return
+		}
+
+		// Answer with the header of the request and dialect 3.0.2
+		response := append(append([]byte{}, request[:64]...), make([]byte, 65)...)
+		binary.LittleEndian.PutUint16(response[64:], 65)
+		binary.LittleEndian.PutUint16(response[64+4:], 0x0302)
+		conn.Write(append([]byte{0, 0, 0, byte(len(response))}, response...))
+	}()
+
+	dialect, err := systemProbes{}.NegotiateSMB2(listener.Addr().String(), time.Second)
+	if err != nil || dialect != "3.0.2" {
+		t.Errorf("dialect = %q, err = %v", dialect, err)
+	}
+}
@@ -0,0 +1,497 @@
+package api
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Buckets of the history database
+var (
+	historySamplesBucket = []byte("samples")
+	historyClientsBucket = []byte("clients")
+)
+
+// Time ranges accepted by the history queries
+const (
+	defaultHistoryDays = 7
+	maxHistoryDays     = 366
+)
+
+// HistoryConnection is a share connection seen in a sample
+type HistoryConnection struct {
+	Share  string `json:"share"`
+	User   string `json:"user"`
+	Client string `json:"client"`
+}
+
+// HistorySample is one snapshot of the connected users and shares
+type HistorySample struct {
+	Time        time.Time           `json:"time"`
+	Sessions    int                 `json:"sessions"`
+	Users       []string            `json:"users"`
+	Connections []HistoryConnection `json:"connections"`
+}
+
+// ClientSeen summarizes every sample a client address appeared in
+type ClientSeen struct {
+	Client    string    `json:"client"`
+	Users     []string  `json:"users"`
+	Shares    []string  `json:"shares"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// ShareVisitor is a user seen connected to a share
+type ShareVisitor struct {
+	User      string    `json:"user"`
+	Clients   []string  `json:"clients"`
+	FirstSeen time.Time `json:"firstSeen"`
+	LastSeen  time.Time `json:"lastSeen"`
+}
+
+// ShareHistoryResponse represents the response for a share's visitors
+type ShareHistoryResponse struct {
+	Share    string         `json:"share"`
+	Since    time.Time      `json:"since"`
+	Visitors []ShareVisitor `json:"visitors"`
+}
+
+// PeakUsage is the sample with the most concurrent users of a period
+type PeakUsage struct {
+	Date     string    `json:"date,omitempty"`
+	Time     time.Time `json:"time"`
+	Users    int       `json:"users"`
+	Sessions int       `json:"sessions"`
+}
+
+// PeakUsageResponse represents the response for peak concurrent users
+type PeakUsageResponse struct {
+	Since time.Time   `json:"since"`
+	Peak  *PeakUsage  `json:"peak"`
+	Daily []PeakUsage `json:"daily"`
+}
+
+// ClientHistoryResponse represents the response for client last-seen times
+type ClientHistoryResponse struct {
+	Clients []ClientSeen `json:"clients"`
+}
+
+var (
+	historyDB     *bolt.DB
+	historyDBPath string
+	historyMu     sync.Mutex
+)
+
+// StartHistoryCollector samples sessions and share connections every
+// interval and forgets samples and clients older than retention
+func StartHistoryCollector(interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		now := time.Now()
+		for {
+			if err := collectHistorySample(now, retention); err != nil {
+				log.Printf("Failed to record session history: %v", err)
+			}
+			now = <-ticker.C
+		}
+	}()
+}
+
+// GetShareHistory lists who connected to a share in the last ?days=
+func (h *APIHandler) GetShareHistory(w http.ResponseWriter, r *http.Request) {
+	share := getRouteParam(regexp.MustCompile(`^/history/shares/([^/]+)$`), r.URL.Path, 1)
+
+	since, err := historySince(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	visitors, err := shareVisitors(share, since)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(ShareHistoryResponse{Share: share, Since: since, Visitors: visitors})
+}
+
+// GetPeakUsage reports the peak concurrent users overall and per day
+func (h *APIHandler) GetPeakUsage(w http.ResponseWriter, r *http.Request) {
+	since, err := historySince(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response, err := peakUsage(since)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetClientHistory lists every client address with its last-seen time,
+// most recent first, optionally limited to the last ?days=
+func (h *APIHandler) GetClientHistory(w http.ResponseWriter, r *http.Request) {
+	days, err := queryInt(r, "days", 0, 0, maxHistoryDays)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clients, err := seenClients()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if days > 0 {
+		since := time.Now().AddDate(0, 0, -days)
+		recent := []ClientSeen{}
+		for _, client := range clients {
+			if !client.LastSeen.Before(since) {
+				recent = append(recent, client)
+			}
+		}
+		clients = recent
+	}
+
+	json.NewEncoder(w).Encode(ClientHistoryResponse{Clients: clients})
+}
+
+// historySince reads the ?days= range of a query
+func historySince(r *http.Request) (time.Time, error) {
+	days, err := queryInt(r, "days", defaultHistoryDays, 1, maxHistoryDays)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Now().AddDate(0, 0, -days), nil
+}
+
+// collectHistorySample records the current clients
+func collectHistorySample(now time.Time, retention time.Duration) error {
+	status, err := getClientStatus()
+	if err != nil {
+		return fmt.Errorf("Failed to read client status: %v", err)
+	}
+	return recordHistorySample(status, now, retention)
+}
+
+// recordHistorySample stores a sample, updates the clients it names and
+// prunes entries older than retention. Samples without clients aren't stored.
+func recordHistorySample(status SambaStatus, now time.Time, retention time.Duration) error {
+	sample := HistorySample{Time: now.UTC(), Sessions: len(status.Sessions), Users: []string{}, Connections: []HistoryConnection{}}
+
+	clientsByPID := make(map[string]string)
+	users := make(map[string]bool)
+	seen := make(map[string]*ClientSeen)
+	see := func(client string) *ClientSeen {
+		if seen[client] == nil {
+			seen[client] = &ClientSeen{Client: client}
+		}
+		return seen[client]
+	}
+
+	for _, session := range status.Sessions {
+		clientsByPID[session.PID] = session.ClientIP
+		if session.User != "" && !users[session.User] {
+			users[session.User] = true
+			sample.Users = append(sample.Users, session.User)
+		}
+		if session.ClientIP != "" {
+			client := see(session.ClientIP)
+			client.Users = appendUnique(client.Users, session.User)
+		}
+	}
+	sort.Strings(sample.Users)
+
+	for _, tcon := range status.Connections {
+		client := tcon.ClientIP
+		if client == "" {
+			client = clientsByPID[tcon.PID]
+		}
+		sample.Connections = append(sample.Connections, HistoryConnection{Share: tcon.Share, User: tcon.User, Client: client})
+		if client != "" {
+			seenClient := see(client)
+			seenClient.Users = appendUnique(seenClient.Users, tcon.User)
+			seenClient.Shares = appendUnique(seenClient.Shares, tcon.Share)
+		}
+	}
+
+	cutoff := now.Add(-retention)
+
+	return withHistoryDB(func(db *bolt.DB) error {
+		return db.Update(func(tx *bolt.Tx) error {
+			samples := tx.Bucket(historySamplesBucket)
+			clients := tx.Bucket(historyClientsBucket)
+
+			if sample.Sessions > 0 || len(sample.Connections) > 0 {
+				data, err := json.Marshal(sample)
+				if err != nil {
+					return err
+				}
+				if err := samples.Put(historyKey(now), data); err != nil {
+					return err
+				}
+			}
+
+			for address, update := range seen {
+				client := ClientSeen{Client: address, Users: []string{}, Shares: []string{}, FirstSeen: sample.Time}
+				if data := clients.Get([]byte(address)); data != nil {
+					json.Unmarshal(data, &client)
+				}
+				for _, user := range update.Users {
+					client.Users = appendUnique(client.Users, user)
+				}
+				for _, share := range update.Shares {
+					client.Shares = appendUnique(client.Shares, share)
+				}
+				sort.Strings(client.Users)
+				sort.Strings(client.Shares)
+				client.LastSeen = sample.Time
+
+				data, err := json.Marshal(client)
+				if err != nil {
+					return err
+				}
+				if err := clients.Put([]byte(address), data); err != nil {
+					return err
+				}
+			}
+
+			if retention <= 0 {
+				return nil
+			}
+			return pruneHistory(samples, clients, cutoff)
+		})
+	})
+}
+
+// pruneHistory deletes samples and clients last seen before cutoff
+func pruneHistory(samples, clients *bolt.Bucket, cutoff time.Time) error {
+	var expired [][]byte
+	limit := historyKey(cutoff)
+	cursor := samples.Cursor()
+	for key, _ := cursor.First(); key != nil && bytes.Compare(key, limit) < 0; key, _ = cursor.Next() {
+		expired = append(expired, key)
+	}
+	for _, key := range expired {
+		if err := samples.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	expired = nil
+	err := clients.ForEach(func(key, data []byte) error {
+		var client ClientSeen
+		if json.Unmarshal(data, &client) == nil && client.LastSeen.Before(cutoff) {
+			expired = append(expired, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := clients.Delete(key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// forEachSample calls fn for every sample taken since a time, oldest first
+func forEachSample(since time.Time, fn func(sample HistorySample)) error {
+	return withHistoryDB(func(db *bolt.DB) error {
+		return db.View(func(tx *bolt.Tx) error {
+			cursor := tx.Bucket(historySamplesBucket).Cursor()
+			for key, data := cursor.Seek(historyKey(since)); key != nil; key, data = cursor.Next() {
+				var sample HistorySample
+				if err := json.Unmarshal(data, &sample); err != nil {
+					continue
+				}
+				fn(sample)
+			}
+			return nil
+		})
+	})
+}
+
+// shareVisitors lists the users connected to a share since a time, most
+// recently seen first
+func shareVisitors(share string, since time.Time) ([]ShareVisitor, error) {
+	byUser := make(map[string]*ShareVisitor)
+	err := forEachSample(since, func(sample HistorySample) {
+		for _, tcon := range sample.Connections {
+			if !strings.EqualFold(tcon.Share, share) {
+				continue
+			}
+			visitor := byUser[tcon.User]
+			if visitor == nil {
+				visitor = &ShareVisitor{User: tcon.User, Clients: []string{}, FirstSeen: sample.Time}
+				byUser[tcon.User] = visitor
+			}
+			visitor.LastSeen = sample.Time
+			if tcon.Client != "" {
+				visitor.Clients = appendUnique(visitor.Clients, tcon.Client)
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	visitors := []ShareVisitor{}
+	for _, visitor := range byUser {
+		sort.Strings(visitor.Clients)
+		visitors = append(visitors, *visitor)
+	}
+	sort.Slice(visitors, func(i, j int) bool {
+		if !visitors[i].LastSeen.Equal(visitors[j].LastSeen) {
+			return visitors[i].LastSeen.After(visitors[j].LastSeen)
+		}
+		return visitors[i].User < visitors[j].User
+	})
+
+	return visitors, nil
+}
+
+// peakUsage finds the samples with the most concurrent users since a time,
+// overall and per local day
+func peakUsage(since time.Time) (PeakUsageResponse, error) {
+	response := PeakUsageResponse{Since: since, Daily: []PeakUsage{}}
+
+	err := forEachSample(since, func(sample HistorySample) {
+		usage := PeakUsage{
+			Date:     sample.Time.Local().Format("2006-01-02"),
+			Time:     sample.Time,
+			Users:    len(sample.Users),
+			Sessions: sample.Sessions,
+		}
+
+		// Samples arrive in time order, so a new day starts a new entry
+		last := len(response.Daily) - 1
+		if last < 0 || response.Daily[last].Date != usage.Date {
+			response.Daily = append(response.Daily, usage)
+		} else if usage.Users > response.Daily[last].Users {
+			response.Daily[last] = usage
+		}
+
+		if response.Peak == nil || usage.Users > response.Peak.Users {
+			peak := usage
+			peak.Date = ""
+			response.Peak = &peak
+		}
+	})
+
+	return response, err
+}
+
+// seenClients returns every known client, most recently seen first
+func seenClients() ([]ClientSeen, error) {
+	clients := []ClientSeen{}
+	err := withHistoryDB(func(db *bolt.DB) error {
+		return db.View(func(tx *bolt.Tx) error {
+			return tx.Bucket(historyClientsBucket).ForEach(func(key, data []byte) error {
+				var client ClientSeen
+				if err := json.Unmarshal(data, &client); err == nil {
+					clients = append(clients, client)
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].LastSeen.Equal(clients[j].LastSeen) {
+			return clients[i].LastSeen.After(clients[j].LastSeen)
+		}
+		return clients[i].Client < clients[j].Client
+	})
+	return clients, nil
+}
+
+// withHistoryDB runs fn with the history database of the current data
+// directory, opening it on first use
+func withHistoryDB(fn func(db *bolt.DB) error) error {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	path := filepath.Join(GetDataDir(), "history.db")
+	if historyDB != nil && historyDBPath != path {
+		historyDB.Close()
+		historyDB = nil
+	}
+
+	if historyDB == nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+			return fmt.Errorf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		db, err := bolt.Open(path, 0640, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			return fmt.Errorf("Failed to open history database %s: %v", path, err)
+		}
+		err = db.Update(func(tx *bolt.Tx) error {
+			for _, bucket := range [][]byte{historySamplesBucket, historyClientsBucket} {
+				if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			db.Close()
+			return fmt.Errorf("Failed to initialize history database: %v", err)
+		}
+		historyDB, historyDBPath = db, path
+	}
+
+	return fn(historyDB)
+}
+
+// closeHistoryDB closes the history database if it is open
+func closeHistoryDB() {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	if historyDB != nil {
+		historyDB.Close()
+		historyDB = nil
+	}
+}
+
+// historyKey orders samples by time
+func historyKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
+
+// appendUnique appends a non-empty value that isn't in list yet
+func appendUnique(list []string, value string) []string {
+	if value == "" || containsString(list, value) {
+		return list
+	}
+	return append(list, value)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// historyStatus builds a client snapshot of users connected to shares
+func historyStatus(connections ...TreeConnect) SambaStatus {
+	var status SambaStatus
+	for _, tcon := range connections {
+		status.Sessions = append(status.Sessions, SambaSession{PID: tcon.PID, User: tcon.User, ClientIP: tcon.ClientIP})
+		status.Connections = append(status.Connections, tcon)
+	}
+	return status
+}
+
+func TestSessionHistory(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	now := time.Now()
+	samples := []struct {
+		at     time.Time
+		status SambaStatus
+	}{
+		{now.AddDate(0, 0, -30), historyStatus(TreeConnect{Share: "public", PID: "1", User: "carol", ClientIP: "10.0.0.3"})},
+		{now.Add(-48 * time.Hour), historyStatus(TreeConnect{Share: "public", PID: "2", User: "alice", ClientIP: "10.0.0.1"})},
+		{now.Add(-47 * time.Hour), historyStatus(
+			TreeConnect{Share: "public", PID: "2", User: "alice", ClientIP: "10.0.0.1"},
+			TreeConnect{Share: "private", PID: "3", User: "bob", ClientIP: "10.0.0.2"},
+		)},
+		{now.Add(-time.Hour), historyStatus(TreeConnect{Share: "public", PID: "4", User: "alice", ClientIP: "10.0.0.4"})},
+		{now, SambaStatus{}},
+	}
+	for _, sample := range samples {
+		if err := recordHistorySample(sample.status, sample.at, 0); err != nil {
+			t.Fatalf("record sample: %v", err)
+		}
+	}
+
+	var shares ShareHistoryResponse
+	decode(t, serve(h, http.MethodGet, "/history/shares/public?days=7", ""), &shares)
+	if len(shares.Visitors) != 1 || shares.Visitors[0].User != "alice" ||
+		!reflect.DeepEqual(shares.Visitors[0].Clients, []string{"10.0.0.1", "10.0.0.4"}) {
+		t.Errorf("visitors = %+v", shares.Visitors)
+	}
+	decode(t, serve(h, http.MethodGet, "/history/shares/public?days=60", ""), &shares)
+	if len(shares.Visitors) != 2 || shares.Visitors[1].User != "carol" {
+		t.Errorf("visitors = %+v", shares.Visitors)
+	}
+
+	var peak PeakUsageResponse
+	decode(t, serve(h, http.MethodGet, "/history/peak", ""), &peak)
+	if peak.Peak == nil || peak.Peak.Users != 2 || !peak.Peak.Time.Equal(samples[2].at) || len(peak.Daily) < 2 {
+		t.Errorf("peak = %+v", peak)
+	}
+
+	var clients ClientHistoryResponse
+	decode(t, serve(h, http.MethodGet, "/history/clients?days=7", ""), &clients)
+	if len(clients.Clients) != 3 || clients.Clients[0].Client != "10.0.0.4" || !reflect.DeepEqual(clients.Clients[2].Shares, []string{"private"}) {
+		t.Errorf("clients = %+v", clients.Clients)
+	}
+
+	if rec := serve(h, http.MethodGet, "/history/peak?days=0", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("days=0: status = %d", rec.Code)
+	}
+}
+
+func TestSessionHistoryRetention(t *testing.T) {
+	newTestAPI(t)
+
+	now := time.Now()
+	old := historyStatus(TreeConnect{Share: "public", PID: "1", User: "carol", ClientIP: "10.0.0.3"})
+	if err := recordHistorySample(old, now.AddDate(0, 0, -10), 0); err != nil {
+		t.Fatalf("record sample: %v", err)
+	}
+	if err := collectHistorySample(now, 7*24*time.Hour); err != nil {
+		t.Fatalf("collect sample: %v", err)
+	}
+
+	visitors, _ := shareVisitors("public", now.AddDate(0, 0, -30))
+	clients, _ := seenClients()
+	if len(visitors) != 1 || visitors[0].User != "alice" || len(clients) != 1 || clients[0].Client != "192.168.1.10" {
+		t.Errorf("visitors = %+v, clients = %+v", visitors, clients)
+	}
+}
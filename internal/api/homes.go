@@ -0,0 +1,456 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HomeConfig controls how user home directories are provisioned
+type HomeConfig struct {
+	BasePath   string   // Used when [homes] has no path, supports Samba macros
+	Mode       string   // Octal mode of new home directories
+	Skeleton   string   // Directory copied into new homes, empty to disable
+	Quota      string   // Block quota such as 10G, empty to disable
+	ACL        []string // Extra ACL entries such as g:staff:r-x
+	AutoCreate bool     // Provision homes when users are created
+
+	OnDelete     string // What happens to a home when its user is deleted: keep, archive, move or delete
+	ArchivePath  string // Directory receiving home tarballs
+	DepartedPath string // Directory receiving moved homes
+}
+
+// Home directory actions on user deletion
+const (
+	HomeActionKeep    = "keep"
+	HomeActionArchive = "archive"
+	HomeActionMove    = "move"
+	HomeActionDelete  = "delete"
+)
+
+// HomeDirectory describes a directory under the homes base path
+type HomeDirectory struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	UID      int    `json:"uid"`
+	Owner    string `json:"owner,omitempty"`
+	Orphaned bool   `json:"orphaned"`
+	Modified string `json:"modified,omitempty"`
+}
+
+// HomeListResponse represents the response for home directory listing
+type HomeListResponse struct {
+	BasePath string          `json:"basePath"`
+	Homes    []HomeDirectory `json:"homes"`
+	Error    string          `json:"error,omitempty"`
+}
+
+// OffboardRecord is written next to archived and moved homes to record their owner
+type OffboardRecord struct {
+	Username    string `json:"username"`
+	UID         int    `json:"uid"`
+	GID         int    `json:"gid"`
+	HomePath    string `json:"homePath"`
+	Action      string `json:"action"`
+	Destination string `json:"destination"`
+	Time        string `json:"time"`
+}
+
+var (
+	homeConfig = HomeConfig{Mode: "0700", Skeleton: "/etc/skel", AutoCreate: true, OnDelete: HomeActionKeep}
+	homeMu     sync.RWMutex
+)
+
+// ACL entries accepted in the home configuration
+var homeACLRegex = regexp.MustCompile(`^[ug]:[A-Za-z_][A-Za-z0-9_.-]*\$?:[r-][w-][x-]$`)
+
+// SetHomeConfig sets the home directory provisioning configuration
+func SetHomeConfig(cfg HomeConfig) {
+	homeMu.Lock()
+	defer homeMu.Unlock()
+	homeConfig = cfg
+}
+
+// GetHomeConfig gets the home directory provisioning configuration
+func GetHomeConfig() HomeConfig {
+	homeMu.RLock()
+	defer homeMu.RUnlock()
+	return homeConfig
+}
+
+// resolveHomePath returns the home directory of a user, preferring the
+// [homes] share path, then the configured base path, then the passwd entry
+func resolveHomePath(account Account, cfg HomeConfig) (string, error) {
+	template := cfg.BasePath
+
+	config, err := ReadConfig()
+	if err == nil {
+		if path := config["homes"]["path"]; path != "" {
+			template = path
+		}
+	}
+
+	if template == "" {
+		template = account.Home
+	}
+	if template == "" {
+		template = "/home/%S"
+	}
+
+	groupName := strconv.Itoa(account.GID)
+	if group, err := findGroupByGID(account.GID); err == nil {
+		groupName = group.Name
+	}
+
+	path := expandSambaMacros(template, account, groupName)
+	if err := validateSharePath(path); err != nil {
+		return "", fmt.Errorf("Invalid home directory path '%s' from '%s': %v", path, template, err)
+	}
+
+	return path, nil
+}
+
+// expandSambaMacros expands the per-user Samba macros in a [homes] path
+func expandSambaMacros(value string, account Account, groupName string) string {
+	replacements := map[byte]string{
+		'S': account.Name, // Service name, which is the username for [homes]
+		'U': account.Name,
+		'u': account.Name,
+		'G': groupName,
+		'g': groupName,
+		'H': account.Home,
+		'%': "%",
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '%' && i+1 < len(value) {
+			if replacement, ok := replacements[value[i+1]]; ok {
+				b.WriteString(replacement)
+				i++
+				continue
+			}
+		}
+		b.WriteByte(value[i])
+	}
+
+	return b.String()
+}
+
+// findGroupByGID finds the group with the given GID
+func findGroupByGID(gid int) (GroupEntry, error) {
+	groups, err := getBackend().Accounts.ListGroups()
+	if err != nil {
+		return GroupEntry{}, err
+	}
+
+	for _, group := range groups {
+		if group.GID == gid {
+			return group, nil
+		}
+	}
+
+	return GroupEntry{}, fmt.Errorf("No group with GID %d", gid)
+}
+
+// provisionHomeDirectory creates and populates a user's home directory
+// according to the home configuration and returns its path
+func provisionHomeDirectory(username string) (string, error) {
+	cfg := GetHomeConfig()
+	sys := getBackend()
+
+	// Verify the user exists
+	account, err := sys.Accounts.LookupUser(username)
+	if err != nil {
+		return "", fmt.Errorf("User %s does not exist", username)
+	}
+
+	homePath, err := resolveHomePath(account, cfg)
+	if err != nil {
+		return "", err
+	}
+
+	mode := cfg.Mode
+	if mode == "" {
+		mode = "0700"
+	}
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return "", fmt.Errorf("Invalid home directory mode '%s': must be octal", mode)
+	}
+
+	// Check if home directory already exists
+	if _, err := sys.Files.Stat(homePath); err == nil {
+		return "", fmt.Errorf("Home directory %s for user %s already exists", homePath, username)
+	}
+
+	// Parent directories are created with standard permissions
+	err = sys.Files.MkdirAll(filepath.Dir(homePath), 0755)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create home directory for user %s: %v", username, err)
+	}
+
+	err = sys.Files.MkdirAll(homePath, 0700)
+	if err != nil {
+		return "", fmt.Errorf("Failed to create home directory for user %s: %v", username, err)
+	}
+
+	// Populate from the skeleton directory
+	if cfg.Skeleton != "" {
+		if _, err := sys.Files.Stat(cfg.Skeleton); err == nil {
+			err = sys.Files.CopyTree(cfg.Skeleton, homePath, account.UID, account.GID)
+			if err != nil {
+				return "", fmt.Errorf("Failed to copy skeleton directory %s: %v", cfg.Skeleton, err)
+			}
+		}
+	}
+
+	// Change ownership of the directory to the new user
+	err = sys.Files.Chown(homePath, account.UID, account.GID)
+	if err != nil {
+		return "", fmt.Errorf("Failed to set ownership of home directory for user %s: %v", username, err)
+	}
+
+	// Apply the mode explicitly so the umask does not affect it
+	err = sys.Files.Chmod(homePath, fmt.Sprintf("%04o", perm))
+	if err != nil {
+		return "", fmt.Errorf("Failed to set permissions of home directory for user %s: %v", username, err)
+	}
+
+	// Grant extra ACL entries on the directory and everything created in it
+	for _, entry := range cfg.ACL {
+		if !homeACLRegex.MatchString(entry) {
+			return "", fmt.Errorf("Invalid home directory ACL entry '%s'", entry)
+		}
+		if err := sys.ACLs.ModifyACL(homePath, entry); err != nil {
+			return "", fmt.Errorf("Failed to set ACL %s on home directory: %v", entry, err)
+		}
+		if err := sys.ACLs.ModifyACL(homePath, "d:"+entry); err != nil {
+			return "", fmt.Errorf("Failed to set default ACL %s on home directory: %v", entry, err)
+		}
+	}
+
+	// Limit disk usage
+	if cfg.Quota != "" {
+		quotaBytes, err := convertSizeToBytes(cfg.Quota)
+		if err != nil {
+			return "", fmt.Errorf("Invalid home directory quota '%s': %v", cfg.Quota, err)
+		}
+		quotaKB := quotaBytes / 1024
+		if err := sys.Quotas.SetUserQuota(username, homePath, quotaKB, quotaKB); err != nil {
+			return "", fmt.Errorf("Failed to set quota for user %s: %v", username, err)
+		}
+	}
+
+	return homePath, nil
+}
+
+// GetHomeDirectories lists home directories, by default only those whose owner no longer exists
+func (h *APIHandler) GetHomeDirectories(w http.ResponseWriter, r *http.Request) {
+	includeAll := r.URL.Query().Get("all") == "true"
+
+	response, err := listHomeDirectories(includeAll)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// homesBasePath returns the directory holding all home directories: the part
+// of the home path template before the first per-user macro
+func homesBasePath(cfg HomeConfig) string {
+	template := cfg.BasePath
+	if config, err := ReadConfig(); err == nil {
+		if path := config["homes"]["path"]; path != "" {
+			template = path
+		}
+	}
+	if template == "" {
+		return "/home"
+	}
+
+	var parts []string
+	for _, part := range strings.Split(filepath.Clean(template), "/") {
+		if strings.Contains(part, "%") {
+			break
+		}
+		parts = append(parts, part)
+	}
+
+	base := strings.Join(parts, "/")
+	if base == "" {
+		return "/"
+	}
+	return base
+}
+
+// listHomeDirectories lists directories under the homes base path and marks
+// those whose owning UID has no account as orphaned
+func listHomeDirectories(includeAll bool) (HomeListResponse, error) {
+	cfg := GetHomeConfig()
+	sys := getBackend()
+	basePath := homesBasePath(cfg)
+
+	accounts, err := sys.Accounts.ListUsers()
+	if err != nil {
+		return HomeListResponse{}, fmt.Errorf("Failed to list users: %v", err)
+	}
+	owners := make(map[int]string)
+	for _, account := range accounts {
+		owners[account.UID] = account.Name
+	}
+
+	entries, err := sys.Files.ReadDir(basePath)
+	if err != nil {
+		return HomeListResponse{}, fmt.Errorf("Failed to list %s: %v", basePath, err)
+	}
+
+	homes := []HomeDirectory{}
+	for _, entry := range entries {
+		// Skip files and the offboarding destinations if they live under the base path
+		if !entry.IsDir || entry.Path == filepath.Clean(cfg.ArchivePath) || entry.Path == filepath.Clean(cfg.DepartedPath) {
+			continue
+		}
+
+		owner, exists := owners[entry.UID]
+		if exists && !includeAll {
+			continue
+		}
+
+		home := HomeDirectory{
+			Name:     entry.Name,
+			Path:     entry.Path,
+			UID:      entry.UID,
+			Owner:    owner,
+			Orphaned: !exists,
+		}
+		if !entry.ModTime.IsZero() {
+			home.Modified = entry.ModTime.Format(time.RFC3339)
+		}
+		homes = append(homes, home)
+	}
+
+	return HomeListResponse{BasePath: basePath, Homes: homes}, nil
+}
+
+// validateHomeAction checks that an action is a known home deletion action
+func validateHomeAction(action string) error {
+	switch action {
+	case HomeActionKeep, HomeActionArchive, HomeActionMove, HomeActionDelete:
+		return nil
+	}
+	return fmt.Errorf("Invalid home action '%s': must be keep, archive, move or delete", action)
+}
+
+// offboardHomeDirectory archives, moves or deletes the home directory of a
+// deleted account and returns a description of what was done
+func offboardHomeDirectory(account Account, homePath, action string) (string, error) {
+	cfg := GetHomeConfig()
+	sys := getBackend()
+
+	if action == HomeActionKeep {
+		return "", nil
+	}
+
+	// Nothing to do if the user never had a home directory
+	if _, err := sys.Files.Stat(homePath); err != nil {
+		return "", nil
+	}
+
+	// Only touch directories that belong to the account, never shared ones
+	uid, err := pathOwner(homePath)
+	if err != nil {
+		return "", err
+	}
+	if uid != account.UID {
+		return "", fmt.Errorf("Home directory %s is not owned by %s, leaving it in place", homePath, account.Name)
+	}
+
+	stamp := time.Now().Format("20060102-150405")
+	record := OffboardRecord{
+		Username: account.Name,
+		UID:      account.UID,
+		GID:      account.GID,
+		HomePath: homePath,
+		Action:   action,
+		Time:     time.Now().Format(time.RFC3339),
+	}
+
+	var message string
+	switch action {
+	case HomeActionArchive:
+		if cfg.ArchivePath == "" {
+			return "", fmt.Errorf("No archive path configured for home directories")
+		}
+		if err := sys.Files.MkdirAll(cfg.ArchivePath, 0700); err != nil {
+			return "", fmt.Errorf("Failed to create archive directory: %v", err)
+		}
+		record.Destination = filepath.Join(cfg.ArchivePath, fmt.Sprintf("%s-%s.tar.gz", account.Name, stamp))
+		if err := sys.Files.Archive(homePath, record.Destination); err != nil {
+			return "", fmt.Errorf("Failed to archive home directory %s: %v", homePath, err)
+		}
+		if err := sys.Files.RemoveAll(homePath); err != nil {
+			return "", fmt.Errorf("Home directory archived to %s but could not be removed: %v", record.Destination, err)
+		}
+		message = fmt.Sprintf("Home directory %s archived to %s", homePath, record.Destination)
+
+	case HomeActionMove:
+		if cfg.DepartedPath == "" {
+			return "", fmt.Errorf("No departed path configured for home directories")
+		}
+		if err := sys.Files.MkdirAll(cfg.DepartedPath, 0700); err != nil {
+			return "", fmt.Errorf("Failed to create departed directory: %v", err)
+		}
+		record.Destination = filepath.Join(cfg.DepartedPath, fmt.Sprintf("%s-%s", account.Name, stamp))
+		if err := sys.Files.Rename(homePath, record.Destination); err != nil {
+			return "", fmt.Errorf("Failed to move home directory %s: %v", homePath, err)
+		}
+		message = fmt.Sprintf("Home directory %s moved to %s", homePath, record.Destination)
+
+	case HomeActionDelete:
+		if err := sys.Files.RemoveAll(homePath); err != nil {
+			return "", fmt.Errorf("Failed to delete home directory %s: %v", homePath, err)
+		}
+		message = fmt.Sprintf("Home directory %s deleted", homePath)
+
+	default:
+		return "", validateHomeAction(action)
+	}
+
+	log.Printf("Offboarded home of %s (uid %d): %s", account.Name, account.UID, message)
+
+	// Record who the archived or moved data belonged to
+	if record.Destination != "" {
+		data, _ := json.MarshalIndent(record, "", "  ")
+		if err := sys.Files.WriteFile(record.Destination+".json", data, 0600); err != nil {
+			log.Printf("Failed to write offboarding record for %s: %v", account.Name, err)
+		}
+	}
+
+	return message, nil
+}
+
+// pathOwner returns the owning UID of a path
+func pathOwner(path string) (int, error) {
+	entries, err := getBackend().Files.ReadDir(filepath.Dir(path))
+	if err != nil {
+		return -1, fmt.Errorf("Failed to read owner of %s: %v", path, err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name == filepath.Base(path) {
+			return entry.UID, nil
+		}
+	}
+
+	return -1, fmt.Errorf("Failed to read owner of %s", path)
+}
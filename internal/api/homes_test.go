@@ -0,0 +1,155 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestExpandSambaMacros(t *testing.T) {
+	account := Account{Name: "alice", UID: 1001, GID: 2000, Home: "/home/alice"}
+
+	tests := map[string]string{
+		"/srv/homes/%S":   "/srv/homes/alice",
+		"/srv/%G/%U":      "/srv/staff/alice",
+		"%H/samba":        "/home/alice/samba",
+		"/srv/100%%/%u":   "/srv/100%/alice",
+		"/srv/%m/unknown": "/srv/%m/unknown",
+		"/srv/trailing%":  "/srv/trailing%",
+	}
+	for template, want := range tests {
+		if got := expandSambaMacros(template, account, "staff"); got != want {
+			t.Errorf("expandSambaMacros(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
+
+func TestProvisionHomeFromHomesSection(t *testing.T) {
+	fake, h := newTestAPI(t)
+
+	previous := GetHomeConfig()
+	SetHomeConfig(HomeConfig{Mode: "0750", Skeleton: "/etc/skel", Quota: "1G", ACL: []string{"g:staff:r-x"}, AutoCreate: true})
+	t.Cleanup(func() { SetHomeConfig(previous) })
+
+	config, _ := ReadConfig()
+	config["homes"] = SectionConfig{"path": "/srv/homes/%S", "browseable": "no"}
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	fake.Dirs["/etc/skel"] = fakeDir{Mode: 0755}
+	fake.Dirs["/etc/skel/.config"] = fakeDir{Mode: 0700}
+
+	rec := serve(h, http.MethodPost, "/users/carol", `{"password": "Pa55word!"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	carol := fake.Accounts["carol"]
+	home, ok := fake.Dirs["/srv/homes/carol"]
+	if !ok {
+		t.Fatalf("home directory not created under the [homes] path")
+	}
+	if home.Mode != 0750 || home.UID != carol.UID || home.GID != carol.GID {
+		t.Errorf("home = %+v", home)
+	}
+	if skel, ok := fake.Dirs["/srv/homes/carol/.config"]; !ok || skel.UID != carol.UID {
+		t.Errorf("skeleton not copied: %+v", skel)
+	}
+	if len(fake.ACLs["/srv/homes/carol"]) != 2 {
+		t.Errorf("ACLs = %+v", fake.ACLs["/srv/homes/carol"])
+	}
+	if fake.Quotas["carol"] != 1024*1024 {
+		t.Errorf("quota = %d KB", fake.Quotas["carol"])
+	}
+
+	// A second provisioning attempt reports the existing directory
+	rec = serve(h, http.MethodPost, "/users/carol/home", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("existing home: status = %d, want 500", rec.Code)
+	}
+}
+
+func TestProvisionHomeRejectsRelativePath(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	previous := GetHomeConfig()
+	SetHomeConfig(HomeConfig{BasePath: "homes/%U", Mode: "0700"})
+	t.Cleanup(func() { SetHomeConfig(previous) })
+
+	rec := serve(h, http.MethodPost, "/users/alice/home", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if _, err := os.Stat("homes"); err == nil {
+		t.Errorf("relative home directory created in working directory")
+	}
+}
+
+func TestDeleteUserHomeActions(t *testing.T) {
+	tests := []struct {
+		action string
+		check  func(t *testing.T, fake *FakeSystem)
+	}{
+		{HomeActionKeep, func(t *testing.T, fake *FakeSystem) {
+			if _, ok := fake.Dirs["/home/alice"]; !ok {
+				t.Errorf("home removed with keep action")
+			}
+		}},
+		{HomeActionArchive, func(t *testing.T, fake *FakeSystem) {
+			if _, ok := fake.Dirs["/home/alice"]; ok {
+				t.Errorf("home not removed after archiving")
+			}
+			if len(fake.Archives) != 1 {
+				t.Fatalf("archives = %v", fake.Archives)
+			}
+			for archive, src := range fake.Archives {
+				if src != "/home/alice" || !strings.HasPrefix(archive, "/backup/alice-") {
+					t.Errorf("archive %s of %s", archive, src)
+				}
+				if _, ok := fake.Files[archive+".json"]; !ok {
+					t.Errorf("no offboarding record for %s", archive)
+				}
+			}
+		}},
+		{HomeActionMove, func(t *testing.T, fake *FakeSystem) {
+			entries, _ := fakeFileSystem{fake}.ReadDir("/departed")
+			if _, ok := fake.Dirs["/home/alice"]; ok || len(entries) != 2 {
+				t.Errorf("departed entries = %+v", entries)
+			}
+		}},
+		{HomeActionDelete, func(t *testing.T, fake *FakeSystem) {
+			if _, ok := fake.Dirs["/home/alice"]; ok {
+				t.Errorf("home not deleted")
+			}
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.action, func(t *testing.T) {
+			fake, h := newTestAPI(t)
+			previous := GetHomeConfig()
+			SetHomeConfig(HomeConfig{Mode: "0700", OnDelete: HomeActionKeep, ArchivePath: "/backup", DepartedPath: "/departed"})
+			t.Cleanup(func() { SetHomeConfig(previous) })
+
+			rec := serve(h, http.MethodDelete, "/users/alice?home="+tc.action, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+			}
+			tc.check(t, fake)
+		})
+	}
+}
+
+func TestDeleteUserLeavesForeignHome(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Dirs["/home/alice"] = fakeDir{Mode: 0755, UID: 0, GID: 0}
+
+	rec := serve(h, http.MethodDelete, "/users/alice?home=delete", "")
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", rec.Code)
+	}
+	if _, ok := fake.Dirs["/home/alice"]; !ok {
+		t.Errorf("home owned by another user was deleted")
+	}
+}
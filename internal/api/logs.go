@@ -0,0 +1,703 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of log sources
+const (
+	LogSourceFile    = "file"
+	LogSourceJournal = "journal"
+)
+
+// Page sizes of the log API
+const (
+	defaultLogLimit = 200
+	maxLogLimit     = 5000
+)
+
+// Log files are read backwards in chunks, up to a limit per file
+var (
+	logReadChunk          = 256 * 1024
+	maxLogReadBytes int64 = 64 * 1024 * 1024
+)
+
+// maxJournalEntries caps how many journal entries a query reads
+var maxJournalEntries = 100000
+
+// defaultLogFile is where Samba logs without a [global] log file
+const defaultLogFile = "/var/log/samba/log.smbd"
+
+// LogSource is a log file or the journal
+type LogSource struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"`
+	Path    string    `json:"path,omitempty"`
+	Machine string    `json:"machine,omitempty"`
+	Size    int64     `json:"size,omitempty"`
+	ModTime time.Time `json:"modTime,omitempty"`
+}
+
+// LogEntry is one message with its header fields
+type LogEntry struct {
+	Time     time.Time `json:"time"`
+	Level    int       `json:"level"`
+	Source   string    `json:"source"`
+	Machine  string    `json:"machine,omitempty"`
+	Location string    `json:"location,omitempty"`
+	Message  string    `json:"message"`
+}
+
+// LogSourcesResponse represents the response for log source listing
+type LogSourcesResponse struct {
+	Sources []LogSource `json:"sources"`
+}
+
+// LogsResponse represents one page of log entries, newest first. Total counts
+// the matching entries that were read; Truncated is set when older entries
+// were not read because the page was already complete.
+type LogsResponse struct {
+	Entries   []LogEntry `json:"entries"`
+	Total     int        `json:"total"`
+	Offset    int        `json:"offset"`
+	Limit     int        `json:"limit"`
+	Truncated bool       `json:"truncated,omitempty"`
+}
+
+// logFilter selects log entries
+type logFilter struct {
+	Sources  map[string]bool
+	Machine  string
+	MaxLevel int // -1 for any level
+	Since    time.Time
+	Until    time.Time
+	Query    string
+}
+
+// GetLogSources lists the log files and journal Samba writes to
+func (h *APIHandler) GetLogSources(w http.ResponseWriter, r *http.Request) {
+	sources, err := findLogSources()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(LogSourcesResponse{Sources: sources})
+}
+
+// GetLogs returns log entries newest first. Query parameters: source (repeatable),
+// machine, level (maximum debug level), since and until (RFC 3339), q (text),
+// offset and limit.
+func (h *APIHandler) GetLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := queryInt(r, "offset", 0, 0, -1)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, err := queryInt(r, "limit", defaultLogLimit, 1, maxLogLimit)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	sources, err := selectLogSources(filter)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Every source only needs to provide the newest entries up to the end
+	// of the page, older ones can't make it onto the page
+	var entries []LogEntry
+	truncated := false
+	for _, source := range sources {
+		sourceEntries, more, err := readLogSource(source, filter, offset+limit)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		entries = append(entries, sourceEntries...)
+		truncated = truncated || more
+	}
+
+	// Newest first, keeping file order for entries with the same timestamp
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.After(entries[j].Time)
+	})
+
+	response := LogsResponse{Entries: []LogEntry{}, Total: len(entries), Offset: offset, Limit: limit, Truncated: truncated}
+	if offset < len(entries) {
+		end := offset + limit
+		if end > len(entries) {
+			end = len(entries)
+		}
+		response.Entries = entries[offset:end]
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+var (
+	// logStreamPollInterval is how often the stream checks for new lines
+	logStreamPollInterval = time.Second
+	// logStreamLimit ends a stream after this long; EventSource clients reconnect
+	logStreamLimit = 30 * time.Minute
+)
+
+// StreamLogs sends new log entries as server-sent events until the client
+// disconnects. It accepts the filters of GetLogs except the time range.
+func (h *APIHandler) StreamLogs(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseLogFilter(r)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sources, err := selectLogSources(filter)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Start at the current end of every source so only new entries are sent
+	tails := make(map[string]*logTail)
+	for _, source := range sources {
+		tail := &logTail{source: source}
+		if source.Type == LogSourceJournal {
+			_, tail.cursor, _ = readJournal("", time.Time{}, time.Time{}, 1)
+		} else {
+			tail.offset = source.Size
+		}
+		tails[source.Name] = tail
+	}
+
+	// The server's write timeout would cut the stream short, logStreamLimit
+	// bounds it instead
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(logStreamPollInterval)
+	defer ticker.Stop()
+	deadline := time.After(logStreamLimit)
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-deadline:
+			return
+		case <-ticker.C:
+		}
+
+		for _, tail := range tails {
+			for _, entry := range tail.poll() {
+				if !filter.matches(entry) {
+					continue
+				}
+				data, _ := json.Marshal(entry)
+				fmt.Fprintf(w, "data: %s\n\n", data)
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// logTail follows one log source
+type logTail struct {
+	source  LogSource
+	offset  int64
+	cursor  string
+	partial string
+}
+
+// poll returns the entries written since the last poll
+func (t *logTail) poll() []LogEntry {
+	if t.source.Type == LogSourceJournal {
+		entries, cursor, err := readJournal(t.cursor, time.Time{}, time.Time{}, maxLogLimit)
+		if err == nil {
+			t.cursor = cursor
+		}
+		return entries
+	}
+
+	file, err := os.Open(t.source.Path)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil
+	}
+	// The file was rotated or truncated, start over
+	if info.Size() < t.offset {
+		t.offset = 0
+		t.partial = ""
+	}
+	if info.Size() == t.offset {
+		return nil
+	}
+
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return nil
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil
+	}
+	t.offset += int64(len(data))
+
+	// Keep an incomplete last line for the next poll
+	text := t.partial + string(data)
+	end := strings.LastIndex(text, "\n")
+	if end < 0 {
+		t.partial = text
+		return nil
+	}
+	t.partial = text[end+1:]
+
+	return parseSambaLog(strings.NewReader(text[:end+1]), t.source)
+}
+
+// findLogSources expands [global] log file into the existing files and adds
+// the journal when Samba logs there or no log file exists
+func findLogSources() ([]LogSource, error) {
+	config, err := ReadConfig()
+	if err != nil {
+		return nil, err
+	}
+	global := lowerParams(config["global"])
+
+	pattern := global["log file"]
+	if pattern == "" {
+		pattern = defaultLogFile
+	}
+
+	sources := []LogSource{}
+	glob, machineRegex := logFileGlob(pattern)
+	paths, _ := filepath.Glob(glob)
+	// Rotated files are named like the active file plus .old
+	rotated, _ := filepath.Glob(glob + ".old")
+	paths = append(paths, rotated...)
+	sort.Strings(paths)
+
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || info.IsDir() || seen[path] {
+			continue
+		}
+		seen[path] = true
+
+		source := LogSource{Name: path, Type: LogSourceFile, Path: path, Size: info.Size(), ModTime: info.ModTime()}
+		if matches := machineRegex.FindStringSubmatch(strings.TrimSuffix(path, ".old")); len(matches) > 1 {
+			source.Machine = matches[1]
+		}
+		sources = append(sources, source)
+	}
+
+	logging := global["logging"]
+	if len(sources) == 0 || strings.Contains(logging, "systemd") || strings.Contains(logging, "syslog") {
+		sources = append(sources, LogSource{Name: LogSourceJournal, Type: LogSourceJournal})
+	}
+
+	return sources, nil
+}
+
+// logFileGlob turns a log file setting with Samba macros into a glob and a
+// regexp capturing the client machine of %m, %M or %I
+func logFileGlob(pattern string) (string, *regexp.Regexp) {
+	var glob, expr strings.Builder
+	captured := false
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '%' && i+1 < len(pattern) {
+			i++
+			glob.WriteString("*")
+			if strings.ContainsRune("mMI", rune(pattern[i])) && !captured {
+				expr.WriteString("(.+)")
+				captured = true
+			} else {
+				expr.WriteString(".*")
+			}
+			continue
+		}
+		glob.WriteString(escapeGlob(string(pattern[i])))
+		expr.WriteString(regexp.QuoteMeta(string(pattern[i])))
+	}
+	return glob.String(), regexp.MustCompile("^" + expr.String() + "$")
+}
+
+// escapeGlob escapes glob metacharacters
+func escapeGlob(value string) string {
+	return strings.NewReplacer(`*`, `\*`, `?`, `\?`, `[`, `\[`, `\`, `\\`).Replace(value)
+}
+
+// selectLogSources returns the sources a filter asks for, all files by default
+func selectLogSources(filter logFilter) ([]LogSource, error) {
+	sources, err := findLogSources()
+	if err != nil {
+		return nil, err
+	}
+
+	var selected []LogSource
+	for _, source := range sources {
+		if len(filter.Sources) > 0 && !filter.Sources[source.Name] {
+			continue
+		}
+		selected = append(selected, source)
+	}
+
+	// The journal is always available on request, even when Samba logs to files
+	if filter.Sources[LogSourceJournal] && !containsLogSource(selected, LogSourceJournal) {
+		selected = append(selected, LogSource{Name: LogSourceJournal, Type: LogSourceJournal})
+	}
+
+	return selected, nil
+}
+
+// containsLogSource reports whether sources contains one with name
+func containsLogSource(sources []LogSource, name string) bool {
+	for _, source := range sources {
+		if source.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// readLogSource returns up to want entries of a file or the recent journal
+// matching filter, in log order. more reports whether older entries of a file
+// were left unread.
+func readLogSource(source LogSource, filter logFilter, want int) ([]LogEntry, bool, error) {
+	if source.Type == LogSourceJournal {
+		return readJournalSource(filter, want)
+	}
+
+	file, err := os.Open(source.Path)
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to read %s: %v", source.Path, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, false, fmt.Errorf("Failed to read %s: %v", source.Path, err)
+	}
+
+	// Read chunks from the end of the file, parsing the entries that are
+	// complete, until enough entries match or the read limit is reached
+	var pending []byte
+	var chunks [][]LogEntry
+	matched := 0
+	start := info.Size()
+	for start > 0 && matched < want {
+		size := int64(logReadChunk)
+		if size > start {
+			size = start
+		}
+		if read := info.Size() - start; read+size > maxLogReadBytes {
+			size = maxLogReadBytes - read
+			if size <= 0 {
+				break
+			}
+		}
+		start -= size
+
+		chunk := make([]byte, size, size+int64(len(pending)))
+		if _, err := file.ReadAt(chunk, start); err != nil && err != io.EOF {
+			return nil, false, fmt.Errorf("Failed to read %s: %v", source.Path, err)
+		}
+		pending = append(chunk, pending...)
+
+		// Lines before the first entry header may belong to an entry that
+		// starts in the previous chunk
+		complete := pending
+		if start > 0 {
+			first := firstLogEntryStart(pending)
+			if first < 0 {
+				continue
+			}
+			complete, pending = pending[first:], pending[:first]
+		} else {
+			pending = nil
+		}
+
+		var entries []LogEntry
+		for _, entry := range parseSambaLog(bytes.NewReader(complete), source) {
+			if filter.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+		chunks = append(chunks, entries)
+		matched += len(entries)
+	}
+
+	entries := make([]LogEntry, 0, matched)
+	for i := len(chunks) - 1; i >= 0; i-- {
+		entries = append(entries, chunks[i]...)
+	}
+	return entries, start > 0, nil
+}
+
+// readJournalSource returns up to want journal entries matching filter. The
+// time range is left to the journal; the other filters apply afterwards, so
+// more entries are read while too few of them match.
+func readJournalSource(filter logFilter, want int) ([]LogEntry, bool, error) {
+	limit := want
+	for {
+		journal, _, err := readJournal("", filter.Since, filter.Until, limit)
+		if err != nil {
+			return nil, false, err
+		}
+
+		var entries []LogEntry
+		for _, entry := range journal {
+			if filter.matches(entry) {
+				entries = append(entries, entry)
+			}
+		}
+
+		// Fewer entries than asked for means the range is exhausted
+		more := len(journal) >= limit
+		if !more || len(entries) >= want || limit >= maxJournalEntries {
+			return entries, more, nil
+		}
+		limit *= 4
+		if limit > maxJournalEntries {
+			limit = maxJournalEntries
+		}
+	}
+}
+
+// firstLogEntryStart returns the offset of the first entry header in data
+// that starts a line, skipping the first line which may be incomplete, or -1
+func firstLogEntryStart(data []byte) int {
+	offset := bytes.IndexByte(data, '\n') + 1
+	if offset == 0 {
+		return -1
+	}
+	for offset < len(data) {
+		end := bytes.IndexByte(data[offset:], '\n')
+		if end < 0 {
+			end = len(data) - offset
+		}
+		line := string(data[offset : offset+end])
+		if logHeaderRegex.MatchString(line) || logSyslogRegex.MatchString(line) {
+			return offset
+		}
+		offset += end + 1
+	}
+	return -1
+}
+
+// readJournal returns up to limit journal entries of the Samba daemons between
+// since and until and the last cursor
+func readJournal(afterCursor string, since, until time.Time, limit int) ([]LogEntry, string, error) {
+	var units []string
+	for _, unit := range sambaUnits {
+		if !unit.ReadsConfig {
+			continue
+		}
+		if name, installed := resolveUnit(unit); installed {
+			units = append(units, name)
+		}
+	}
+	if len(units) == 0 {
+		return nil, afterCursor, nil
+	}
+
+	journal, err := getBackend().Journal.Entries(units, afterCursor, since, until, limit)
+	if err != nil {
+		return nil, afterCursor, fmt.Errorf("Failed to read the journal: %v", err)
+	}
+
+	entries := make([]LogEntry, 0, len(journal))
+	cursor := afterCursor
+	for _, record := range journal {
+		entries = append(entries, LogEntry{
+			Time:     record.Time,
+			Level:    levelFromPriority(record.Priority),
+			Source:   LogSourceJournal,
+			Location: record.Unit,
+			Message:  record.Message,
+		})
+		cursor = record.Cursor
+	}
+
+	return entries, cursor, nil
+}
+
+// levelFromPriority maps a syslog priority back to the Samba debug level that
+// produces it: 0 is logged as LOG_ERR, 1 as LOG_WARNING, 2 as LOG_NOTICE,
+// 3 as LOG_INFO and everything above as LOG_DEBUG
+func levelFromPriority(priority int) int {
+	if priority <= 3 {
+		return 0
+	}
+	return priority - 3
+}
+
+// logHeaderRegex matches the header of a classic Samba log entry, such as
+// "[2023/10/16 10:00:00.123456,  3, pid=2436] ../../source3/smbd/service.c:1130(make_connection_snum)"
+var logHeaderRegex = regexp.MustCompile(`^\[(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}(?:\.\d+)?),\s*(\d+)[^\]]*\]\s*(.*)$`)
+
+// logSyslogRegex matches a single-line entry written with debug syslog format,
+// such as "2023-10-16T10:00:00.123456+02:00  3 smbd[2436]: message"
+var logSyslogRegex = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}T\S+)\s+(\d+)\s+(\S+?):\s(.*)$`)
+
+// parseSambaLog splits a Samba log into entries. Lines that don't start an
+// entry are continuation lines of the previous one.
+func parseSambaLog(reader io.Reader, source LogSource) []LogEntry {
+	var entries []LogEntry
+	var current *LogEntry
+
+	flush := func() {
+		if current != nil {
+			current.Message = strings.TrimSpace(current.Message)
+			entries = append(entries, *current)
+			current = nil
+		}
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if matches := logHeaderRegex.FindStringSubmatch(line); matches != nil {
+			flush()
+			current = &LogEntry{Level: atoiOr(matches[2], -1), Source: source.Name, Machine: source.Machine, Location: matches[3]}
+			layout := "2006/01/02 15:04:05"
+			if strings.Contains(matches[1], ".") {
+				layout += ".999999"
+			}
+			current.Time, _ = time.ParseInLocation(layout, matches[1], time.Local)
+			continue
+		}
+
+		if matches := logSyslogRegex.FindStringSubmatch(line); matches != nil {
+			flush()
+			current = &LogEntry{Level: atoiOr(matches[2], -1), Source: source.Name, Machine: source.Machine, Location: matches[3], Message: matches[4]}
+			current.Time, _ = time.Parse(time.RFC3339Nano, matches[1])
+			continue
+		}
+
+		if current == nil {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			current = &LogEntry{Level: -1, Source: source.Name, Machine: source.Machine}
+		}
+		current.Message += "\n" + strings.TrimSpace(line)
+	}
+	flush()
+
+	return entries
+}
+
+// atoiOr parses an integer, returning def when it isn't one
+func atoiOr(value string, def int) int {
+	if n, err := strconv.Atoi(value); err == nil {
+		return n
+	}
+	return def
+}
+
+// parseLogFilter reads the filter query parameters
+func parseLogFilter(r *http.Request) (logFilter, error) {
+	query := r.URL.Query()
+	filter := logFilter{
+		Sources:  make(map[string]bool),
+		Machine:  query.Get("machine"),
+		MaxLevel: -1,
+		Query:    strings.ToLower(query.Get("q")),
+	}
+
+	for _, source := range query["source"] {
+		filter.Sources[source] = true
+	}
+
+	if value := query.Get("level"); value != "" {
+		level, err := strconv.Atoi(value)
+		if err != nil || level < 0 {
+			return filter, fmt.Errorf("Invalid level %s", value)
+		}
+		filter.MaxLevel = level
+	}
+
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("Invalid %s time %s, expected RFC 3339", name, value)
+			}
+			*target = parsed
+		}
+	}
+
+	return filter, nil
+}
+
+// matches reports whether an entry passes the filter
+func (f logFilter) matches(entry LogEntry) bool {
+	if f.MaxLevel >= 0 && entry.Level > f.MaxLevel {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Time.After(f.Until) {
+		return false
+	}
+	if f.Machine != "" && !strings.EqualFold(entry.Machine, f.Machine) &&
+		!strings.Contains(strings.ToLower(entry.Message), strings.ToLower(f.Machine)) {
+		return false
+	}
+	if f.Query != "" && !strings.Contains(strings.ToLower(entry.Message), f.Query) &&
+		!strings.Contains(strings.ToLower(entry.Location), f.Query) {
+		return false
+	}
+	return true
+}
+
+// queryInt reads an integer query parameter within [min, max]; max < 0 means no upper bound
+func queryInt(r *http.Request, name string, def, min, max int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || (max >= 0 && n > max) {
+		return 0, fmt.Errorf("Invalid %s %s", name, value)
+	}
+	return n, nil
+}
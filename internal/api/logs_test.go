@@ -0,0 +1,216 @@
+package api
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testClientLog = `[2023/10/16 10:00:00.123456,  3] ../../source3/smbd/service.c:1130(make_connection_snum)
+  192.168.1.10 (ipv4:192.168.1.10:54321) connect to service public initially as user alice (uid=1000, gid=1000) (pid 2436)
+[2023/10/16 10:05:00.000000,  0, pid=2436] ../../source3/smbd/uid.c:453(change_to_user_impersonate)
+  change_to_user_impersonate: user alice denied access to share private
+  NT_STATUS_ACCESS_DENIED
+`
+
+const testDaemonLog = `[2023/10/16 09:59:00.000000,  0] ../../source3/smbd/server.c:1741(main)
+  smbd version 4.17.12-Debian started.
+2023-10-16T10:02:00.000000+00:00  2 smbd[2436]: Got SIGHUP
+`
+
+// useTestLogs points [global] log file at temporary files for one machine and the daemon
+func useTestLogs(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "log.192.168.1.10"), []byte(testClientLog), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "log.smbd"), []byte(testDaemonLog), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	config, _ := ReadConfig()
+	config["global"]["log file"] = filepath.Join(dir, "log.%m")
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return dir
+}
+
+func TestParseSambaLog(t *testing.T) {
+	entries := parseSambaLog(strings.NewReader(testClientLog+testDaemonLog), LogSource{Name: "log.test", Machine: "test"})
+	if len(entries) != 4 {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	denied := entries[1]
+	want := "change_to_user_impersonate: user alice denied access to share private\nNT_STATUS_ACCESS_DENIED"
+	if denied.Level != 0 || denied.Message != want || denied.Location != "../../source3/smbd/uid.c:453(change_to_user_impersonate)" {
+		t.Errorf("entry = %+v", denied)
+	}
+	if got := denied.Time.Format("2006-01-02 15:04:05"); got != "2023-10-16 10:05:00" {
+		t.Errorf("time = %s", got)
+	}
+
+	syslog := entries[3]
+	if syslog.Level != 2 || syslog.Message != "Got SIGHUP" || syslog.Location != "smbd[2436]" || syslog.Time.UTC().Hour() != 10 {
+		t.Errorf("entry = %+v", syslog)
+	}
+}
+
+func TestLogSourcesExpandMachineMacro(t *testing.T) {
+	_, h := newTestAPI(t)
+	dir := useTestLogs(t)
+
+	var resp LogSourcesResponse
+	decode(t, serve(h, http.MethodGet, "/logs/sources", ""), &resp)
+	if len(resp.Sources) != 2 || resp.Sources[0].Machine != "192.168.1.10" || resp.Sources[1].Path != filepath.Join(dir, "log.smbd") {
+		t.Errorf("sources = %+v", resp.Sources)
+	}
+}
+
+func TestGetLogsFiltersAndPaginates(t *testing.T) {
+	_, h := newTestAPI(t)
+	useTestLogs(t)
+
+	var resp LogsResponse
+	decode(t, serve(h, http.MethodGet, "/logs?limit=2&offset=1", ""), &resp)
+	if resp.Total != 4 || len(resp.Entries) != 2 || resp.Entries[0].Message != "Got SIGHUP" {
+		t.Errorf("page = %+v", resp)
+	}
+
+	decode(t, serve(h, http.MethodGet, "/logs?machine=192.168.1.10&level=0", ""), &resp)
+	if resp.Total != 1 || !strings.Contains(resp.Entries[0].Message, "denied access") {
+		t.Errorf("machine filter = %+v", resp)
+	}
+
+	decode(t, serve(h, http.MethodGet, "/logs?since=2023-10-16T09:59:30Z&until=2023-10-16T10:03:00Z&q=sighup", ""), &resp)
+	if resp.Total != 1 {
+		t.Errorf("time filter = %+v", resp)
+	}
+
+	if rec := serve(h, http.MethodGet, "/logs?since=yesterday", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid since: status = %d", rec.Code)
+	}
+}
+
+func TestStreamLogsSendsNewEntries(t *testing.T) {
+	_, h := newTestAPI(t)
+	dir := useTestLogs(t)
+	logStreamLimit = 500 * time.Millisecond
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		file, _ := os.OpenFile(filepath.Join(dir, "log.smbd"), os.O_APPEND|os.O_WRONLY, 0644)
+		file.WriteString("[2023/10/16 11:00:00.000000,  1] server.c:1(main)\n  new entry\n")
+		file.Close()
+	}()
+
+	rec := serve(h, http.MethodGet, "/logs/stream?level=1", "")
+
+	body := rec.Body.String()
+	if rec.Header().Get("Content-Type") != "text/event-stream" || strings.Count(body, "data: ") != 1 || !strings.Contains(body, "new entry") {
+		t.Errorf("stream = %q", body)
+	}
+}
+
+func TestStreamLogsOutlivesServerWriteTimeout(t *testing.T) {
+	_, h := newTestAPI(t)
+	dir := useTestLogs(t)
+	logStreamLimit = 600 * time.Millisecond
+
+	server := httptest.NewUnstartedServer(BasicAuthMiddleware(h))
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	go func() {
+		time.Sleep(300 * time.Millisecond)
+		file, _ := os.OpenFile(filepath.Join(dir, "log.smbd"), os.O_APPEND|os.O_WRONLY, 0644)
+		file.WriteString("[2023/10/16 11:00:00.000000,  1] server.c:1(main)\n  late entry\n")
+		file.Close()
+	}()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/logs/stream", nil)
+	req.SetBasicAuth("operator", "Operat0r-pass")
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatalf("request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || !strings.Contains(string(body), "late entry") {
+		t.Errorf("stream = %q, err = %v", body, err)
+	}
+}
+
+func TestGetLogsReadsOnlyTheEndOfLargeFiles(t *testing.T) {
+	_, h := newTestAPI(t)
+	dir := useTestLogs(t)
+
+	var log strings.Builder
+	for i := 0; i < 500; i++ {
+		fmt.Fprintf(&log, "[2023/10/16 12:%02d:%02d.000000,  2] server.c:1(main)\n  entry %d\n  continued\n", i/60, i%60, i)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "log.smbd"), []byte(log.String()), 0644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	previousChunk, previousMax := logReadChunk, maxLogReadBytes
+	logReadChunk, maxLogReadBytes = 100, 4096
+	t.Cleanup(func() { logReadChunk, maxLogReadBytes = previousChunk, previousMax })
+
+	var resp LogsResponse
+	decode(t, serve(h, http.MethodGet, "/logs?source="+filepath.Join(dir, "log.smbd")+"&limit=3&offset=2", ""), &resp)
+	if !resp.Truncated || resp.Total >= 500 || len(resp.Entries) != 3 {
+		t.Fatalf("page = %+v", resp)
+	}
+	for i, entry := range resp.Entries {
+		if want := fmt.Sprintf("entry %d\ncontinued", 497-i); entry.Message != want {
+			t.Errorf("entries[%d] = %q, want %q", i, entry.Message, want)
+		}
+	}
+
+	// Beyond the read limit the page stays empty instead of reading everything
+	decode(t, serve(h, http.MethodGet, "/logs?source="+filepath.Join(dir, "log.smbd")+"&limit=10&offset=400", ""), &resp)
+	if !resp.Truncated || len(resp.Entries) != 0 {
+		t.Errorf("page beyond the read limit = %+v", resp)
+	}
+}
+
+func TestGetLogsReadsJournalRanges(t *testing.T) {
+	fake, h := newTestAPI(t)
+	start := time.Date(2023, 10, 16, 10, 0, 0, 0, time.UTC)
+	for i := 0; i < 100; i++ {
+		message := fmt.Sprintf("message %d", i)
+		if i%10 == 0 {
+			message += " denied"
+		}
+		fake.Journal = append(fake.Journal, JournalEntry{Cursor: fmt.Sprintf("c%04d", i), Time: start.Add(time.Duration(i) * time.Minute), Unit: "smbd.service", Priority: 6, Message: message})
+	}
+
+	// A range far older than the newest entries is still found
+	var resp LogsResponse
+	decode(t, serve(h, http.MethodGet, "/logs?source=journal&since=2023-10-16T10:05:00Z&until=2023-10-16T10:09:00Z&limit=3", ""), &resp)
+	if len(resp.Entries) != 3 || resp.Entries[0].Message != "message 9" || !resp.Truncated {
+		t.Errorf("range page = %+v", resp)
+	}
+	resp = LogsResponse{}
+	decode(t, serve(h, http.MethodGet, "/logs?source=journal&since=2023-10-16T10:05:00Z&until=2023-10-16T10:09:00Z&limit=10", ""), &resp)
+	if resp.Total != 5 || resp.Truncated {
+		t.Errorf("complete range = %+v", resp)
+	}
+
+	// Rare matches make the journal read further back
+	decode(t, serve(h, http.MethodGet, "/logs?source=journal&q=denied&limit=4", ""), &resp)
+	if len(resp.Entries) != 4 || resp.Entries[3].Message != "message 60 denied" {
+		t.Errorf("filtered page = %+v", resp)
+	}
+}
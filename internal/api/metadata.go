@@ -0,0 +1,116 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const defaultDataDir = "/var/lib/samba-manager"
+
+var (
+	dataDir   string
+	dataDirMu sync.RWMutex
+)
+
+// SetDataDir sets the directory holding manager-side state
+func SetDataDir(path string) {
+	dataDirMu.Lock()
+	defer dataDirMu.Unlock()
+	dataDir = path
+}
+
+// GetDataDir gets the directory holding manager-side state
+func GetDataDir() string {
+	dataDirMu.RLock()
+	defer dataDirMu.RUnlock()
+	if dataDir == "" {
+		return defaultDataDir
+	}
+	return dataDir
+}
+
+// GroupMetadata holds manager-side information about a group that the
+// system group database has no room for
+type GroupMetadata struct {
+	Description string `json:"description,omitempty"`
+}
+
+// groupMetadataMu serializes read-modify-write cycles of the metadata file
+var groupMetadataMu sync.Mutex
+
+// groupMetadataPath returns the file storing group metadata
+func groupMetadataPath() string {
+	return filepath.Join(GetDataDir(), "groups.json")
+}
+
+// loadGroupMetadata reads all group metadata; a missing file is empty
+func loadGroupMetadata() (map[string]GroupMetadata, error) {
+	metadata := make(map[string]GroupMetadata)
+
+	data, err := os.ReadFile(groupMetadataPath())
+	if os.IsNotExist(err) {
+		return metadata, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read group metadata: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("Failed to parse group metadata: %v", err)
+	}
+
+	return metadata, nil
+}
+
+// updateGroupMetadata applies update to the stored metadata and saves it
+func updateGroupMetadata(update func(metadata map[string]GroupMetadata)) error {
+	groupMetadataMu.Lock()
+	defer groupMetadataMu.Unlock()
+
+	metadata, err := loadGroupMetadata()
+	if err != nil {
+		return err
+	}
+
+	update(metadata)
+
+	data, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(groupMetadataPath(), data, 0640)
+}
+
+// writeFileAtomic replaces a file through a temporary file in the same directory
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return fmt.Errorf("Failed to create %s: %v", filepath.Dir(path), err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("Failed to write %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", path, err)
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("Failed to write %s: %v", path, err)
+	}
+
+	return nil
+}
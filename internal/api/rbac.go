@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Permissions a route can require
+const (
+	// PermissionSelf is granted to every role, for the own account
+	PermissionSelf = "self"
+	// PermissionRead covers every read-only route
+	PermissionRead           = "read"
+	PermissionResetPasswords = "reset-passwords"
+	PermissionKillSessions   = "kill-sessions"
+	PermissionManageShares   = "manage-shares"
+	// PermissionAdmin covers everything else, including managing admins
+	PermissionAdmin = "admin"
+)
+
+// Roles of admins
+const (
+	RoleViewer        = "viewer"
+	RoleHelpdesk      = "helpdesk"
+	RoleShareOperator = "share-operator"
+	RoleAdmin         = "admin"
+)
+
+// rolePermissions lists the permissions of each role
+var rolePermissions = map[string][]string{
+	RoleViewer:        {PermissionSelf, PermissionRead},
+	RoleHelpdesk:      {PermissionSelf, PermissionRead, PermissionResetPasswords, PermissionKillSessions},
+	RoleShareOperator: {PermissionSelf, PermissionRead, PermissionManageShares},
+	RoleAdmin: {PermissionSelf, PermissionRead, PermissionResetPasswords, PermissionKillSessions,
+		PermissionManageShares, PermissionAdmin},
+}
+
+// MeResponse describes the authenticated admin so the GUI can hide actions
+type MeResponse struct {
+	Username           string   `json:"username"`
+	Role               string   `json:"role"`
+	Permissions        []string `json:"permissions"`
+	MustChangePassword bool     `json:"mustChangePassword"`
+}
+
+// AdminRoleRequest represents a request to change the role of an admin
+type AdminRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// adminContextKey stores the authenticated admin in a request context
+type adminContextKey struct{}
+
+// GetMe returns the authenticated admin with its role and permissions
+func (h *APIHandler) GetMe(w http.ResponseWriter, r *http.Request) {
+	admin, ok := requestAdmin(r)
+	if !ok {
+		writeError(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	role := effectiveRole(admin.Role)
+	json.NewEncoder(w).Encode(MeResponse{
+		Username:           admin.Username,
+		Role:               role,
+		Permissions:        rolePermissions[role],
+		MustChangePassword: admin.MustChangePassword,
+	})
+}
+
+// SetAdminRole changes the role of an admin
+func (h *APIHandler) SetAdminRole(w http.ResponseWriter, r *http.Request) {
+	username := getRouteParam(regexp.MustCompile(`^/admins/([^/]+)/role$`), r.URL.Path, 1)
+
+	var request AdminRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateRole(request.Role); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, exists := lookupAdmin(username); !exists {
+		writeError(w, fmt.Sprintf("Admin %s does not exist", username), http.StatusNotFound)
+		return
+	}
+
+	err := SetAdminRole(username, request.Role)
+	recordAudit(r, "admin.role", username, request.Role, err)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Admin %s is now %s", username, request.Role),
+	})
+}
+
+// withAdmin returns a request carrying the authenticated admin
+func withAdmin(r *http.Request, admin Admin) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), adminContextKey{}, admin))
+}
+
+// requestAdmin returns the admin that authenticated a request
+func requestAdmin(r *http.Request) (Admin, bool) {
+	admin, ok := r.Context().Value(adminContextKey{}).(Admin)
+	return admin, ok
+}
+
+// effectiveRole maps the empty role of admins stored before roles existed
+// to full admin
+func effectiveRole(role string) string {
+	if role == "" {
+		return RoleAdmin
+	}
+	return role
+}
+
+// roleAllows reports whether a role grants a permission. Routes without a
+// permission are reserved to full admins.
+func roleAllows(role, permission string) bool {
+	if permission == "" {
+		permission = PermissionAdmin
+	}
+	return containsString(rolePermissions[effectiveRole(role)], permission)
+}
+
+// validateRole checks that a role exists
+func validateRole(role string) error {
+	if _, ok := rolePermissions[role]; !ok {
+		roles := make([]string, 0, len(rolePermissions))
+		for name := range rolePermissions {
+			roles = append(roles, name)
+		}
+		sort.Strings(roles)
+		return fmt.Errorf("Invalid role '%s', must be one of %s", role, strings.Join(roles, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestEveryRouteHasAPermission(t *testing.T) {
+	for _, route := range NewAPIHandler().routes {
+		if !containsString(rolePermissions[RoleAdmin], route.Permission) {
+			t.Errorf("%s %s has unknown permission %q", route.Method, route.Pattern, route.Permission)
+		}
+	}
+}
+
+func TestRolePermissions(t *testing.T) {
+	_, h := newTestAPI(t)
+	for _, admin := range [][2]string{{"viewer1", RoleViewer}, {"helpdesk1", RoleHelpdesk}, {"shareop1", RoleShareOperator}} {
+		if err := AddAdmin(admin[0], "R0le-secret", admin[1], false); err != nil {
+			t.Fatalf("add %s: %v", admin[0], err)
+		}
+	}
+
+	tests := []struct {
+		admin   string
+		method  string
+		path    string
+		body    string
+		allowed bool
+	}{
+		{"viewer1", http.MethodGet, "/api/shares", "", true},
+		{"viewer1", http.MethodGet, "/api/sessions", "", true},
+		{"viewer1", http.MethodPost, "/api/users/alice/password", `{"password": "N3w-secret"}`, false},
+		{"viewer1", http.MethodPost, "/api/restart", "", false},
+		{"viewer1", http.MethodGet, "/api/admins", "", false},
+		{"viewer1", http.MethodPost, "/api/admins/operator/password", `{"password": "N3w-secret"}`, false},
+		{"helpdesk1", http.MethodPost, "/api/users/alice/password", `{"password": "N3w-secret"}`, true},
+		{"helpdesk1", http.MethodDelete, "/api/sessions/4100", "", true},
+		{"helpdesk1", http.MethodPost, "/api/shares/public", `{"path": "/srv/public"}`, false},
+		{"helpdesk1", http.MethodDelete, "/api/users/alice", "", false},
+		{"shareop1", http.MethodPost, "/api/shares/public", `{"path": "/srv/public"}`, true},
+		{"shareop1", http.MethodPost, "/api/shares/public/disconnect", "", false},
+		{"helpdesk1", http.MethodPost, "/api/shares/public/disconnect", "", true},
+		{"shareop1", http.MethodDelete, "/api/sessions/4100", "", false},
+		{"shareop1", http.MethodPost, "/api/config/raw", `{"content": ""}`, false},
+	}
+	for _, tt := range tests {
+		rec := serveAuthenticated(h, tt.method, tt.path, tt.body, tt.admin, "R0le-secret")
+		if forbidden := rec.Code == http.StatusForbidden; forbidden == tt.allowed {
+			t.Errorf("%s %s as %s: status = %d; body: %s", tt.method, tt.path, tt.admin, rec.Code, rec.Body.String())
+		}
+	}
+
+	// Every role can see itself and change its own password
+	var me MeResponse
+	decode(t, serveAuthenticated(h, http.MethodGet, "/api/me", "", "viewer1", "R0le-secret"), &me)
+	if me.Role != RoleViewer || containsString(me.Permissions, PermissionKillSessions) {
+		t.Errorf("me = %+v", me)
+	}
+	rec := serveAuthenticated(h, http.MethodPost, "/api/admins/viewer1/password", `{"currentPassword": "R0le-secret", "password": "V1ewer-secret"}`, "viewer1", "R0le-secret")
+	if rec.Code != http.StatusOK {
+		t.Errorf("own password: status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLastFullAdminKeepsRole(t *testing.T) {
+	newTestAPI(t)
+
+	if err := SetAdminRole("admin", RoleViewer); err != nil {
+		t.Fatalf("demote admin: %v", err)
+	}
+	if err := SetAdminRole("operator", RoleHelpdesk); err == nil {
+		t.Error("demoted the last full admin")
+	}
+	if err := RemoveAdmin("operator"); err == nil {
+		t.Error("removed the last full admin")
+	}
+	if err := RemoveAdmin("admin"); err != nil {
+		t.Errorf("remove viewer: %v", err)
+	}
+}
+
+func TestRequestsWithoutAdminAreRefused(t *testing.T) {
+	fake, h := newTestAPI(t)
+
+	requests := []struct{ method, path, body string }{
+		{http.MethodGet, "/status", ""},
+		{http.MethodGet, "/me", ""},
+		{http.MethodPost, "/users/alice/password", `{"password": "N3w-secret"}`},
+		{http.MethodPost, "/admins/operator/password", `{"password": "N3w-secret"}`},
+	}
+	for _, req := range requests {
+		// Even with credentials, a request that skipped the middleware has
+		// no admin in its context
+		request := httptest.NewRequest(req.method, req.path, strings.NewReader(req.body))
+		request.SetBasicAuth("operator", "Operat0r-pass")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, request)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s %s: status = %d, want 401; body: %s", req.method, req.path, rec.Code, rec.Body.String())
+		}
+	}
+
+	// The password change handler refuses on its own as well
+	request := httptest.NewRequest(http.MethodPost, "/admins/operator/password", strings.NewReader(`{"password": "N3w-secret"}`))
+	request.SetBasicAuth("operator", "Operat0r-pass")
+	rec := httptest.NewRecorder()
+	h.ChangeAdminPassword(rec, request)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("ChangeAdminPassword: status = %d, want 401", rec.Code)
+	}
+
+	if fake.Passwords["alice"] != "Secret123!" {
+		t.Errorf("password of alice = %q", fake.Passwords["alice"])
+	}
+	if _, ok := authenticateAdmin("operator", "Operat0r-pass"); !ok {
+		t.Errorf("password of operator was changed")
+	}
+}
@@ -0,0 +1,558 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RenameRequest represents a request to rename a user or group
+type RenameRequest struct {
+	NewName string `json:"newName"`
+}
+
+// RenameStep reports the outcome of one step of a rename
+type RenameStep struct {
+	Step   string `json:"step"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// RenameResponse represents the response for a rename
+type RenameResponse struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message,omitempty"`
+	Steps   []RenameStep `json:"steps"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Rename step outcomes
+const (
+	StepDone    = "done"
+	StepSkipped = "skipped"
+	StepFailed  = "failed"
+)
+
+// userListParams are the smb.conf parameters that hold user names
+var userListParams = map[string]bool{
+	"valid users":   true,
+	"invalid users": true,
+	"read list":     true,
+	"write list":    true,
+	"admin users":   true,
+	"force user":    true,
+	"printer admin": true,
+	"username":      true,
+	"user":          true,
+	"users":         true,
+}
+
+// renameReport collects the steps of a rename
+type renameReport struct {
+	steps []RenameStep
+}
+
+func (r *renameReport) add(step, status, detail string) {
+	r.steps = append(r.steps, RenameStep{Step: step, Status: status, Detail: detail})
+}
+
+// fail records a failed step and returns its error
+func (r *renameReport) fail(step string, err error) error {
+	r.add(step, StepFailed, err.Error())
+	return fmt.Errorf("%s failed: %v", step, err)
+}
+
+// restorePassDBEntry re-imports a password hash under the name the Unix
+// account has after a failed rename, so the user can still log in, and adds
+// the outcome to the error of the failed step
+func restorePassDBEntry(report *renameReport, err error, oldName, newName, hash string) error {
+	sys := getBackend()
+
+	name := oldName
+	if _, lookupErr := sys.Accounts.LookupUser(oldName); lookupErr != nil {
+		name = newName
+	}
+	if restoreErr := sys.PassDB.ImportHash(name, hash); restoreErr != nil {
+		report.add("Restore passdb entry", StepFailed, restoreErr.Error())
+		return fmt.Errorf("%v; rollback failed, passdb entry of %s not restored: %v", err, name, restoreErr)
+	}
+	report.add("Restore passdb entry", StepDone, fmt.Sprintf("Password kept for %s", name))
+	return fmt.Errorf("%v; rolled back, passdb entry restored for %s", err, name)
+}
+
+// RenameUser renames a user everywhere it is referenced
+func (h *APIHandler) RenameUser(w http.ResponseWriter, r *http.Request) {
+	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)/rename$`), r.URL.Path, 1)
+
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkUserModifiable(username); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	var req RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateUsername(req.NewName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.NewName == username {
+		writeError(w, "New name is the same as the current name", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := getBackend().Accounts.LookupUser(username); err != nil {
+		writeError(w, fmt.Sprintf("User %s does not exist", username), http.StatusNotFound)
+		return
+	}
+
+	steps, err := renameSambaUser(username, req.NewName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if len(steps) == 0 {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(RenameResponse{
+			Status: "error",
+			Steps:  steps,
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RenameResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("User %s renamed to %s", username, req.NewName),
+		Steps:   steps,
+	})
+}
+
+// renameSambaUser renames the Unix account, passdb entry, home directory and
+// smb.conf references of a user, returning the steps taken
+func renameSambaUser(oldName, newName string) ([]RenameStep, error) {
+	sys := getBackend()
+	report := &renameReport{}
+
+	account, err := sys.Accounts.LookupUser(oldName)
+	if err != nil {
+		return nil, fmt.Errorf("User %s does not exist", oldName)
+	}
+	if _, err := sys.Accounts.LookupUser(newName); err == nil {
+		return nil, fmt.Errorf("User %s already exists", newName)
+	}
+
+	// Resolve the home directory while the old name still applies
+	oldHome, _ := resolveHomePath(account, GetHomeConfig())
+
+	// passdb has no rename, so the entry is re-created with the same hash
+	inPassDB := false
+	if users, err := sys.PassDB.ListUsers(); err == nil {
+		for _, user := range users {
+			if user == oldName {
+				inPassDB = true
+				break
+			}
+		}
+	}
+
+	var hash string
+	if inPassDB {
+		hash, err = sys.PassDB.ExportHash(oldName)
+		if err != nil {
+			return report.steps, report.fail("Export password hash", err)
+		}
+		if err := sys.PassDB.DeleteUser(oldName); err != nil {
+			return report.steps, report.fail("Remove old passdb entry", err)
+		}
+	}
+
+	if err := sys.Accounts.RenameUser(oldName, newName); err != nil {
+		err = report.fail("Rename Unix account", err)
+		if inPassDB {
+			return report.steps, restorePassDBEntry(report, err, oldName, newName, hash)
+		}
+		return report.steps, err
+	}
+	report.add("Rename Unix account", StepDone, fmt.Sprintf("%s is now %s", oldName, newName))
+
+	// Rename the user's private group along with it
+	groupRenamed := false
+	if group, err := findGroupByGID(account.GID); err == nil && group.Name == oldName {
+		if err := sys.Accounts.RenameGroup(oldName, newName); err != nil {
+			report.add("Rename private group", StepFailed, err.Error())
+		} else {
+			report.add("Rename private group", StepDone, "")
+			groupRenamed = true
+		}
+	}
+
+	if inPassDB {
+		if err := sys.PassDB.ImportHash(newName, hash); err != nil {
+			err = report.fail("Rename passdb entry", err)
+
+			// Undo the account rename so the old name keeps working
+			if groupRenamed {
+				if err := sys.Accounts.RenameGroup(newName, oldName); err != nil {
+					report.add("Undo private group rename", StepFailed, err.Error())
+				} else {
+					report.add("Undo private group rename", StepDone, "")
+				}
+			}
+			if err := sys.Accounts.RenameUser(newName, oldName); err != nil {
+				report.add("Undo Unix account rename", StepFailed, err.Error())
+			} else {
+				report.add("Undo Unix account rename", StepDone, fmt.Sprintf("%s is %s again", newName, oldName))
+			}
+			return report.steps, restorePassDBEntry(report, err, oldName, newName, hash)
+		}
+		report.add("Rename passdb entry", StepDone, "Password kept")
+	} else {
+		report.add("Rename passdb entry", StepSkipped, "User is not in passdb")
+	}
+
+	renameHomeDirectory(report, account, newName, oldHome)
+
+	if err := rewriteConfigUserReferences(report, oldName, newName); err != nil {
+		return report.steps, err
+	}
+
+	report.add("Update ACLs", StepSkipped, "ACL entries refer to the UID and follow the rename")
+
+	return report.steps, nil
+}
+
+// renameHomeDirectory moves the home directory to the path for the new name
+// and updates the passwd entry; failures are reported but not fatal
+func renameHomeDirectory(report *renameReport, account Account, newName, oldHome string) {
+	sys := getBackend()
+	const step = "Move home directory"
+
+	// A passwd home named after the user follows the rename
+	renamed := account
+	renamed.Name = newName
+	if account.Home != "" && filepath.Base(account.Home) == account.Name {
+		renamed.Home = filepath.Join(filepath.Dir(account.Home), newName)
+	}
+	newHome, err := resolveHomePath(renamed, GetHomeConfig())
+
+	switch {
+	case oldHome == "" || err != nil:
+		report.add(step, StepSkipped, "Home directory could not be resolved")
+	case oldHome == newHome:
+		report.add(step, StepSkipped, "Home directory does not depend on the user name")
+	default:
+		if _, err := sys.Files.Stat(oldHome); err != nil {
+			report.add(step, StepSkipped, fmt.Sprintf("%s does not exist", oldHome))
+		} else if uid, err := pathOwner(oldHome); err != nil || uid != account.UID {
+			report.add(step, StepSkipped, fmt.Sprintf("%s is not owned by %s", oldHome, account.Name))
+		} else if _, err := sys.Files.Stat(newHome); err == nil {
+			report.add(step, StepFailed, fmt.Sprintf("%s already exists", newHome))
+		} else if err := sys.Files.Rename(oldHome, newHome); err != nil {
+			report.add(step, StepFailed, err.Error())
+		} else {
+			report.add(step, StepDone, fmt.Sprintf("%s moved to %s", oldHome, newHome))
+		}
+	}
+
+	if renamed.Home != account.Home {
+		if err := sys.Accounts.SetUserHome(newName, renamed.Home); err != nil {
+			report.add("Update passwd home", StepFailed, err.Error())
+		} else {
+			report.add("Update passwd home", StepDone, renamed.Home)
+		}
+	}
+}
+
+// rewriteConfigUserReferences replaces the user in every smb.conf user list
+// and in the username map
+func rewriteConfigUserReferences(report *renameReport, oldName, newName string) error {
+	config, changed, err := rewriteConfigLists(report, func(param, value string) (string, bool) {
+		if !userListParams[param] {
+			return value, false
+		}
+		return replaceListMember(value, oldName, newName)
+	})
+	if err != nil {
+		return err
+	}
+
+	mapFile := config["global"]["username map"]
+	mapChanged := false
+	if mapFile == "" {
+		report.add("Update username map", StepSkipped, "No username map configured")
+	} else if mapChanged, err = renameInUsernameMap(mapFile, oldName, newName); err != nil {
+		report.add("Update username map", StepFailed, err.Error())
+	} else if mapChanged {
+		report.add("Update username map", StepDone, mapFile)
+	} else {
+		report.add("Update username map", StepSkipped, "No references found")
+	}
+
+	if changed || mapChanged {
+		reloadAfterRename(report)
+	}
+
+	return nil
+}
+
+// rewriteConfigLists applies replace to every smb.conf parameter and saves
+// the configuration if anything changed
+func rewriteConfigLists(report *renameReport, replace func(param, value string) (string, bool)) (SambaConfig, bool, error) {
+	config, err := ReadConfig()
+	if err != nil {
+		return nil, false, report.fail("Update smb.conf", err)
+	}
+
+	var changed []string
+	for sectionName, section := range config {
+		for param, value := range section {
+			if updated, ok := replace(strings.ToLower(param), value); ok {
+				section[param] = updated
+				changed = append(changed, fmt.Sprintf("[%s] %s", sectionName, param))
+			}
+		}
+	}
+
+	if len(changed) == 0 {
+		report.add("Update smb.conf", StepSkipped, "No references found")
+		return config, false, nil
+	}
+
+	if err := WriteConfig(config); err != nil {
+		return nil, false, report.fail("Update smb.conf", err)
+	}
+	sort.Strings(changed)
+	report.add("Update smb.conf", StepDone, strings.Join(changed, ", "))
+
+	return config, true, nil
+}
+
+// reloadAfterRename makes Samba pick up rewritten references
+func reloadAfterRename(report *renameReport) {
+	action, queued, err := queueServiceAction(ServiceActionReload)
+	switch {
+	case err != nil:
+		report.add("Reload Samba", StepFailed, err.Error())
+	case queued:
+		report.add("Reload Samba", StepDone, action+" scheduled")
+	default:
+		report.add("Reload Samba", StepDone, action)
+	}
+}
+
+// listTokenRegex matches one entry of a comma or space separated list
+var listTokenRegex = regexp.MustCompile(`"[^"]*"|[^,\s]+`)
+
+// replaceListMember replaces exact occurrences of oldName in a Samba list,
+// leaving separators and @group/+group/&group entries untouched
+func replaceListMember(value, oldName, newName string) (string, bool) {
+	changed := false
+	updated := listTokenRegex.ReplaceAllStringFunc(value, func(token string) string {
+		if strings.Trim(token, `"`) != oldName {
+			return token
+		}
+		changed = true
+		if strings.HasPrefix(token, `"`) {
+			return `"` + newName + `"`
+		}
+		return newName
+	})
+	return updated, changed
+}
+
+// groupPrefixRegex matches the @, + and & group markers of a list entry
+var groupPrefixRegex = regexp.MustCompile(`^[@+&]+`)
+
+// replaceListGroup replaces @group, +group and &group entries naming oldName
+// in a Samba list, keeping their prefix
+func replaceListGroup(value, oldName, newName string) (string, bool) {
+	changed := false
+	updated := listTokenRegex.ReplaceAllStringFunc(value, func(token string) string {
+		quoted := strings.HasPrefix(token, `"`)
+		name := strings.Trim(token, `"`)
+		prefix := groupPrefixRegex.FindString(name)
+		if prefix == "" || name[len(prefix):] != oldName {
+			return token
+		}
+		changed = true
+		if quoted {
+			return `"` + prefix + newName + `"`
+		}
+		return prefix + newName
+	})
+	return updated, changed
+}
+
+// renameInUsernameMap renames the Unix side of username map entries
+func renameInUsernameMap(path, oldName, newName string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("Failed to read username map: %v", err)
+	}
+
+	lines := strings.Split(string(data), "\n")
+	changed := false
+	for i, line := range lines {
+		eq := strings.Index(line, "=")
+		trimmed := strings.TrimSpace(line)
+		if eq < 0 || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") {
+			continue
+		}
+
+		// "!" marks a final mapping and stays in place
+		unixName := strings.TrimSpace(line[:eq])
+		prefix := ""
+		if strings.HasPrefix(unixName, "!") {
+			prefix = "!"
+			unixName = strings.TrimSpace(unixName[1:])
+		}
+		if unixName != oldName {
+			continue
+		}
+
+		lines[i] = prefix + newName + " =" + line[eq+1:]
+		changed = true
+	}
+
+	if !changed {
+		return false, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	// smbd rereads the map at every login, so it must never see a partial file
+	if err := writeFileAtomic(path, []byte(strings.Join(lines, "\n")), info.Mode().Perm()); err != nil {
+		return false, fmt.Errorf("Failed to write username map: %v", err)
+	}
+
+	return true, nil
+}
+
+// RenameGroup renames a group and its references in smb.conf
+func (h *APIHandler) RenameGroup(w http.ResponseWriter, r *http.Request) {
+	groupName := getRouteParam(regexp.MustCompile(`^/groups/([^/]+)/rename$`), r.URL.Path, 1)
+
+	if err := validateGroupName(groupName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var req RenameRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if err := validateGroupName(req.NewName); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.NewName == groupName {
+		writeError(w, "New name is the same as the current name", http.StatusBadRequest)
+		return
+	}
+
+	group, err := getBackend().Accounts.LookupGroup(groupName)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Group %s does not exist", groupName), http.StatusNotFound)
+		return
+	}
+	if err := checkGroupModifiable(group.Name); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	steps, err := renameSambaGroup(groupName, req.NewName)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if len(steps) == 0 {
+			status = http.StatusConflict
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(RenameResponse{
+			Status: "error",
+			Steps:  steps,
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(RenameResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Group %s renamed to %s", groupName, req.NewName),
+		Steps:   steps,
+	})
+}
+
+// renameSambaGroup renames the Unix group, its metadata and its smb.conf
+// references, returning the steps taken
+func renameSambaGroup(oldName, newName string) ([]RenameStep, error) {
+	sys := getBackend()
+	report := &renameReport{}
+
+	if _, err := sys.Accounts.LookupGroup(newName); err == nil {
+		return nil, fmt.Errorf("Group %s already exists", newName)
+	}
+
+	if err := sys.Accounts.RenameGroup(oldName, newName); err != nil {
+		return report.steps, report.fail("Rename Unix group", err)
+	}
+	report.add("Rename Unix group", StepDone, fmt.Sprintf("%s is now %s", oldName, newName))
+
+	// Group mappings refer to the GID and follow the rename
+	err := updateGroupMetadata(func(metadata map[string]GroupMetadata) {
+		if entry, ok := metadata[oldName]; ok {
+			metadata[newName] = entry
+			delete(metadata, oldName)
+		}
+	})
+	if err != nil {
+		report.add("Move group metadata", StepFailed, err.Error())
+	} else {
+		report.add("Move group metadata", StepDone, "")
+	}
+
+	_, changed, err := rewriteConfigLists(report, func(param, value string) (string, bool) {
+		switch {
+		case userListParams[param]:
+			return replaceListGroup(value, oldName, newName)
+		case param == "force group" || param == "group":
+			// force group takes a bare name with an optional + prefix
+			name := strings.TrimPrefix(value, "+")
+			if name != oldName {
+				return value, false
+			}
+			return strings.TrimSuffix(value, name) + newName, true
+		}
+		return value, false
+	})
+	if err != nil {
+		return report.steps, err
+	}
+
+	if changed {
+		reloadAfterRename(report)
+	}
+
+	return report.steps, nil
+}
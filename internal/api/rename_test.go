@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplaceListMember(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		changed bool
+	}{
+		{"alice, bob", "alicia, bob", true},
+		{"bob alice", "bob alicia", true},
+		{`"alice",@alice`, `"alicia",@alice`, true},
+		{"+alice &alice alice2", "+alice &alice alice2", false},
+	}
+	for _, tc := range tests {
+		got, changed := replaceListMember(tc.value, "alice", "alicia")
+		if got != tc.want || changed != tc.changed {
+			t.Errorf("replaceListMember(%q) = %q, %v; want %q, %v", tc.value, got, changed, tc.want, tc.changed)
+		}
+	}
+}
+
+func TestRenameUserUpdatesUsernameMap(t *testing.T) {
+	fake, h := newTestAPI(t)
+
+	mapFile := filepath.Join(t.TempDir(), "smbusers")
+	if err := os.WriteFile(mapFile, []byte("# map\n!alice = ALICE \"Alice Smith\"\nbob = robert\n"), 0644); err != nil {
+		t.Fatalf("write map: %v", err)
+	}
+	config, _ := ReadConfig()
+	config["global"]["username map"] = mapFile
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	rec := serve(h, http.MethodPost, "/users/alice/rename", `{"newName": "alicia"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp RenameResponse
+	decode(t, rec, &resp)
+	steps := make(map[string]string)
+	for _, step := range resp.Steps {
+		steps[step.Step] = step.Status
+	}
+	for _, step := range []string{"Rename Unix account", "Rename private group", "Rename passdb entry", "Move home directory", "Update smb.conf", "Update username map"} {
+		if steps[step] != StepDone {
+			t.Errorf("step %q = %q", step, steps[step])
+		}
+	}
+
+	data, _ := os.ReadFile(mapFile)
+	if want := "# map\n!alicia = ALICE \"Alice Smith\"\nbob = robert\n"; string(data) != want {
+		t.Errorf("username map = %q", data)
+	}
+	if _, ok := fake.Groups["alicia"]; !ok {
+		t.Errorf("private group not renamed")
+	}
+	if fake.Accounts["alicia"].Home != "/home/alicia" {
+		t.Errorf("passwd home = %q", fake.Accounts["alicia"].Home)
+	}
+}
+
+func TestReplaceListGroup(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		changed bool
+	}{
+		{"alice, @staff", "alice, @team", true},
+		{"+staff &staff +&staff", "+team &team +&team", true},
+		{`"@staff" staff @staffers`, `"@team" staff @staffers`, true},
+		{"staff", "staff", false},
+	}
+	for _, tc := range tests {
+		got, changed := replaceListGroup(tc.value, "staff", "team")
+		if got != tc.want || changed != tc.changed {
+			t.Errorf("replaceListGroup(%q) = %q, %v; want %q, %v", tc.value, got, changed, tc.want, tc.changed)
+		}
+	}
+}
+
+func TestRenameGroupMovesMetadata(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	if err := setGroupDescription("staff", "All staff"); err != nil {
+		t.Fatalf("set description: %v", err)
+	}
+	config, _ := ReadConfig()
+	config["public"]["force group"] = "+staff"
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	rec := serve(h, http.MethodPost, "/groups/staff/rename", `{"newName": "team"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	metadata, _ := loadGroupMetadata()
+	if _, ok := metadata["staff"]; ok || metadata["team"].Description != "All staff" {
+		t.Errorf("metadata = %+v", metadata)
+	}
+	config, _ = ReadConfig()
+	if config["public"]["force group"] != "+team" {
+		t.Errorf("force group = %q", config["public"]["force group"])
+	}
+}
+
+func TestRenameUserRestoresPassDBWhenAccountRenameFails(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Failures["RenameUser alice"] = errors.New("usermod: user alice is currently used by process 4100")
+
+	rec := serve(h, http.MethodPost, "/users/alice/rename", `{"newName": "alicia"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp RenameResponse
+	decode(t, rec, &resp)
+	if !strings.Contains(resp.Error, "rolled back, passdb entry restored for alice") {
+		t.Errorf("error = %q", resp.Error)
+	}
+	if fake.Passwords["alice"] != "Secret123!" {
+		t.Errorf("passdb entry of alice = %q", fake.Passwords["alice"])
+	}
+	if _, ok := fake.Accounts["alice"]; !ok {
+		t.Errorf("Unix account alice is gone")
+	}
+}
+
+func TestRenameUserUndoesAccountRenameWhenPassDBImportFails(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Failures["ImportHash alicia"] = errors.New("pdbedit: failed to add entry")
+
+	rec := serve(h, http.MethodPost, "/users/alice/rename", `{"newName": "alicia"}`)
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp RenameResponse
+	decode(t, rec, &resp)
+	if !strings.Contains(resp.Error, "rolled back, passdb entry restored for alice") {
+		t.Errorf("error = %q", resp.Error)
+	}
+	if fake.Passwords["alice"] != "Secret123!" {
+		t.Errorf("passdb entry of alice = %q", fake.Passwords["alice"])
+	}
+	if _, ok := fake.Accounts["alice"]; !ok {
+		t.Errorf("Unix account was not renamed back")
+	}
+	if _, ok := fake.Groups["alice"]; !ok {
+		t.Errorf("private group was not renamed back")
+	}
+}
+
+func TestRenameUserReportsFailedRollback(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Failures["RenameUser alice"] = errors.New("usermod failed")
+	fake.Failures["ImportHash alice"] = errors.New("pdbedit failed")
+
+	rec := serve(h, http.MethodPost, "/users/alice/rename", `{"newName": "alicia"}`)
+	var resp RenameResponse
+	decode(t, rec, &resp)
+	if !strings.Contains(resp.Error, "rollback failed") {
+		t.Errorf("error = %q", resp.Error)
+	}
+}
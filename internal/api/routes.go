@@ -1,6 +1,7 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
 	"regexp"
 )
@@ -10,6 +11,8 @@ type Route struct {
 	Pattern *regexp.Regexp
 	Method  string
 	Handler http.HandlerFunc
+	// Permission is the permission an admin's role needs to use the route
+	Permission string
 }
 
 // APIHandler handles all API requests
@@ -46,6 +49,17 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		if route.Pattern.MatchString(r.URL.Path) {
 			// Match the HTTP method
 			if route.Method == r.Method || route.Method == "*" {
+				// Requests authenticated by BasicAuthMiddleware carry the admin,
+				// anything else is refused
+				admin, ok := requestAdmin(r)
+				if !ok {
+					writeError(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				if !roleAllows(admin.Role, route.Permission) {
+					writeError(w, fmt.Sprintf("Role %s does not have the %s permission", effectiveRole(admin.Role), route.Permission), http.StatusForbidden)
+					return
+				}
 				route.Handler(w, r)
 				return
 			}
@@ -60,143 +74,427 @@ func (h *APIHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) registerRoutes() {
 	// Shares routes
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/shares$`),
-		Method:  http.MethodGet,
-		Handler: h.GetShares,
+		Pattern:    regexp.MustCompile(`^/shares$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetShares,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/shares/([^/]+)$`),
-		Method:  http.MethodGet,
-		Handler: h.GetShare,
+		Pattern:    regexp.MustCompile(`^/shares/([^/]+)$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetShare,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/shares/([^/]+)$`),
-		Method:  http.MethodPost,
-		Handler: h.CreateUpdateShare,
+		Pattern:    regexp.MustCompile(`^/shares/([^/]+)$`),
+		Method:     http.MethodPost,
+		Handler:    h.CreateUpdateShare,
+		Permission: PermissionManageShares,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/shares/([^/]+)$`),
-		Method:  http.MethodDelete,
-		Handler: h.DeleteShare,
+		Pattern:    regexp.MustCompile(`^/shares/([^/]+)$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DeleteShare,
+		Permission: PermissionManageShares,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/shares/([^/]+)/acl$`),
-		Method:  http.MethodGet,
-		Handler: h.GetShareACLs,
+		Pattern:    regexp.MustCompile(`^/shares/([^/]+)/acl$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetShareACLs,
+		Permission: PermissionRead,
 	})
 
 	// Users routes
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/users$`),
-		Method:  http.MethodGet,
-		Handler: h.GetUsers,
+		Pattern:    regexp.MustCompile(`^/users$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetUsers,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/users/([^/]+)$`),
-		Method:  http.MethodPost,
-		Handler: h.CreateUser,
+		Pattern:    regexp.MustCompile(`^/users/homes$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetHomeDirectories,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/users/([^/]+)$`),
-		Method:  http.MethodDelete,
-		Handler: h.DeleteUser,
+		Pattern:    regexp.MustCompile(`^/users/([^/]+)$`),
+		Method:     http.MethodPost,
+		Handler:    h.CreateUser,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/users/([^/]+)/password$`),
-		Method:  http.MethodPost,
-		Handler: h.ChangePassword,
+		Pattern:    regexp.MustCompile(`^/users/([^/]+)$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DeleteUser,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-    Pattern: regexp.MustCompile(`^/users/([^/]+)/home$`),
-    Method:  http.MethodPost,
-    Handler: h.CreateUserHomeDirectory,
+		Pattern:    regexp.MustCompile(`^/users/([^/]+)/password$`),
+		Method:     http.MethodPost,
+		Handler:    h.ChangePassword,
+		Permission: PermissionResetPasswords,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/users/([^/]+)/shares$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetUserShares,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/users/([^/]+)/rename$`),
+		Method:     http.MethodPost,
+		Handler:    h.RenameUser,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+    Pattern:    regexp.MustCompile(`^/users/([^/]+)/home$`),
+    Method:     http.MethodPost,
+    Handler:    h.CreateUserHomeDirectory,
+    Permission: PermissionAdmin,
 	})
 
 	// Group routes
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/groups$`),
-		Method:  http.MethodGet,
-		Handler: h.GetGroups,
+		Pattern:    regexp.MustCompile(`^/groups$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetGroups,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/mappings$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetGroupMappings,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)$`),
+		Method:     http.MethodPost,
+		Handler:    h.CreateGroup,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DeleteGroup,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`),
+		Method:     http.MethodPost,
+		Handler:    h.AddUserToGroup,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/groups/([^/]+)$`),
-		Method:  http.MethodPost,
-		Handler: h.CreateGroup,
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`),
+		Method:     http.MethodDelete,
+		Handler:    h.RemoveUserFromGroup,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/groups/([^/]+)$`),
-		Method:  http.MethodDelete,
-		Handler: h.DeleteGroup,
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/users$`),
+		Method:     http.MethodPut,
+		Handler:    h.SetGroupUsers,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`),
-		Method:  http.MethodPost,
-		Handler: h.AddUserToGroup,
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/impact$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetGroupImpact,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/groups/([^/]+)/users/([^/]+)$`),
-		Method:  http.MethodDelete,
-		Handler: h.RemoveUserFromGroup,
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/rename$`),
+		Method:     http.MethodPost,
+		Handler:    h.RenameGroup,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/description$`),
+		Method:     http.MethodPost,
+		Handler:    h.SetGroupDescription,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/mapping$`),
+		Method:     http.MethodPost,
+		Handler:    h.CreateGroupMapping,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/groups/([^/]+)/mapping$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DeleteGroupMapping,
+		Permission: PermissionAdmin,
 	})
 
 	// Unified Configuration API
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config$`),
-		Method:  http.MethodGet,
-		Handler: h.GetConfig,
+		Pattern:    regexp.MustCompile(`^/config$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetConfig,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/config$`),
+		Method:     http.MethodPost,
+		Handler:    h.UpdateConfig,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config$`),
-		Method:  http.MethodPost,
-		Handler: h.UpdateConfig,
+		Pattern:    regexp.MustCompile(`^/config/sections/([^/]+)$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetSection,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config/sections/([^/]+)$`),
-		Method:  http.MethodGet,
-		Handler: h.GetSection,
+		Pattern:    regexp.MustCompile(`^/config/sections/([^/]+)$`),
+		Method:     http.MethodPost,
+		Handler:    h.UpdateSection,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config/sections/([^/]+)$`),
-		Method:  http.MethodPost,
-		Handler: h.UpdateSection,
+		Pattern:    regexp.MustCompile(`^/config/sections/([^/]+)$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DeleteSection,
+		Permission: PermissionAdmin,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config/sections/([^/]+)$`),
-		Method:  http.MethodDelete,
-		Handler: h.DeleteSection,
+		Pattern:    regexp.MustCompile(`^/config/raw$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetRawConfig,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config/raw$`),
-		Method:  http.MethodGet,
-		Handler: h.GetRawConfig,
+		Pattern:    regexp.MustCompile(`^/config/raw$`),
+		Method:     http.MethodPost,
+		Handler:    h.SaveRawConfig,
+		Permission: PermissionAdmin,
+	})
+
+	// Username map routes
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/usermap$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetUsernameMap,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/config/raw$`),
-		Method:  http.MethodPost,
-		Handler: h.SaveRawConfig,
+		Pattern:    regexp.MustCompile(`^/usermap$`),
+		Method:     http.MethodPost,
+		Handler:    h.UpdateUsernameMap,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/usermap/validate$`),
+		Method:     http.MethodPost,
+		Handler:    h.ValidateUsernameMap,
+		Permission: PermissionAdmin,
 	})
 
 	// Service routes
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/status$`),
-		Method:  http.MethodGet,
-		Handler: h.GetServiceStatus,
+		Pattern:    regexp.MustCompile(`^/status$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetServiceStatus,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/health$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetHealth,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/restart$`),
+		Method:     http.MethodPost,
+		Handler:    h.RestartService,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/reload$`),
+		Method:     http.MethodPost,
+		Handler:    h.ReloadService,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/services$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetServices,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/services/[^/]+$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetService,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/services/[^/]+/(start|stop|restart|enable|disable)$`),
+		Method:     http.MethodPost,
+		Handler:    h.ControlService,
+		Permission: PermissionAdmin,
+	})
+
+	// Client routes
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/sessions$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetSessions,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/connections$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetConnections,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/open-files$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetOpenFiles,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/sessions/[^/]+$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DisconnectSession,
+		Permission: PermissionKillSessions,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/users/[^/]+/disconnect$`),
+		Method:     http.MethodPost,
+		Handler:    h.DisconnectUser,
+		Permission: PermissionKillSessions,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/shares/[^/]+/disconnect$`),
+		Method:     http.MethodPost,
+		Handler:    h.DisconnectShare,
+		Permission: PermissionKillSessions,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/open-files/close$`),
+		Method:     http.MethodPost,
+		Handler:    h.CloseOpenFile,
+		Permission: PermissionKillSessions,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/audit$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetAuditLog,
+		Permission: PermissionRead,
+	})
+
+	// Admin routes
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/me$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetMe,
+		Permission: PermissionSelf,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/admins$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetAdmins,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/admins$`),
+		Method:     http.MethodPost,
+		Handler:    h.CreateAdmin,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/admins/[^/]+$`),
+		Method:     http.MethodDelete,
+		Handler:    h.DeleteAdmin,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/admins/[^/]+/role$`),
+		Method:     http.MethodPut,
+		Handler:    h.SetAdminRole,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/admins/[^/]+/password$`),
+		Method:     http.MethodPost,
+		Handler:    h.ChangeAdminPassword,
+		Permission: PermissionSelf,
+	})
+
+	// Session history routes
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/history/shares/[^/]+$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetShareHistory,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/history/peak$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetPeakUsage,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/history/clients$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetClientHistory,
+		Permission: PermissionRead,
+	})
+
+	// Debug level routes
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/debug$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetDebugOverrides,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/debug$`),
+		Method:     http.MethodPost,
+		Handler:    h.SetDebugLevel,
+		Permission: PermissionAdmin,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/debug/[^/]+$`),
+		Method:     http.MethodDelete,
+		Handler:    h.RevertDebugLevel,
+		Permission: PermissionAdmin,
+	})
+
+	// Log routes
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/logs$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetLogs,
+		Permission: PermissionRead,
+	})
+	h.routes = append(h.routes, Route{
+		Pattern:    regexp.MustCompile(`^/logs/sources$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetLogSources,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/restart$`),
-		Method:  http.MethodPost,
-		Handler: h.RestartService,
+		Pattern:    regexp.MustCompile(`^/logs/stream$`),
+		Method:     http.MethodGet,
+		Handler:    h.StreamLogs,
+		Permission: PermissionRead,
 	})
 
 	// Storage info routes
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/storage-filesystems$`),
-		Method:  http.MethodGet,
-		Handler: h.GetFileSystemSizes,
+		Pattern:    regexp.MustCompile(`^/storage-filesystems$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetFileSystemSizes,
+		Permission: PermissionRead,
 	})
 	h.routes = append(h.routes, Route{
-		Pattern: regexp.MustCompile(`^/storage-shares$`),
-		Method:  http.MethodGet,
-		Handler: h.GetShareSizes,
+		Pattern:    regexp.MustCompile(`^/storage-shares$`),
+		Method:     http.MethodGet,
+		Handler:    h.GetShareSizes,
+		Permission: PermissionRead,
 	})
 }
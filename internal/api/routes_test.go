@@ -0,0 +1,865 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testSambaConfig = `# Test configuration
+[global]
+    workgroup = WORKGROUP
+    server string = Samba Server
+
+[public]
+    path = /srv/public
+    valid users = alice, @staff
+    write list = alice
+`
+
+// newTestAPI points the API at a fake system and a temporary smb.conf
+func newTestAPI(t *testing.T) (*FakeSystem, *APIHandler) {
+	t.Helper()
+
+	fake := NewFakeSystem()
+	fake.AddUser("alice", "Secret123!")
+	fake.AddUser("bob", "Secret456!")
+	fake.AddGroup("staff", 2000, "alice")
+	fake.AddGroup("adm", 4)
+	fake.AddGroup("winadmins", 2001)
+	fake.GroupMaps["Staff"] = GroupMapping{NTName: "Staff", SID: "S-1-5-21-1-2-3-3001", UnixGroup: "staff", Type: "domain"}
+	fake.Dirs["/srv/public"] = fakeDir{Mode: 0755}
+	fake.Disks = []DiskInfo{{Filesystem: "/dev/sda1", Size: "100G", Used: "40G", Available: "60G", UsePercent: 40, MountedOn: "/"}}
+	fake.DirSizes["/srv/public"] = "10G"
+	fake.Dirs["/home"] = fakeDir{Mode: 0755}
+	fake.Dirs["/home/alice"] = fakeDir{Mode: 0700, UID: fake.Accounts["alice"].UID, GID: fake.Accounts["alice"].GID}
+	fake.Dirs["/home/ghost"] = fakeDir{Mode: 0700, UID: 4242, GID: 4242}
+	fake.Clients = SambaStatus{
+		Sessions:    []SambaSession{{PID: "4100", User: "alice", Group: "alice", ClientIP: "192.168.1.10", Protocol: "SMB3_11", Encryption: "-", Signing: "-"}},
+		Connections: []TreeConnect{{Share: "public", PID: "4100", ClientIP: "192.168.1.10", Encryption: "-", Signing: "-"}},
+		OpenFiles:   []OpenFile{{PID: "4100", UID: fake.Accounts["alice"].UID, SharePath: "/srv/public", Name: "notes.txt", DenyMode: "DENY_NONE", Access: "RDWR", Lock: "NONE"}},
+	}
+
+	dir := t.TempDir()
+	mapFile := filepath.Join(dir, "smbusers")
+	if err := os.WriteFile(mapFile, []byte("# Test username map\n!alice = ALICE\n"), 0644); err != nil {
+		t.Fatalf("write username map: %v", err)
+	}
+
+	configFile := filepath.Join(dir, "smb.conf")
+	config := strings.Replace(testSambaConfig, "[global]\n", "[global]\n    username map = "+mapFile+"\n", 1)
+	if err := os.WriteFile(configFile, []byte(config), 0644); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	SetBackend(fake.Backend())
+	SetConfigPath(configFile)
+	SetDataDir(filepath.Join(dir, "data"))
+	SetAuthConfig("admin", "admin")
+	adminHashCost = bcrypt.MinCost
+	if err := AddAdmin("operator", "Operat0r-pass", RoleAdmin, false); err != nil {
+		t.Fatalf("add admin: %v", err)
+	}
+	resetStorageCaches()
+	resetRestartPending()
+	logStreamPollInterval, logStreamLimit = 10*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() {
+		logStreamPollInterval, logStreamLimit = time.Second, 30*time.Minute
+		SetBackend(NewSystemBackend())
+		SetConfigPath("")
+		SetDataDir("")
+		SetAuthConfig("", "")
+		adminHashCost = bcrypt.DefaultCost
+		resetStorageCaches()
+		resetRestartPending()
+		resetDebugOverrides()
+		closeHistoryDB()
+	})
+
+	return fake, NewAPIHandler()
+}
+
+// resetDebugOverrides stops and forgets every raised debug level
+func resetDebugOverrides() {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	for id, override := range debugOverrides {
+		override.timer.Stop()
+		delete(debugOverrides, id)
+	}
+}
+
+// resetRestartPending forgets configuration changes awaiting a restart
+func resetRestartPending() {
+	restartPendingMu.Lock()
+	restartPending = false
+	restartPendingMu.Unlock()
+}
+
+// resetStorageCaches invalidates the cached df/du results
+func resetStorageCaches() {
+	disksCacheMux.Lock()
+	disksCacheTime = time.Time{}
+	disksCacheMux.Unlock()
+	shareSizesCacheMux.Lock()
+	shareSizesCacheTime = time.Time{}
+	shareSizesCacheMux.Unlock()
+}
+
+// serve sends a request as the operator admin through the authentication
+// middleware and returns the recorded response
+func serve(h http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.SetBasicAuth("operator", "Operat0r-pass")
+	rec := httptest.NewRecorder()
+	BasicAuthMiddleware(h).ServeHTTP(rec, req)
+	return rec
+}
+
+// routeCase is a request against the API and its expected outcome
+type routeCase struct {
+	name   string
+	method string
+	path   string
+	body   string
+	status int
+	check  func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder)
+}
+
+// routeCases exercises every route registered in registerRoutes
+var routeCases = []routeCase{
+	// Shares
+	{
+		name: "list shares", method: http.MethodGet, path: "/shares", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var shares map[string]Share
+			decode(t, rec, &shares)
+			if shares["public"]["path"] != "/srv/public" {
+				t.Errorf("public share path = %q", shares["public"]["path"])
+			}
+		},
+	},
+	{name: "get share", method: http.MethodGet, path: "/shares/public", status: http.StatusOK},
+	{name: "get missing share", method: http.MethodGet, path: "/shares/missing", status: http.StatusNotFound},
+	{
+		name: "create share directory", method: http.MethodPost, path: "/shares/data",
+		body:   `{"path": "/srv/data", "owner": "alice", "group": "staff", "permissions": "2770", "valid users": "bob, @staff", "write list": "alice"}`,
+		status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			dir, ok := fake.Dirs["/srv/data"]
+			if !ok {
+				t.Fatalf("share directory was not created")
+			}
+			if dir.UID != fake.Accounts["alice"].UID || dir.GID != 2000 || dir.Mode != 02770 {
+				t.Errorf("directory = %+v", dir)
+			}
+			if len(fake.ACLs["/srv/data"]) != 6 {
+				t.Errorf("ACL entries = %+v", fake.ACLs["/srv/data"])
+			}
+		},
+	},
+	{name: "create share with unknown user", method: http.MethodPost, path: "/shares/data", body: `{"path": "/srv/data", "valid users": "mallory"}`, status: http.StatusBadRequest},
+	{name: "create share with option as owner", method: http.MethodPost, path: "/shares/data", body: `{"path": "/srv/data", "owner": "--help"}`, status: http.StatusBadRequest},
+	{name: "create share with relative path", method: http.MethodPost, path: "/shares/data", body: `{"path": "../etc"}`, status: http.StatusBadRequest},
+	{
+		name: "delete share", method: http.MethodDelete, path: "/shares/public", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			config, _ := ReadConfig()
+			if _, exists := config["public"]; exists {
+				t.Errorf("share still present after delete")
+			}
+			if len(fake.Closed) != 1 || fake.Closed[0] != "public" {
+				t.Errorf("closed shares = %v", fake.Closed)
+			}
+		},
+	},
+	{name: "delete missing share", method: http.MethodDelete, path: "/shares/missing", status: http.StatusNotFound},
+	{
+		name: "get share ACLs", method: http.MethodGet, path: "/shares/public/acl", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var acls ShareACLs
+			decode(t, rec, &acls)
+			if acls.Path != "/srv/public" {
+				t.Errorf("ACL path = %q", acls.Path)
+			}
+		},
+	},
+
+	// Users
+	{
+		name: "list users", method: http.MethodGet, path: "/users", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp UserListResponse
+			decode(t, rec, &resp)
+			if strings.Join(resp.Users, ",") != "alice,bob" {
+				t.Errorf("users = %v", resp.Users)
+			}
+		},
+	},
+	{
+		name: "create user", method: http.MethodPost, path: "/users/carol", body: `{"password": "Pa55word!"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if fake.Passwords["carol"] != "Pa55word!" {
+				t.Errorf("carol not added to passdb")
+			}
+			if _, ok := fake.Accounts["carol"]; !ok {
+				t.Errorf("carol not added as Unix user")
+			}
+		},
+	},
+	{
+		name: "list orphaned homes", method: http.MethodGet, path: "/users/homes", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp HomeListResponse
+			decode(t, rec, &resp)
+			if resp.BasePath != "/home" || len(resp.Homes) != 1 || resp.Homes[0].Name != "ghost" || !resp.Homes[0].Orphaned {
+				t.Errorf("homes = %+v", resp)
+			}
+		},
+	},
+	{name: "list all homes", method: http.MethodGet, path: "/users/homes?all=true", status: http.StatusOK},
+	{name: "delete user with unknown home action", method: http.MethodDelete, path: "/users/alice?home=shred", status: http.StatusBadRequest},
+	{name: "create user without password", method: http.MethodPost, path: "/users/carol", body: `{}`, status: http.StatusBadRequest},
+	{name: "create user with option name", method: http.MethodPost, path: "/users/-o", body: `{"password": "x"}`, status: http.StatusBadRequest},
+	{name: "create existing user", method: http.MethodPost, path: "/users/alice", body: `{"password": "x"}`, status: http.StatusInternalServerError},
+	{
+		name: "delete user", method: http.MethodDelete, path: "/users/bob", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if _, ok := fake.Passwords["bob"]; ok {
+				t.Errorf("bob still in passdb")
+			}
+		},
+	},
+	{
+		name: "change password", method: http.MethodPost, path: "/users/alice/password", body: `{"password": "N3wSecret!"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if fake.Passwords["alice"] != "N3wSecret!" {
+				t.Errorf("password not changed")
+			}
+		},
+	},
+	{
+		name: "user shares", method: http.MethodGet, path: "/users/alice/shares", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp UserSharesResponse
+			decode(t, rec, &resp)
+			if len(resp.Shares) != 1 || resp.Shares[0].Share != "public" || resp.Shares[0].Access != AccessWrite {
+				t.Errorf("shares = %+v", resp.Shares)
+			}
+		},
+	},
+	{
+		name: "user shares of user without access", method: http.MethodGet, path: "/users/bob/shares", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp UserSharesResponse
+			decode(t, rec, &resp)
+			if len(resp.Shares) != 0 {
+				t.Errorf("shares = %+v", resp.Shares)
+			}
+		},
+	},
+	{name: "shares of missing user", method: http.MethodGet, path: "/users/nobody/shares", status: http.StatusNotFound},
+	{
+		name: "rename user", method: http.MethodPost, path: "/users/alice/rename", body: `{"newName": "alicia"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if _, ok := fake.Accounts["alicia"]; !ok || fake.Passwords["alicia"] != "Secret123!" {
+				t.Errorf("account or password not renamed")
+			}
+			if _, ok := fake.Dirs["/home/alicia"]; !ok {
+				t.Errorf("home directory not moved")
+			}
+			config, _ := ReadConfig()
+			if config["public"]["valid users"] != "alicia, @staff" || config["public"]["write list"] != "alicia" {
+				t.Errorf("public share = %+v", config["public"])
+			}
+		},
+	},
+	{name: "rename missing user", method: http.MethodPost, path: "/users/nosuchuser/rename", body: `{"newName": "someone"}`, status: http.StatusNotFound},
+	{name: "rename user to existing name", method: http.MethodPost, path: "/users/alice/rename", body: `{"newName": "bob"}`, status: http.StatusConflict},
+	{name: "rename user to invalid name", method: http.MethodPost, path: "/users/alice/rename", body: `{"newName": "-o"}`, status: http.StatusBadRequest},
+	{
+		name: "create home directory", method: http.MethodPost, path: "/users/bob/home", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if dir, ok := fake.Dirs["/home/bob"]; !ok || dir.UID != fake.Accounts["bob"].UID {
+				t.Errorf("home directory = %+v, %v", dir, ok)
+			}
+		},
+	},
+	{name: "create existing home directory", method: http.MethodPost, path: "/users/alice/home", status: http.StatusInternalServerError},
+	{name: "create home for unknown user", method: http.MethodPost, path: "/users/mallory/home", status: http.StatusInternalServerError},
+
+	// Groups
+	{
+		name: "list groups", method: http.MethodGet, path: "/groups", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp GroupListResponse
+			decode(t, rec, &resp)
+			for _, group := range resp.Groups {
+				if group.Name == "adm" {
+					t.Errorf("system group listed without includeSystem")
+				}
+				if group.Name == "staff" && (!group.Mapped || group.Mapping.SID != "S-1-5-21-1-2-3-3001") {
+					t.Errorf("staff mapping = %+v", group.Mapping)
+				}
+			}
+		},
+	},
+	{name: "create group", method: http.MethodPost, path: "/groups/projects", status: http.StatusOK},
+	{
+		name: "create mapped group", method: http.MethodPost, path: "/groups/projects", body: `{"mapping": {"ntName": "Project Team", "comment": "Projects"}}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			mapping := fake.GroupMaps["Project Team"]
+			if mapping.UnixGroup != "projects" || mapping.Type != "domain" || mapping.SID == "" {
+				t.Errorf("mapping = %+v", mapping)
+			}
+		},
+	},
+	{name: "create group with invalid mapping", method: http.MethodPost, path: "/groups/projects", body: `{"mapping": {"type": "universal"}}`, status: http.StatusBadRequest},
+	{
+		name: "delete referenced group", method: http.MethodDelete, path: "/groups/staff", status: http.StatusConflict,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var impact GroupImpact
+			decode(t, rec, &impact)
+			if len(impact.References) != 1 || impact.References[0].Section != "public" {
+				t.Errorf("references = %+v", impact.References)
+			}
+			if _, ok := fake.Groups["staff"]; !ok {
+				t.Errorf("referenced group deleted without force")
+			}
+		},
+	},
+	{
+		name: "delete group", method: http.MethodDelete, path: "/groups/staff?force=true", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if _, ok := fake.Groups["staff"]; ok {
+				t.Errorf("group not deleted")
+			}
+			if _, ok := fake.GroupMaps["Staff"]; ok {
+				t.Errorf("mapping of deleted group kept")
+			}
+			config, _ := ReadConfig()
+			if config["public"]["valid users"] != "alice" {
+				t.Errorf("valid users = %q", config["public"]["valid users"])
+			}
+		},
+	},
+	{name: "delete primary group", method: http.MethodDelete, path: "/groups/alice?force=true", status: http.StatusConflict},
+	{
+		name: "group impact", method: http.MethodGet, path: "/groups/alice/impact", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var impact GroupImpact
+			decode(t, rec, &impact)
+			if len(impact.Blocking) != 1 || impact.References[0].Kind != GroupRefPrimary || impact.References[0].User != "alice" {
+				t.Errorf("impact = %+v", impact)
+			}
+		},
+	},
+	{name: "delete system group", method: http.MethodDelete, path: "/groups/adm", status: http.StatusForbidden},
+	{
+		name: "add user to group", method: http.MethodPost, path: "/groups/staff/users/bob", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if strings.Join(fake.Groups["staff"].Members, ",") != "alice,bob" {
+				t.Errorf("staff members = %v", fake.Groups["staff"].Members)
+			}
+		},
+	},
+	{
+		name: "remove user from group", method: http.MethodDelete, path: "/groups/staff/users/alice", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if len(fake.Groups["staff"].Members) != 0 {
+				t.Errorf("staff members = %v", fake.Groups["staff"].Members)
+			}
+		},
+	},
+	{name: "remove user from primary group", method: http.MethodDelete, path: "/groups/alice/users/alice", status: http.StatusConflict},
+	{name: "remove non-member from group", method: http.MethodDelete, path: "/groups/staff/users/bob", status: http.StatusNotFound},
+	{name: "add missing user to group", method: http.MethodPost, path: "/groups/staff/users/nobody", status: http.StatusNotFound},
+	{
+		name: "list primary group members", method: http.MethodGet, path: "/groups", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp GroupListResponse
+			decode(t, rec, &resp)
+			for _, group := range resp.Groups {
+				if group.Name == "alice" && (strings.Join(group.PrimaryUsers, ",") != "alice" || len(group.Users) != 0) {
+					t.Errorf("alice group = %+v", group)
+				}
+				if group.Name == "staff" && (len(group.PrimaryUsers) != 0 || strings.Join(group.Users, ",") != "alice") {
+					t.Errorf("staff group = %+v", group)
+				}
+			}
+		},
+	},
+	{
+		name: "set group members", method: http.MethodPut, path: "/groups/staff/users", body: `{"users": ["bob", "bob"]}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp GroupMembersResponse
+			decode(t, rec, &resp)
+			if strings.Join(fake.Groups["staff"].Members, ",") != "bob" {
+				t.Errorf("staff members = %v", fake.Groups["staff"].Members)
+			}
+			if strings.Join(resp.Added, ",") != "bob" || strings.Join(resp.Removed, ",") != "alice" {
+				t.Errorf("added = %v, removed = %v", resp.Added, resp.Removed)
+			}
+		},
+	},
+	{
+		name: "set group members with missing user", method: http.MethodPut, path: "/groups/staff/users", body: `{"users": ["bob", "nobody"]}`, status: http.StatusBadRequest,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if strings.Join(fake.Groups["staff"].Members, ",") != "alice" {
+				t.Errorf("staff members changed to %v", fake.Groups["staff"].Members)
+			}
+		},
+	},
+	{name: "set group members without list", method: http.MethodPut, path: "/groups/staff/users", body: `{}`, status: http.StatusBadRequest},
+	{
+		name: "rename group", method: http.MethodPost, path: "/groups/staff/rename", body: `{"newName": "team"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if _, ok := fake.Groups["team"]; !ok {
+				t.Errorf("group not renamed")
+			}
+			config, _ := ReadConfig()
+			if config["public"]["valid users"] != "alice, @team" {
+				t.Errorf("valid users = %q", config["public"]["valid users"])
+			}
+		},
+	},
+	{name: "rename system group", method: http.MethodPost, path: "/groups/adm/rename", body: `{"newName": "admins"}`, status: http.StatusForbidden},
+	{name: "rename group to existing name", method: http.MethodPost, path: "/groups/staff/rename", body: `{"newName": "alice"}`, status: http.StatusConflict},
+	{
+		name: "set group description", method: http.MethodPost, path: "/groups/staff/description", body: `{"description": "All staff"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			groups, _ := getSambaGroups(false)
+			for _, group := range groups {
+				if group.Name == "staff" && group.Description != "All staff" {
+					t.Errorf("description = %q", group.Description)
+				}
+			}
+		},
+	},
+	{name: "set multi-line group description", method: http.MethodPost, path: "/groups/staff/description", body: `{"description": "a\nb"}`, status: http.StatusBadRequest},
+	{
+		name: "list group mappings", method: http.MethodGet, path: "/groups/mappings", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp GroupMappingListResponse
+			decode(t, rec, &resp)
+			if len(resp.Mappings) != 1 || resp.Mappings[0].UnixGroup != "staff" {
+				t.Errorf("mappings = %+v", resp.Mappings)
+			}
+		},
+	},
+	{
+		name: "map group", method: http.MethodPost, path: "/groups/winadmins/mapping", body: `{"ntName": "Administrators", "type": "builtin", "sid": "S-1-5-32-544"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if fake.GroupMaps["Administrators"].SID != "S-1-5-32-544" {
+				t.Errorf("mappings = %+v", fake.GroupMaps)
+			}
+		},
+	},
+	{name: "map mapped group", method: http.MethodPost, path: "/groups/staff/mapping", body: `{}`, status: http.StatusInternalServerError},
+	{name: "map missing group", method: http.MethodPost, path: "/groups/nosuchgroup/mapping", body: `{}`, status: http.StatusNotFound},
+	{name: "map group with invalid SID", method: http.MethodPost, path: "/groups/winadmins/mapping", body: `{"sid": "S-1-x"}`, status: http.StatusBadRequest},
+	{
+		name: "unmap group", method: http.MethodDelete, path: "/groups/staff/mapping", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if len(fake.GroupMaps) != 0 {
+				t.Errorf("mappings = %+v", fake.GroupMaps)
+			}
+		},
+	},
+	{name: "map protected group", method: http.MethodPost, path: "/groups/adm/mapping", body: `{"ntName": "Administrators"}`, status: http.StatusForbidden},
+	{name: "unmap unmapped group", method: http.MethodDelete, path: "/groups/winadmins/mapping", status: http.StatusNotFound},
+
+	// Configuration
+	{
+		name: "get config", method: http.MethodGet, path: "/config", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp ConfigResponse
+			decode(t, rec, &resp)
+			if resp.Config["global"]["workgroup"] != "WORKGROUP" {
+				t.Errorf("config = %v", resp.Config)
+			}
+		},
+	},
+	{
+		name: "update config", method: http.MethodPost, path: "/config", body: `{"config": {"media": {"path": "/srv/media"}}}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			config, _ := ReadConfig()
+			if config["media"]["path"] != "/srv/media" || config["public"]["path"] != "/srv/public" {
+				t.Errorf("config = %v", config)
+			}
+			var resp APIResponse
+			decode(t, rec, &resp)
+			if resp.Action != ServiceActionReload || fake.Reloads != 1 || fake.Restarts["smbd"] != 0 {
+				t.Errorf("action = %q, reloads = %d, restarts = %d", resp.Action, fake.Reloads, fake.Restarts["smbd"])
+			}
+		},
+	},
+	{name: "get section", method: http.MethodGet, path: "/config/sections/global", status: http.StatusOK},
+	{
+		name: "update section", method: http.MethodPost, path: "/config/sections/global", body: `{"global": {"workgroup": "OFFICE"}}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			config, _ := ReadConfig()
+			if config["global"]["workgroup"] != "OFFICE" {
+				t.Errorf("workgroup = %q", config["global"]["workgroup"])
+			}
+			var resp APIResponse
+			decode(t, rec, &resp)
+			if resp.Action != ServiceActionRestart || fake.Restarts["smbd"] != 1 {
+				t.Errorf("action = %q, restarts = %d", resp.Action, fake.Restarts["smbd"])
+			}
+		},
+	},
+	{name: "update section without data", method: http.MethodPost, path: "/config/sections/global", body: `{"other": {}}`, status: http.StatusBadRequest},
+	{
+		name: "delete section", method: http.MethodDelete, path: "/config/sections/public", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			config, _ := ReadConfig()
+			if _, exists := config["public"]; exists {
+				t.Errorf("section still present after delete")
+			}
+		},
+	},
+	{
+		name: "get raw config", method: http.MethodGet, path: "/config/raw", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp RawConfigResponse
+			decode(t, rec, &resp)
+			if !strings.HasPrefix(resp.Content, "# Test configuration\n[global]\n    username map = ") || !strings.HasSuffix(resp.Content, "write list = alice\n") {
+				t.Errorf("raw config = %q", resp.Content)
+			}
+		},
+	},
+	{
+		name: "save raw config", method: http.MethodPost, path: "/config/raw", body: `{"content": "[global]\n    workgroup = RAW\n"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			config, _ := ReadConfig()
+			if config["global"]["workgroup"] != "RAW" {
+				t.Errorf("config = %v", config)
+			}
+		},
+	},
+
+	// Username map
+	{
+		name: "get username map", method: http.MethodGet, path: "/usermap", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var usermap UsernameMap
+			decode(t, rec, &usermap)
+			if len(usermap.Entries) != 1 || !usermap.Entries[0].Stop || usermap.Entries[0].WindowsNames[0] != "ALICE" {
+				t.Errorf("entries = %+v", usermap.Entries)
+			}
+		},
+	},
+	{
+		name: "update username map", method: http.MethodPost, path: "/usermap", status: http.StatusOK,
+		body: `{"entries": [{"unixName": "alice", "windowsNames": ["Alice Smith", "CORP\\alice"], "stop": true}]}`,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			path, _ := usernameMapPath()
+			data, _ := os.ReadFile(path)
+			if string(data) != "# Test username map\n!alice = \"Alice Smith\" CORP\\alice\n" {
+				t.Errorf("username map = %q", data)
+			}
+		},
+	},
+	{name: "update username map with conflict", method: http.MethodPost, path: "/usermap", body: `{"entries": [{"unixName": "alice", "windowsNames": ["bob"]}]}`, status: http.StatusConflict},
+	{name: "update username map with invalid name", method: http.MethodPost, path: "/usermap", body: `{"entries": [{"unixName": "-o", "windowsNames": ["x"]}]}`, status: http.StatusBadRequest},
+	{
+		name: "validate username map", method: http.MethodPost, path: "/usermap/validate", status: http.StatusOK,
+		body: `{"entries": [{"unixName": "alice", "windowsNames": ["bob"]}, {"unixName": "carol", "windowsNames": ["bob"]}]}`,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var usermap UsernameMap
+			decode(t, rec, &usermap)
+			if len(usermap.Conflicts) != 3 || len(usermap.Warnings) != 1 {
+				t.Errorf("conflicts = %+v, warnings = %+v", usermap.Conflicts, usermap.Warnings)
+			}
+		},
+	},
+
+	// Service
+	{
+		name: "service status", method: http.MethodGet, path: "/status", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp ServiceStatusResponse
+			decode(t, rec, &resp)
+			if !resp.Active || resp.Status != "running" {
+				t.Errorf("status = %+v", resp)
+			}
+		},
+	},
+	{
+		name: "health", method: http.MethodGet, path: "/health", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var report HealthReport
+			decode(t, rec, &report)
+			if report.Status != HealthPass || len(report.Checks) != 5 {
+				t.Errorf("report = %+v", report)
+			}
+		},
+	},
+	{
+		name: "restart service", method: http.MethodPost, path: "/restart", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if fake.Restarts["smbd"] != 1 {
+				t.Errorf("smbd restarts = %d", fake.Restarts["smbd"])
+			}
+		},
+	},
+	{
+		name: "list services", method: http.MethodGet, path: "/services", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp ServiceListResponse
+			decode(t, rec, &resp)
+			if len(resp.Services) != 1 || resp.Services[0].Name != "smbd" || !resp.Services[0].Active || !resp.Services[0].Enabled {
+				t.Errorf("services = %+v", resp.Services)
+			}
+		},
+	},
+	{
+		name: "get service", method: http.MethodGet, path: "/services/nmbd", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp UnitStatus
+			decode(t, rec, &resp)
+			if resp.Installed || resp.Status != "not installed" {
+				t.Errorf("status = %+v", resp)
+			}
+		},
+	},
+	{name: "get unknown service", method: http.MethodGet, path: "/services/sshd", status: http.StatusNotFound},
+	{
+		name: "stop service", method: http.MethodPost, path: "/services/smbd/stop", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if _, ok := fake.Services["smbd"]; ok {
+				t.Errorf("smbd still running")
+			}
+		},
+	},
+	{name: "start missing service", method: http.MethodPost, path: "/services/winbind/start", status: http.StatusNotFound},
+	{name: "unknown service action", method: http.MethodPost, path: "/services/smbd/kill", status: http.StatusNotFound},
+	{
+		name: "reload service", method: http.MethodPost, path: "/reload", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if fake.Reloads != 1 || fake.Restarts["smbd"] != 0 {
+				t.Errorf("reloads = %d, restarts = %d", fake.Reloads, fake.Restarts["smbd"])
+			}
+		},
+	},
+
+	// Admins
+	{
+		name: "list admins", method: http.MethodGet, path: "/admins", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp AdminsResponse
+			decode(t, rec, &resp)
+			if len(resp.Admins) != 2 || resp.Admins[0].Username != "admin" || !resp.Admins[0].MustChangePassword || strings.Contains(rec.Body.String(), "$2") {
+				t.Errorf("admins = %s", rec.Body.String())
+			}
+		},
+	},
+	{
+		name: "create admin", method: http.MethodPost, path: "/admins", body: `{"username": "carol", "password": "Car0l-secret", "mustChangePassword": true}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if admin, ok := authenticateAdmin("carol", "Car0l-secret"); !ok || !admin.MustChangePassword || admin.Role != RoleViewer {
+				t.Errorf("admin = %+v, ok = %v", admin, ok)
+			}
+		},
+	},
+	{name: "create existing admin", method: http.MethodPost, path: "/admins", body: `{"username": "operator", "password": "Car0l-secret"}`, status: http.StatusConflict},
+	{name: "create admin with weak password", method: http.MethodPost, path: "/admins", body: `{"username": "carol", "password": "short"}`, status: http.StatusBadRequest},
+	{
+		name: "delete admin", method: http.MethodDelete, path: "/admins/admin", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if _, ok := lookupAdmin("admin"); ok {
+				t.Error("admin still exists")
+			}
+		},
+	},
+	{name: "delete unknown admin", method: http.MethodDelete, path: "/admins/ghost", status: http.StatusNotFound},
+	{
+		name: "reset admin password", method: http.MethodPost, path: "/admins/admin/password", body: `{"password": "N3w-secret"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if admin, ok := authenticateAdmin("admin", "N3w-secret"); !ok || !admin.MustChangePassword {
+				t.Errorf("admin = %+v, ok = %v", admin, ok)
+			}
+		},
+	},
+	{
+		name: "change admin role", method: http.MethodPut, path: "/admins/admin/role", body: `{"role": "helpdesk"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if admin, _ := lookupAdmin("admin"); admin.Role != RoleHelpdesk {
+				t.Errorf("admin = %+v", admin)
+			}
+		},
+	},
+	{name: "change admin to unknown role", method: http.MethodPut, path: "/admins/admin/role", body: `{"role": "root"}`, status: http.StatusBadRequest},
+	{
+		name: "current admin", method: http.MethodGet, path: "/me", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var me MeResponse
+			decode(t, rec, &me)
+			if me.Username != "operator" || me.Role != RoleAdmin || !containsString(me.Permissions, PermissionAdmin) {
+				t.Errorf("me = %+v", me)
+			}
+		},
+	},
+
+	// Session history
+	{
+		name: "share history", method: http.MethodGet, path: "/history/shares/public", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp ShareHistoryResponse
+			decode(t, rec, &resp)
+			if resp.Share != "public" || len(resp.Visitors) != 0 {
+				t.Errorf("history = %+v", resp)
+			}
+		},
+	},
+	{name: "peak usage", method: http.MethodGet, path: "/history/peak", status: http.StatusOK},
+	{name: "client history", method: http.MethodGet, path: "/history/clients", status: http.StatusOK},
+
+	// Debug levels
+	{name: "list debug overrides", method: http.MethodGet, path: "/debug", status: http.StatusOK},
+	{
+		name: "raise debug level", method: http.MethodPost, path: "/debug", body: `{"level": 5, "subsystems": ["auth", "vfs"], "user": "alice"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var override DebugOverride
+			decode(t, rec, &override)
+			if fake.Debug["4100"] != "0 auth:5 vfs:5" || override.Revert != "0" || len(override.Destinations) != 1 {
+				t.Errorf("debug = %v, override = %+v", fake.Debug, override)
+			}
+		},
+	},
+	{name: "raise debug level of unknown class", method: http.MethodPost, path: "/debug", body: `{"level": 5, "subsystems": ["disk"]}`, status: http.StatusBadRequest},
+	{name: "raise debug level of absent client", method: http.MethodPost, path: "/debug", body: `{"level": 5, "client": "10.9.9.9"}`, status: http.StatusNotFound},
+	{name: "revert all debug overrides", method: http.MethodDelete, path: "/debug/all", status: http.StatusOK},
+	{name: "revert unknown debug override", method: http.MethodDelete, path: "/debug/999", status: http.StatusNotFound},
+
+	// Logs
+	{name: "log sources", method: http.MethodGet, path: "/logs/sources", status: http.StatusOK},
+	{name: "logs", method: http.MethodGet, path: "/logs", status: http.StatusOK},
+	{name: "logs with invalid level", method: http.MethodGet, path: "/logs?level=high", status: http.StatusBadRequest},
+	{name: "stream logs", method: http.MethodGet, path: "/logs/stream", status: http.StatusOK},
+
+	// Clients
+	{name: "list sessions", method: http.MethodGet, path: "/sessions", status: http.StatusOK},
+	{
+		name: "disconnect session", method: http.MethodDelete, path: "/sessions/4100", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if len(fake.Killed) != 1 || fake.Killed[0] != "4100" {
+				t.Errorf("killed = %v", fake.Killed)
+			}
+			entries, _ := readAuditLog(10)
+			if len(entries) != 1 || entries[0].Action != "session.disconnect" || entries[0].Target != "4100" || !entries[0].Success {
+				t.Errorf("audit = %+v", entries)
+			}
+		},
+	},
+	{name: "disconnect unknown session", method: http.MethodDelete, path: "/sessions/9999", status: http.StatusNotFound},
+	{name: "disconnect invalid session", method: http.MethodDelete, path: "/sessions/abc", status: http.StatusBadRequest},
+	{
+		name: "disconnect user", method: http.MethodPost, path: "/users/alice/disconnect", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if len(fake.Killed) != 1 || len(fake.Clients.Sessions) != 0 {
+				t.Errorf("killed = %v, sessions = %+v", fake.Killed, fake.Clients.Sessions)
+			}
+		},
+	},
+	{
+		name: "disconnect share", method: http.MethodPost, path: "/shares/public/disconnect", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			if len(fake.Closed) != 1 || len(fake.Clients.Connections) != 0 {
+				t.Errorf("closed = %v, connections = %+v", fake.Closed, fake.Clients.Connections)
+			}
+		},
+	},
+	{name: "disconnect missing share", method: http.MethodPost, path: "/shares/missing/disconnect", status: http.StatusNotFound},
+	{
+		name: "close open file", method: http.MethodPost, path: "/open-files/close", body: `{"pid": "4100", "path": "/srv/public/notes.txt"}`, status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			entries, _ := readAuditLog(10)
+			if len(fake.Clients.OpenFiles) != 0 || len(entries) != 1 || entries[0].Action != "file.close" {
+				t.Errorf("open files = %+v, audit = %+v", fake.Clients.OpenFiles, entries)
+			}
+		},
+	},
+	{name: "close file not open", method: http.MethodPost, path: "/open-files/close", body: `{"pid": "4100", "path": "/srv/public/other.txt"}`, status: http.StatusNotFound},
+	{name: "audit log", method: http.MethodGet, path: "/audit", status: http.StatusOK},
+	{name: "audit log with invalid limit", method: http.MethodGet, path: "/audit?limit=0", status: http.StatusBadRequest},
+	{name: "list connections", method: http.MethodGet, path: "/connections", status: http.StatusOK},
+	{name: "list open files", method: http.MethodGet, path: "/open-files", status: http.StatusOK},
+
+	// Storage
+	{
+		name: "filesystem sizes", method: http.MethodGet, path: "/storage-filesystems", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp DisksResponse
+			decode(t, rec, &resp)
+			if len(resp.Disks) != 1 || resp.Disks[0].DisplayName != "/" {
+				t.Errorf("disks = %+v", resp.Disks)
+			}
+		},
+	},
+	{
+		name: "share sizes", method: http.MethodGet, path: "/storage-shares", status: http.StatusOK,
+		check: func(t *testing.T, fake *FakeSystem, rec *httptest.ResponseRecorder) {
+			var resp ShareSizesResponse
+			decode(t, rec, &resp)
+			if len(resp.Shares) != 1 || resp.Shares[0].Used != "10G" || resp.Shares[0].UsePercent != 10 {
+				t.Errorf("shares = %+v", resp.Shares)
+			}
+		},
+	},
+}
+
+func TestRoutes(t *testing.T) {
+	for _, tc := range routeCases {
+		t.Run(tc.name, func(t *testing.T) {
+			fake, h := newTestAPI(t)
+
+			rec := serve(h, tc.method, tc.path, tc.body)
+			if rec.Code != tc.status {
+				t.Fatalf("%s %s: status = %d, want %d; body: %s", tc.method, tc.path, rec.Code, tc.status, rec.Body.String())
+			}
+			if tc.check != nil {
+				tc.check(t, fake, rec)
+			}
+		})
+	}
+}
+
+func TestEveryRouteIsCovered(t *testing.T) {
+	h := NewAPIHandler()
+	for _, route := range h.routes {
+		covered := false
+		for _, tc := range routeCases {
+			if tc.method == route.Method && route.Pattern.MatchString(tc.path) && tc.status < 400 {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			t.Errorf("no successful test case for %s %s", route.Method, route.Pattern)
+		}
+	}
+}
+
+func TestUnknownRoute(t *testing.T) {
+	_, h := newTestAPI(t)
+	if rec := serve(h, http.MethodGet, "/nope", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want 404", rec.Code)
+	}
+}
+
+// decode unmarshals a JSON response body
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode response: %v; body: %s", err, rec.Body.String())
+	}
+}
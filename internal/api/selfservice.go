@@ -0,0 +1,257 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// PasswordPolicy contains the rules new passwords must satisfy
+type PasswordPolicy struct {
+	MinLength         int
+	RequireComplexity bool
+}
+
+// SelfServicePasswordRequest represents a password change request from an end user
+type SelfServicePasswordRequest struct {
+	Username        string `json:"username"`
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+var (
+	passwordPolicy = PasswordPolicy{MinLength: 8, RequireComplexity: true}
+	policyMu       sync.RWMutex
+)
+
+// SetPasswordPolicy sets the password policy
+func SetPasswordPolicy(policy PasswordPolicy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	passwordPolicy = policy
+}
+
+// GetPasswordPolicy gets the password policy
+func GetPasswordPolicy() PasswordPolicy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return passwordPolicy
+}
+
+// SelfServiceHandler handles the unprivileged self-service API
+type SelfServiceHandler struct {
+	routes  []Route
+	limiter *attemptLimiter
+}
+
+// NewSelfServiceHandler creates a self-service handler allowing maxAttempts
+// password change attempts per client address and per username within window
+func NewSelfServiceHandler(maxAttempts int, window time.Duration) *SelfServiceHandler {
+	handler := &SelfServiceHandler{
+		limiter: newAttemptLimiter(maxAttempts, window),
+	}
+	handler.routes = append(handler.routes, Route{
+		Pattern: regexp.MustCompile(`^/password$`),
+		Method:  http.MethodPost,
+		Handler: handler.ChangeOwnPassword,
+	})
+	return handler
+}
+
+// ServeHTTP handles all self-service requests
+func (h *SelfServiceHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	for _, route := range h.routes {
+		if route.Pattern.MatchString(r.URL.Path) && route.Method == r.Method {
+			route.Handler(w, r)
+			return
+		}
+	}
+
+	http.NotFound(w, r)
+}
+
+// ChangeOwnPassword lets a Samba user change their own password by proving
+// knowledge of the current one
+func (h *SelfServiceHandler) ChangeOwnPassword(w http.ResponseWriter, r *http.Request) {
+	var req SelfServicePasswordRequest
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	if req.Username == "" || req.CurrentPassword == "" || req.NewPassword == "" {
+		writeError(w, "Username, current password and new password are required", http.StatusBadRequest)
+		return
+	}
+
+	// Rate limit by both client address and target account
+	clientKey := "ip:" + clientAddress(r)
+	userKey := "user:" + strings.ToLower(req.Username)
+	if !h.limiter.allow(clientKey) || !h.limiter.allow(userKey) {
+		writeError(w, "Too many attempts, please try again later", http.StatusTooManyRequests)
+		return
+	}
+
+	if err := validateUsername(req.Username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validatePassword(req.Username, req.CurrentPassword, req.NewPassword, GetPasswordPolicy()); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Protected accounts are refused like a wrong password
+	if err := checkUserModifiable(req.Username); err != nil {
+		writeError(w, "Current username or password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	err = changeOwnSambaPassword(req.Username, req.CurrentPassword, req.NewPassword)
+	if err != nil {
+		// Do not reveal whether the user exists or the password was wrong
+		writeError(w, "Current username or password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: "Password changed successfully",
+	})
+}
+
+// changeOwnSambaPassword changes a password after verifying the current one against passdb
+func changeOwnSambaPassword(username, currentPassword, newPassword string) error {
+	err := getBackend().PassDB.ChangePassword(username, currentPassword, newPassword)
+	if err != nil {
+		return fmt.Errorf("Failed to change password: %v", err)
+	}
+
+	return nil
+}
+
+// validatePassword checks a new password against the password policy
+func validatePassword(username, currentPassword, newPassword string, policy PasswordPolicy) error {
+	if len(newPassword) < policy.MinLength {
+		return fmt.Errorf("Password must be at least %d characters long", policy.MinLength)
+	}
+
+	if newPassword == currentPassword {
+		return fmt.Errorf("New password must differ from the current password")
+	}
+
+	if strings.ContainsAny(newPassword, "\r\n") {
+		return fmt.Errorf("Password must not contain line breaks")
+	}
+
+	if policy.RequireComplexity {
+		if strings.Contains(strings.ToLower(newPassword), strings.ToLower(username)) {
+			return fmt.Errorf("Password must not contain the username")
+		}
+
+		var upper, lower, digit, symbol bool
+		for _, c := range newPassword {
+			switch {
+			case unicode.IsUpper(c):
+				upper = true
+			case unicode.IsLower(c):
+				lower = true
+			case unicode.IsDigit(c):
+				digit = true
+			default:
+				symbol = true
+			}
+		}
+
+		classes := 0
+		for _, present := range []bool{upper, lower, digit, symbol} {
+			if present {
+				classes++
+			}
+		}
+		if classes < 3 {
+			return fmt.Errorf("Password must contain at least three of: uppercase letters, lowercase letters, digits, symbols")
+		}
+	}
+
+	return nil
+}
+
+// clientAddress returns the remote IP of a request without the port
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// attemptLimiter allows a fixed number of attempts per key within a sliding window
+type attemptLimiter struct {
+	mu        sync.Mutex
+	attempts  map[string][]time.Time
+	max       int
+	window    time.Duration
+	lastSweep time.Time
+}
+
+// newAttemptLimiter creates a limiter allowing max attempts per window
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		attempts: make(map[string][]time.Time),
+		max:      max,
+		window:   window,
+	}
+}
+
+// allow records an attempt for key and reports whether it is within the limit
+func (l *attemptLimiter) allow(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-l.window)
+
+	// Forget keys without recent attempts once per window, so addresses and
+	// usernames that stopped trying do not accumulate
+	if now.Sub(l.lastSweep) >= l.window {
+		l.prune(cutoff)
+		l.lastSweep = now
+	}
+
+	// Drop attempts that fell out of the window
+	recent := l.attempts[key][:0]
+	for _, t := range l.attempts[key] {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+
+	if len(recent) >= l.max {
+		l.attempts[key] = recent
+		return false
+	}
+
+	l.attempts[key] = append(recent, now)
+	return true
+}
+
+// prune removes the keys whose attempts are all older than cutoff
+func (l *attemptLimiter) prune(cutoff time.Time) {
+	for key, attempts := range l.attempts {
+		if len(attempts) == 0 || !attempts[len(attempts)-1].After(cutoff) {
+			delete(l.attempts, key)
+		}
+	}
+}
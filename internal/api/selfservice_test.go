@@ -0,0 +1,111 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestSelfServicePasswordChange(t *testing.T) {
+	fake, _ := newTestAPI(t)
+	h := NewSelfServiceHandler(3, time.Minute)
+
+	rec := serve(h, http.MethodPost, "/password", `{"username": "alice", "currentPassword": "wrong", "newPassword": "Changed#2024"}`)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong password: status = %d, want 401", rec.Code)
+	}
+
+	rec = serve(h, http.MethodPost, "/password", `{"username": "alice", "currentPassword": "Secret123!", "newPassword": "short"}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("weak password: status = %d, want 400", rec.Code)
+	}
+
+	rec = serve(h, http.MethodPost, "/password", `{"username": "alice", "currentPassword": "Secret123!", "newPassword": "Changed#2024"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("valid change: status = %d, want 200; body: %s", rec.Code, rec.Body.String())
+	}
+	if fake.Passwords["alice"] != "Changed#2024" {
+		t.Errorf("password = %q", fake.Passwords["alice"])
+	}
+
+	// The fourth attempt within the window is rejected
+	rec = serve(h, http.MethodPost, "/password", `{"username": "alice", "currentPassword": "Changed#2024", "newPassword": "Another#2024"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("rate limit: status = %d, want 429", rec.Code)
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	policy := PasswordPolicy{MinLength: 8, RequireComplexity: true}
+
+	tests := []struct {
+		password string
+		valid    bool
+	}{
+		{"Abcdef1!", true},
+		{"abcdefgh", false},
+		{"Ab1!", false},
+		{"xAlice12!", false},
+		{"ABCDEFG1", false},
+		{"Abcdefg1", true},
+	}
+	for _, tc := range tests {
+		err := validatePassword("alice", "old", tc.password, policy)
+		if (err == nil) != tc.valid {
+			t.Errorf("validatePassword(%q) = %v, want valid=%v", tc.password, err, tc.valid)
+		}
+	}
+}
+
+func TestAttemptLimiter(t *testing.T) {
+	limiter := newAttemptLimiter(2, time.Minute)
+
+	if !limiter.allow("a") || !limiter.allow("a") {
+		t.Fatal("attempts within the limit were rejected")
+	}
+	if limiter.allow("a") {
+		t.Error("third attempt within the window was allowed")
+	}
+	if !limiter.allow("b") {
+		t.Error("other key was limited")
+	}
+}
+
+func TestAttemptLimiterPrunesExpiredKeys(t *testing.T) {
+	limiter := newAttemptLimiter(2, time.Minute)
+	old := time.Now().Add(-2 * time.Minute)
+	limiter.attempts["stale"] = []time.Time{old, old}
+	limiter.attempts["recent"] = []time.Time{old, time.Now()}
+	limiter.lastSweep = old
+
+	if !limiter.allow("new") {
+		t.Fatal("attempt was rejected")
+	}
+	if _, ok := limiter.attempts["stale"]; ok {
+		t.Error("key without recent attempts was kept")
+	}
+	if _, ok := limiter.attempts["recent"]; !ok {
+		t.Error("key with a recent attempt was pruned")
+	}
+	if len(limiter.attempts) != 2 {
+		t.Errorf("tracked keys = %d, want 2", len(limiter.attempts))
+	}
+}
+
+func TestSelfServiceRateLimitsPerAddress(t *testing.T) {
+	newTestAPI(t)
+	h := NewSelfServiceHandler(2, time.Minute)
+
+	for _, username := range []string{"alice", "bob"} {
+		rec := serve(h, http.MethodPost, "/password", `{"username": "`+username+`", "currentPassword": "wrong", "newPassword": "Changed#2024"}`)
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("%s: status = %d, want 401", username, rec.Code)
+		}
+	}
+
+	// The address is limited even for a username it has not tried yet
+	rec := serve(h, http.MethodPost, "/password", `{"username": "carol", "currentPassword": "wrong", "newPassword": "Changed#2024"}`)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Errorf("status = %d, want 429", rec.Code)
+	}
+}
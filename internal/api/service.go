@@ -4,10 +4,38 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
+	"os"
 	"strings"
+	"sync"
 	"time"
-	"regexp"
+)
+
+// Ways a configuration change is applied to the running daemons
+const (
+	ServiceActionReload  = "reload"
+	ServiceActionRestart = "restart"
+)
+
+// restartRequiredParams are [global] parameters that smbd only reads at startup
+var restartRequiredParams = map[string]bool{
+	"interfaces":            true,
+	"bind interfaces only":  true,
+	"smb ports":             true,
+	"server role":           true,
+	"security":              true,
+	"passdb backend":        true,
+	"netbios name":          true,
+	"netbios aliases":       true,
+	"realm":                 true,
+	"workgroup":             true,
+	"disable netbios":       true,
+	"server smb transports": true,
+}
+
+var (
+	// restartPending is set once a written change needs a full restart
+	restartPending   bool
+	restartPendingMu sync.Mutex
 )
 
 // GetServiceStatus returns the Samba service status
@@ -23,98 +51,225 @@ func (h *APIHandler) GetServiceStatus(w http.ResponseWriter, r *http.Request) {
 
 // RestartService restarts the Samba service
 func (h *APIHandler) RestartService(w http.ResponseWriter, r *http.Request) {
-	err := restartSambaService()
+	_, queued, err := queueServiceAction(ServiceActionRestart)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	message := "Service restarted successfully"
+	if queued {
+		message = "Service restart scheduled"
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: message,
+		Action:  ServiceActionRestart,
+		Queued:  queued,
+	})
+}
+
+// ReloadService makes Samba re-read its configuration without dropping clients
+func (h *APIHandler) ReloadService(w http.ResponseWriter, r *http.Request) {
+	action, queued, err := queueServiceAction(ServiceActionReload)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	message := fmt.Sprintf("Configuration applied (%s)", action)
+	if queued {
+		message = fmt.Sprintf("Configuration %s scheduled", action)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
-		Message: "Service restarted successfully",
+		Message: message,
+		Action:  action,
+		Queued:  queued,
 	})
 }
 
 // getSambaServiceStatus returns the Samba service status
 func getSambaServiceStatus() (ServiceStatusResponse, error) {
-	// Check if service is active
-	cmdStatus := exec.Command("systemctl", "is-active", "smbd")
-	outputStatus, _ := cmdStatus.CombinedOutput()
-	isActive := strings.TrimSpace(string(outputStatus)) == "active"
-
-	// Add uptime data to the response
-	uptimeData := map[string]string{
-		"uptime": "N/A",
-		"since": "",
-	}
-
-	// If service is active, get uptime information
-	if isActive {
-		// Get the service start time
-		cmdUptime := exec.Command("systemctl", "show", "smbd", "--property=ActiveEnterTimestamp")
-		outputUptime, err := cmdUptime.CombinedOutput()
-		if err == nil {
-			// Parse the output to get the timestamp
-			timestampLine := strings.TrimSpace(string(outputUptime))
-			re := regexp.MustCompile(`ActiveEnterTimestamp=(.+)`)
-			matches := re.FindStringSubmatch(timestampLine)
-
-			if len(matches) > 1 {
-				// Parse the timestamp
-				startTimeStr := matches[1]
-				// Format: "Day YYYY-MM-DD HH:MM:SS UTC"
-				layout := "Mon 2006-01-02 15:04:05 MST"
-				startTime, err := time.Parse(layout, startTimeStr)
-
-				if err == nil {
-					// Calculate uptime
-					uptime := time.Since(startTime)
-					days := int(uptime.Hours() / 24)
-					hours := int(uptime.Hours()) % 24
-					minutes := int(uptime.Minutes()) % 60
-
-					// Format uptime string
-					if days > 0 {
-						uptimeData["uptime"] = fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
-					} else if hours > 0 {
-						uptimeData["uptime"] = fmt.Sprintf("%dh %dm", hours, minutes)
-					} else {
-						uptimeData["uptime"] = fmt.Sprintf("%dm", minutes)
-					}
-
-					// Format the uptime since date in more readable format
-					uptimeData["since"] = startTime.Format("Jan 2, 2006 15:04:05")
-				}
-			}
-		}
+	smbd, _ := findSambaUnit("smbd")
+	unit, installed := resolveUnit(smbd)
+	if !installed {
+		unit = smbd.Name
 	}
 
+	// Check if service is active
+	isActive, _ := getBackend().Services.IsActive(unit)
+
 	// Create metadata to include uptime information
 	metadata := map[string]interface{}{
-		"uptime": uptimeData,
+		"uptime": unitUptime(unit),
 	}
 
+	pending, last := serviceQueueStatus()
+
 	return ServiceStatusResponse{
-		Service: "smbd",
-		Active:  isActive,
-		Status:  map[bool]string{true: "running", false: "stopped"}[isActive],
-		Metadata: metadata,
+		Service:       unit,
+		Active:        isActive,
+		Status:        map[bool]string{true: "running", false: "stopped"}[isActive],
+		Metadata:      metadata,
+		PendingAction: pending,
+		LastAction:    last,
 	}, nil
 }
 
-// restartSambaService restarts the Samba service and refreshes ACLs
+// unitUptime returns how long a unit has been active and since when
+func unitUptime(unit string) map[string]string {
+	uptimeData := map[string]string{
+		"uptime": "N/A",
+		"since":  "",
+	}
+
+	// Get the service start time
+	startTime, err := getBackend().Services.ActiveSince(unit)
+	if err != nil {
+		return uptimeData
+	}
+
+	// Calculate uptime
+	uptime := time.Since(startTime)
+	days := int(uptime.Hours() / 24)
+	hours := int(uptime.Hours()) % 24
+	minutes := int(uptime.Minutes()) % 60
+
+	// Format uptime string
+	if days > 0 {
+		uptimeData["uptime"] = fmt.Sprintf("%dd %dh %dm", days, hours, minutes)
+	} else if hours > 0 {
+		uptimeData["uptime"] = fmt.Sprintf("%dh %dm", hours, minutes)
+	} else {
+		uptimeData["uptime"] = fmt.Sprintf("%dm", minutes)
+	}
+
+	// Format the uptime since date in more readable format
+	uptimeData["since"] = startTime.Format("Jan 2, 2006 15:04:05")
+
+	return uptimeData
+}
+
+// restartSambaService restarts smbd and every other running daemon that
+// reads smb.conf
 func restartSambaService() error {
 	// Refresh ACLs first
 	// if err := refreshShareACLs(); err != nil {
 	// 	return fmt.Errorf("Failed to refresh ACLs: %v", err)
 	// }
 
-	// Then restart the service
-	cmd := exec.Command("systemctl", "restart", "smbd")
-	err := cmd.Run()
-	if err != nil {
-		return fmt.Errorf("Failed to restart service: %v", err)
+	services := getBackend().Services
+	for _, unit := range sambaUnits {
+		if !unit.ReadsConfig {
+			continue
+		}
+		name, installed := resolveUnit(unit)
+		if !installed {
+			continue
+		}
+		// smbd is always restarted so a stopped server comes back up
+		if active, _ := services.IsActive(name); !active && unit.Name != "smbd" {
+			continue
+		}
+		if err := services.Restart(name); err != nil {
+			return fmt.Errorf("Failed to restart %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+// noteConfigChange records whether the change from before to after touches
+// a parameter that only takes effect on restart
+func noteConfigChange(before, after SambaConfig) {
+	if !needsRestart(before, after) {
+		return
+	}
+	restartPendingMu.Lock()
+	defer restartPendingMu.Unlock()
+	restartPending = true
+}
+
+// needsRestart reports whether a restart-only [global] parameter differs
+func needsRestart(before, after SambaConfig) bool {
+	oldParams := lowerParams(before["global"])
+	newParams := lowerParams(after["global"])
+	for param := range restartRequiredParams {
+		if oldParams[param] != newParams[param] {
+			return true
+		}
+	}
+	for param, value := range newParams {
+		if strings.HasPrefix(param, "idmap config") && oldParams[param] != value {
+			return true
+		}
+	}
+	for param := range oldParams {
+		if _, ok := newParams[param]; !ok && strings.HasPrefix(param, "idmap config") {
+			return true
+		}
+	}
+	return false
+}
+
+// lowerParams returns a section keyed by lower-case parameter names
+func lowerParams(section SectionConfig) map[string]string {
+	params := make(map[string]string, len(section))
+	for key, value := range section {
+		params[strings.ToLower(key)] = strings.TrimSpace(value)
+	}
+	return params
+}
+
+// isRestartPending reports whether a written change still needs a restart
+func isRestartPending() bool {
+	restartPendingMu.Lock()
+	defer restartPendingMu.Unlock()
+	return restartPending
+}
+
+// applySambaConfig makes the running daemons pick up the written configuration,
+// restarting smbd when asked to or when a pending change requires it, and
+// returns the action taken
+func applySambaConfig(restart bool) (string, error) {
+	restartPendingMu.Lock()
+	pending := restartPending
+	restartPending = false
+	restartPendingMu.Unlock()
+
+	if !pending && !restart {
+		if err := getBackend().Control.ReloadConfig(); err == nil {
+			return ServiceActionReload, nil
+		}
+		// smbcontrol fails when smbd isn't running, a restart brings it back
+	}
+
+	if err := restartSambaService(); err != nil {
+		restartPendingMu.Lock()
+		restartPending = restartPending || pending
+		restartPendingMu.Unlock()
+		return ServiceActionRestart, err
+	}
+
+	return ServiceActionRestart, nil
+}
+
+// writeConfigFile replaces smb.conf with raw content and records whether it
+// needs a restart
+func writeConfigFile(content []byte) error {
+	before, _ := ReadConfig()
+
+	if err := os.WriteFile(GetConfigPath(), content, 0644); err != nil {
+		return err
+	}
+
+	if after, err := ReadConfig(); err == nil {
+		noteConfigChange(before, after)
 	}
 
 	return nil
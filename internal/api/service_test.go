@@ -0,0 +1,60 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestNeedsRestart(t *testing.T) {
+	before := SambaConfig{"global": {"workgroup": "WORKGROUP", "log level": "1"}}
+	tests := []struct {
+		name   string
+		global SectionConfig
+		want   bool
+	}{
+		{"unchanged", SectionConfig{"workgroup": "WORKGROUP", "log level": "1"}, false},
+		{"reloadable parameter", SectionConfig{"workgroup": "WORKGROUP", "log level": "3"}, false},
+		{"interfaces added", SectionConfig{"workgroup": "WORKGROUP", "log level": "1", "Interfaces": "eth0"}, true},
+		{"idmap range", SectionConfig{"workgroup": "WORKGROUP", "log level": "1", "idmap config * : range": "3000-7999"}, true},
+	}
+	for _, tc := range tests {
+		after := SambaConfig{"global": tc.global}
+		if got := needsRestart(before, after); got != tc.want {
+			t.Errorf("%s: needsRestart = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestRawConfigRestartsOnlyForStartupParameters(t *testing.T) {
+	fake, h := newTestAPI(t)
+
+	content, _ := os.ReadFile(GetConfigPath())
+	shareChange := strings.Replace(string(content), "/srv/public", "/srv/shared", 1)
+	if rec := serve(h, http.MethodPost, "/config/raw", rawConfigBody(t, shareChange)); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	if fake.Reloads != 1 || fake.Restarts["smbd"] != 0 {
+		t.Errorf("share change: reloads = %d, restarts = %d", fake.Reloads, fake.Restarts["smbd"])
+	}
+
+	portChange := strings.Replace(shareChange, "[global]\n", "[global]\n    smb ports = 445\n", 1)
+	rec := serve(h, http.MethodPost, "/config/raw", rawConfigBody(t, portChange))
+	var resp APIResponse
+	decode(t, rec, &resp)
+	if resp.Action != ServiceActionRestart || fake.Restarts["smbd"] != 1 {
+		t.Errorf("port change: action = %q, restarts = %d", resp.Action, fake.Restarts["smbd"])
+	}
+}
+
+// rawConfigBody encodes a raw configuration save request
+func rawConfigBody(t *testing.T, content string) string {
+	t.Helper()
+	data, err := json.Marshal(RawConfigResponse{Content: content})
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	return string(data)
+}
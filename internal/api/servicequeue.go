@@ -0,0 +1,134 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// PendingServiceAction is a reload or restart waiting for its coalescing window
+type PendingServiceAction struct {
+	Action      string    `json:"action"`
+	Requests    int       `json:"requests"`
+	RequestedAt time.Time `json:"requestedAt"`
+	ScheduledAt time.Time `json:"scheduledAt"`
+}
+
+// ServiceActionResult is the outcome of a reload or restart
+type ServiceActionResult struct {
+	Action     string    `json:"action"`
+	Requests   int       `json:"requests"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+}
+
+var (
+	serviceApplyWindow   time.Duration
+	pendingServiceAction *PendingServiceAction
+	lastServiceAction    *ServiceActionResult
+	serviceQueueMu       sync.Mutex
+
+	// serviceActionMu serializes reloads and restarts
+	serviceActionMu sync.Mutex
+)
+
+// SetServiceApplyWindow sets how long reload and restart requests are
+// collected before one action is run for all of them
+func SetServiceApplyWindow(window time.Duration) {
+	serviceQueueMu.Lock()
+	defer serviceQueueMu.Unlock()
+	serviceApplyWindow = window
+}
+
+// GetServiceApplyWindow gets the reload and restart coalescing window
+func GetServiceApplyWindow() time.Duration {
+	serviceQueueMu.Lock()
+	defer serviceQueueMu.Unlock()
+	return serviceApplyWindow
+}
+
+// queueServiceAction requests a reload or restart of Samba. Requests within
+// the coalescing window are merged into one action, a restart winning over a
+// reload. It returns the planned action and whether it was deferred; without
+// a window the action runs immediately and its error is returned.
+func queueServiceAction(action string) (string, bool, error) {
+	serviceQueueMu.Lock()
+	window := serviceApplyWindow
+	if window <= 0 {
+		serviceQueueMu.Unlock()
+		result, err := runServiceAction(action, 1)
+		return result, false, err
+	}
+	defer serviceQueueMu.Unlock()
+
+	if pendingServiceAction == nil {
+		now := time.Now()
+		pendingServiceAction = &PendingServiceAction{
+			Action:      ServiceActionReload,
+			RequestedAt: now,
+			ScheduledAt: now.Add(window),
+		}
+		time.AfterFunc(window, flushServiceQueue)
+	}
+
+	pendingServiceAction.Requests++
+	if action == ServiceActionRestart || isRestartPending() {
+		pendingServiceAction.Action = ServiceActionRestart
+	}
+
+	return pendingServiceAction.Action, true, nil
+}
+
+// flushServiceQueue runs the coalesced action once its window has passed
+func flushServiceQueue() {
+	serviceQueueMu.Lock()
+	pending := pendingServiceAction
+	pendingServiceAction = nil
+	serviceQueueMu.Unlock()
+
+	if pending != nil {
+		runServiceAction(pending.Action, pending.Requests)
+	}
+}
+
+// runServiceAction performs a reload or restart and records its outcome
+func runServiceAction(action string, requests int) (string, error) {
+	serviceActionMu.Lock()
+	defer serviceActionMu.Unlock()
+
+	result := ServiceActionResult{Action: action, Requests: requests, StartedAt: time.Now()}
+
+	var err error
+	result.Action, err = applySambaConfig(action == ServiceActionRestart)
+	result.FinishedAt = time.Now()
+	result.Success = err == nil
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	serviceQueueMu.Lock()
+	lastServiceAction = &result
+	serviceQueueMu.Unlock()
+
+	return result.Action, err
+}
+
+// serviceQueueStatus returns copies of the pending and last service actions
+func serviceQueueStatus() (*PendingServiceAction, *ServiceActionResult) {
+	serviceQueueMu.Lock()
+	defer serviceQueueMu.Unlock()
+
+	var pending *PendingServiceAction
+	if pendingServiceAction != nil {
+		copied := *pendingServiceAction
+		pending = &copied
+	}
+	var last *ServiceActionResult
+	if lastServiceAction != nil {
+		copied := *lastServiceAction
+		last = &copied
+	}
+
+	return pending, last
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// useServiceApplyWindow enables request coalescing for one test
+func useServiceApplyWindow(t *testing.T, window time.Duration) {
+	t.Helper()
+	SetServiceApplyWindow(window)
+	t.Cleanup(func() {
+		SetServiceApplyWindow(0)
+		serviceQueueMu.Lock()
+		pendingServiceAction = nil
+		lastServiceAction = nil
+		serviceQueueMu.Unlock()
+	})
+}
+
+// waitForServiceQueue waits until no service action is pending
+func waitForServiceQueue(t *testing.T) *ServiceActionResult {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if pending, last := serviceQueueStatus(); pending == nil && last != nil {
+			return last
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("service action still pending")
+	return nil
+}
+
+func TestSectionUpdatesAreCoalesced(t *testing.T) {
+	fake, h := newTestAPI(t)
+	useServiceApplyWindow(t, 50*time.Millisecond)
+
+	for _, body := range []string{
+		`{"public": {"path": "/srv/public", "comment": "one"}}`,
+		`{"public": {"path": "/srv/public", "comment": "two"}}`,
+		`{"public": {"path": "/srv/public", "comment": "three"}}`,
+	} {
+		rec := serve(h, http.MethodPost, "/config/sections/public", body)
+		var resp APIResponse
+		decode(t, rec, &resp)
+		if rec.Code != http.StatusOK || !resp.Queued || resp.Action != ServiceActionReload {
+			t.Fatalf("status = %d; response = %+v", rec.Code, resp)
+		}
+	}
+
+	var status ServiceStatusResponse
+	decode(t, serve(h, http.MethodGet, "/status", ""), &status)
+	if status.PendingAction == nil || status.PendingAction.Requests != 3 {
+		t.Fatalf("pending = %+v", status.PendingAction)
+	}
+
+	last := waitForServiceQueue(t)
+	if !last.Success || last.Action != ServiceActionReload || last.Requests != 3 {
+		t.Errorf("last action = %+v", last)
+	}
+	if fake.Reloads != 1 || fake.Restarts["smbd"] != 0 {
+		t.Errorf("reloads = %d, restarts = %d", fake.Reloads, fake.Restarts["smbd"])
+	}
+}
+
+func TestQueuedRestartWinsOverReload(t *testing.T) {
+	fake, h := newTestAPI(t)
+	useServiceApplyWindow(t, 50*time.Millisecond)
+
+	serve(h, http.MethodPost, "/reload", "")
+	serve(h, http.MethodPost, "/restart", "")
+	serve(h, http.MethodPost, "/reload", "")
+
+	last := waitForServiceQueue(t)
+	if last.Action != ServiceActionRestart || last.Requests != 3 {
+		t.Errorf("last action = %+v", last)
+	}
+	if fake.Reloads != 0 || fake.Restarts["smbd"] != 1 {
+		t.Errorf("reloads = %d, restarts = %d", fake.Reloads, fake.Restarts["smbd"])
+	}
+
+	var status ServiceStatusResponse
+	decode(t, serve(h, http.MethodGet, "/status", ""), &status)
+	if status.PendingAction != nil || status.LastAction == nil || !status.LastAction.Success {
+		t.Errorf("status = %+v", status)
+	}
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// Actions accepted by POST /services/{name}/{action}
+const (
+	UnitActionStart   = "start"
+	UnitActionStop    = "stop"
+	UnitActionRestart = "restart"
+	UnitActionEnable  = "enable"
+	UnitActionDisable = "disable"
+)
+
+// SambaUnit is a Samba-related service and the unit names distributions use for it
+type SambaUnit struct {
+	Name        string
+	Description string
+	Candidates  []string
+	// ReadsConfig units pick up smb.conf changes and restart with smbd
+	ReadsConfig bool
+}
+
+// sambaUnits lists the services the manager can control, in display order
+var sambaUnits = []SambaUnit{
+	{Name: "smbd", Description: "SMB file and print server", Candidates: []string{"smbd", "smb"}, ReadsConfig: true},
+	{Name: "nmbd", Description: "NetBIOS name server", Candidates: []string{"nmbd", "nmb"}, ReadsConfig: true},
+	{Name: "winbind", Description: "Name service switch and domain authentication", Candidates: []string{"winbind", "winbindd"}, ReadsConfig: true},
+	{Name: "samba-ad-dc", Description: "Active Directory domain controller", Candidates: []string{"samba-ad-dc", "samba"}, ReadsConfig: true},
+	{Name: "wsdd", Description: "Web Services Discovery for Windows network browsing", Candidates: []string{"wsdd", "wsdd2"}},
+	{Name: "avahi-daemon", Description: "mDNS/DNS-SD service discovery", Candidates: []string{"avahi-daemon"}},
+}
+
+// UnitStatus describes one Samba-related service
+type UnitStatus struct {
+	Name        string `json:"name"`
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description"`
+	Installed   bool   `json:"installed"`
+	Active      bool   `json:"active"`
+	Enabled     bool   `json:"enabled"`
+	Status      string `json:"status"`
+	Uptime      string `json:"uptime,omitempty"`
+	Since       string `json:"since,omitempty"`
+}
+
+// ServiceListResponse represents the response for the service overview
+type ServiceListResponse struct {
+	Services []UnitStatus `json:"services"`
+}
+
+// GetServices lists the installed Samba-related services
+func (h *APIHandler) GetServices(w http.ResponseWriter, r *http.Request) {
+	// Services that aren't installed are only listed on request
+	includeAll := r.URL.Query().Get("all") == "true"
+
+	response := ServiceListResponse{Services: []UnitStatus{}}
+	for _, unit := range sambaUnits {
+		status := getUnitStatus(unit)
+		if status.Installed || includeAll {
+			response.Services = append(response.Services, status)
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetService returns the status of one Samba-related service
+func (h *APIHandler) GetService(w http.ResponseWriter, r *http.Request) {
+	name := getRouteParam(regexp.MustCompile(`^/services/([^/]+)$`), r.URL.Path, 1)
+
+	unit, ok := findSambaUnit(name)
+	if !ok {
+		writeError(w, fmt.Sprintf("Unknown service %s", name), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(getUnitStatus(unit))
+}
+
+// ControlService starts, stops, restarts, enables or disables a service
+func (h *APIHandler) ControlService(w http.ResponseWriter, r *http.Request) {
+	re := regexp.MustCompile(`^/services/([^/]+)/([^/]+)$`)
+	name := getRouteParam(re, r.URL.Path, 1)
+	action := getRouteParam(re, r.URL.Path, 2)
+
+	unit, ok := findSambaUnit(name)
+	if !ok {
+		writeError(w, fmt.Sprintf("Unknown service %s", name), http.StatusNotFound)
+		return
+	}
+
+	unitName, installed := resolveUnit(unit)
+	if !installed {
+		writeError(w, fmt.Sprintf("Service %s is not installed", name), http.StatusNotFound)
+		return
+	}
+
+	if err := controlUnit(unitName, action); err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Service %s: %s succeeded", name, action),
+	})
+}
+
+// controlUnit runs a unit action while no reload or restart is in progress
+func controlUnit(unit, action string) error {
+	services := getBackend().Services
+
+	serviceActionMu.Lock()
+	defer serviceActionMu.Unlock()
+
+	var err error
+	switch action {
+	case UnitActionStart:
+		err = services.Start(unit)
+	case UnitActionStop:
+		err = services.Stop(unit)
+	case UnitActionRestart:
+		err = services.Restart(unit)
+	case UnitActionEnable:
+		err = services.Enable(unit)
+	case UnitActionDisable:
+		err = services.Disable(unit)
+	default:
+		return fmt.Errorf("Unknown service action %s", action)
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to %s %s: %v", action, unit, err)
+	}
+
+	return nil
+}
+
+// findSambaUnit looks up a service by its name
+func findSambaUnit(name string) (SambaUnit, bool) {
+	for _, unit := range sambaUnits {
+		if unit.Name == name {
+			return unit, true
+		}
+	}
+	return SambaUnit{}, false
+}
+
+// resolveUnit returns the first installed unit name of a service
+func resolveUnit(unit SambaUnit) (string, bool) {
+	services := getBackend().Services
+	for _, candidate := range unit.Candidates {
+		if installed, err := services.IsInstalled(candidate); err == nil && installed {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// getUnitStatus collects installation, activity and boot state of a service
+func getUnitStatus(unit SambaUnit) UnitStatus {
+	status := UnitStatus{Name: unit.Name, Description: unit.Description, Status: "not installed"}
+
+	unitName, installed := resolveUnit(unit)
+	if !installed {
+		return status
+	}
+
+	services := getBackend().Services
+	status.Unit = unitName
+	status.Installed = true
+	status.Active, _ = services.IsActive(unitName)
+	status.Enabled, _ = services.IsEnabled(unitName)
+	status.Status = map[bool]string{true: "running", false: "stopped"}[status.Active]
+
+	if status.Active {
+		uptime := unitUptime(unitName)
+		status.Uptime = uptime["uptime"]
+		status.Since = uptime["since"]
+	}
+
+	return status
+}
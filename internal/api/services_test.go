@@ -0,0 +1,55 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestServicesResolveDistributionUnitNames(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Units["nmb"] = false
+	fake.Units["wsdd2"] = true
+
+	var resp ServiceListResponse
+	decode(t, serve(h, http.MethodGet, "/services", ""), &resp)
+	units := make(map[string]UnitStatus)
+	for _, status := range resp.Services {
+		units[status.Name] = status
+	}
+	if len(units) != 3 || units["nmbd"].Unit != "nmb" || units["wsdd"].Unit != "wsdd2" {
+		t.Fatalf("services = %+v", resp.Services)
+	}
+
+	for _, action := range []string{"enable", "start"} {
+		if rec := serve(h, http.MethodPost, "/services/nmbd/"+action, ""); rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d; body: %s", action, rec.Code, rec.Body.String())
+		}
+	}
+	if _, running := fake.Services["nmb"]; !running || !fake.Units["nmb"] {
+		t.Errorf("nmb running = %v, enabled = %v", running, fake.Units["nmb"])
+	}
+}
+
+func TestRestartIncludesRunningConfigDaemons(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Units["nmbd"] = true
+	fake.Units["winbind"] = true
+	fake.Units["avahi-daemon"] = true
+	serve(h, http.MethodPost, "/services/nmbd/start", "")
+	serve(h, http.MethodPost, "/services/avahi-daemon/start", "")
+
+	if rec := serve(h, http.MethodPost, "/restart", ""); rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	// winbind is stopped and avahi doesn't read smb.conf
+	want := map[string]int{"smbd": 1, "nmbd": 1}
+	for unit, restarts := range fake.Restarts {
+		if restarts != want[unit] {
+			t.Errorf("%s restarts = %d", unit, restarts)
+		}
+	}
+	if len(fake.Restarts) != len(want) {
+		t.Errorf("restarts = %v", fake.Restarts)
+	}
+}
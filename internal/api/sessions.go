@@ -0,0 +1,391 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SessionInfo is a session with the shares it is connected to
+type SessionInfo struct {
+	SambaSession
+	Shares []string `json:"shares"`
+}
+
+// SessionListResponse represents the response for session listing
+type SessionListResponse struct {
+	Sessions []SessionInfo `json:"sessions"`
+}
+
+// ConnectionListResponse represents the response for share connection listing
+type ConnectionListResponse struct {
+	Connections []TreeConnect `json:"connections"`
+}
+
+// OpenFileListResponse represents the response for open file listing
+type OpenFileListResponse struct {
+	OpenFiles []OpenFile `json:"openFiles"`
+}
+
+// CloseFileRequest identifies an open file by the process holding it
+type CloseFileRequest struct {
+	PID  string `json:"pid"`
+	Path string `json:"path"`
+}
+
+// clientFilter selects clients by user and share, empty fields match everything
+type clientFilter struct {
+	User  string
+	Share string
+}
+
+// newClientFilter reads the user and share query parameters
+func newClientFilter(r *http.Request) clientFilter {
+	return clientFilter{User: r.URL.Query().Get("user"), Share: r.URL.Query().Get("share")}
+}
+
+// matches reports whether a user and share pass the filter
+func (f clientFilter) matches(user, share string) bool {
+	if f.User != "" && !strings.EqualFold(f.User, user) {
+		return false
+	}
+	if f.Share != "" && !strings.EqualFold(f.Share, share) {
+		return false
+	}
+	return true
+}
+
+// GetSessions lists connected SMB sessions, filtered by ?user= and ?share=
+func (h *APIHandler) GetSessions(w http.ResponseWriter, r *http.Request) {
+	status, err := getClientStatus()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filter := newClientFilter(r)
+	response := SessionListResponse{Sessions: []SessionInfo{}}
+	for _, session := range status.Sessions {
+		info := SessionInfo{SambaSession: session, Shares: []string{}}
+		for _, tcon := range status.Connections {
+			if tcon.PID == session.PID && (tcon.SessionID == "" || tcon.SessionID == session.SessionID) {
+				info.Shares = append(info.Shares, tcon.Share)
+			}
+		}
+
+		if filter.User != "" && !strings.EqualFold(filter.User, session.User) {
+			continue
+		}
+		if filter.Share != "" && !containsFold(info.Shares, filter.Share) {
+			continue
+		}
+		response.Sessions = append(response.Sessions, info)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetConnections lists share connections, filtered by ?user= and ?share=
+func (h *APIHandler) GetConnections(w http.ResponseWriter, r *http.Request) {
+	status, err := getClientStatus()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filter := newClientFilter(r)
+	response := ConnectionListResponse{Connections: []TreeConnect{}}
+	for _, tcon := range status.Connections {
+		if filter.matches(tcon.User, tcon.Share) {
+			response.Connections = append(response.Connections, tcon)
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetOpenFiles lists open files and their locks, filtered by ?user= and ?share=
+func (h *APIHandler) GetOpenFiles(w http.ResponseWriter, r *http.Request) {
+	status, err := getClientStatus()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	filter := newClientFilter(r)
+	response := OpenFileListResponse{OpenFiles: []OpenFile{}}
+	for _, file := range status.OpenFiles {
+		if filter.matches(file.User, file.Share) {
+			response.OpenFiles = append(response.OpenFiles, file)
+		}
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// DisconnectSession terminates the smbd process serving one client
+func (h *APIHandler) DisconnectSession(w http.ResponseWriter, r *http.Request) {
+	pid := getRouteParam(regexp.MustCompile(`^/sessions/([^/]+)$`), r.URL.Path, 1)
+
+	if _, err := strconv.Atoi(pid); err != nil {
+		writeError(w, fmt.Sprintf("Invalid process ID %s", pid), http.StatusBadRequest)
+		return
+	}
+
+	status, err := getClientStatus()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !hasClientProcess(status, pid) {
+		writeError(w, fmt.Sprintf("No session is served by process %s", pid), http.StatusNotFound)
+		return
+	}
+
+	err = getBackend().Control.KillSession(pid)
+	recordAudit(r, "session.disconnect", pid, "", err)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to disconnect session %s: %v", pid, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("Session %s disconnected", pid),
+	})
+}
+
+// DisconnectUser terminates every session of a user
+func (h *APIHandler) DisconnectUser(w http.ResponseWriter, r *http.Request) {
+	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)/disconnect$`), r.URL.Path, 1)
+
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	count, err := disconnectUserSessions(r, username)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("%d sessions of %s disconnected", count, username),
+	})
+}
+
+// DisconnectShare disconnects every client from a share
+func (h *APIHandler) DisconnectShare(w http.ResponseWriter, r *http.Request) {
+	shareName := getRouteParam(regexp.MustCompile(`^/shares/([^/]+)/disconnect$`), r.URL.Path, 1)
+
+	config, err := ReadConfig()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if _, exists := config[shareName]; !exists || shareName == "global" {
+		writeError(w, "Share not found", http.StatusNotFound)
+		return
+	}
+
+	count, err := disconnectShareClients(r, shareName)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("%d connections to %s closed", count, shareName),
+	})
+}
+
+// CloseOpenFile force-closes an open file. Samba has no local command to
+// close a single handle, so the process holding it is shut down, which
+// closes every file of that client.
+func (h *APIHandler) CloseOpenFile(w http.ResponseWriter, r *http.Request) {
+	var request CloseFileRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+	if _, err := strconv.Atoi(request.PID); err != nil || request.Path == "" {
+		writeError(w, "A process ID and file path are required", http.StatusBadRequest)
+		return
+	}
+
+	status, err := getClientStatus()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var file *OpenFile
+	for i, open := range status.OpenFiles {
+		if open.PID == request.PID && path.Join(open.SharePath, open.Name) == path.Clean(request.Path) {
+			file = &status.OpenFiles[i]
+			break
+		}
+	}
+	if file == nil {
+		writeError(w, fmt.Sprintf("%s is not open by process %s", request.Path, request.PID), http.StatusNotFound)
+		return
+	}
+
+	others := 0
+	for _, open := range status.OpenFiles {
+		if open.PID == request.PID {
+			others++
+		}
+	}
+
+	err = getBackend().Control.KillSession(request.PID)
+	recordAudit(r, "file.close", request.Path, fmt.Sprintf("pid %s, user %s, %d open files", request.PID, file.User, others), err)
+	if err != nil {
+		writeError(w, fmt.Sprintf("Failed to close %s: %v", request.Path, err), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(APIResponse{
+		Status:  "success",
+		Message: fmt.Sprintf("%s closed by disconnecting session %s (%d open files)", request.Path, request.PID, others),
+	})
+}
+
+// disconnectUserSessions shuts down every process serving a user and
+// returns how many were shut down
+func disconnectUserSessions(r *http.Request, username string) (int, error) {
+	status, err := getClientStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	seen := make(map[string]bool)
+	for _, session := range status.Sessions {
+		if !strings.EqualFold(session.User, username) || seen[session.PID] {
+			continue
+		}
+		seen[session.PID] = true
+
+		err := getBackend().Control.KillSession(session.PID)
+		recordAudit(r, "session.disconnect", session.PID, "user "+username, err)
+		if err != nil {
+			return count, fmt.Errorf("Failed to disconnect session %s of %s: %v", session.PID, username, err)
+		}
+		count++
+	}
+
+	return count, nil
+}
+
+// disconnectShareClients closes all connections to a share and returns how
+// many there were
+func disconnectShareClients(r *http.Request, shareName string) (int, error) {
+	status, err := getClientStatus()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, tcon := range status.Connections {
+		if strings.EqualFold(tcon.Share, shareName) {
+			count++
+		}
+	}
+	if count == 0 {
+		return 0, nil
+	}
+
+	err = getBackend().Control.CloseShare(shareName)
+	recordAudit(r, "share.disconnect", shareName, fmt.Sprintf("%d connections", count), err)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to disconnect clients from %s: %v", shareName, err)
+	}
+
+	return count, nil
+}
+
+// hasClientProcess reports whether a process serves any session or connection
+func hasClientProcess(status SambaStatus, pid string) bool {
+	for _, session := range status.Sessions {
+		if session.PID == pid {
+			return true
+		}
+	}
+	for _, tcon := range status.Connections {
+		if tcon.PID == pid {
+			return true
+		}
+	}
+	return false
+}
+
+// getClientStatus reads the client snapshot and fills in the user of share
+// connections and the user and share of open files, which smbstatus only
+// reports through the serving process
+func getClientStatus() (SambaStatus, error) {
+	status, err := getBackend().Sessions.Status()
+	if err != nil {
+		return status, err
+	}
+
+	users := make(map[string]string)
+	for _, session := range status.Sessions {
+		users[session.PID] = session.User
+	}
+
+	sharesByPID := make(map[string][]string)
+	for i, tcon := range status.Connections {
+		if tcon.User == "" {
+			status.Connections[i].User = users[tcon.PID]
+		}
+		sharesByPID[tcon.PID] = append(sharesByPID[tcon.PID], tcon.Share)
+	}
+
+	sharesByPath := make(map[string]string)
+	if config, err := ReadConfig(); err == nil {
+		for name, section := range config {
+			if path := section["path"]; name != "global" && path != "" && !strings.Contains(path, "%") {
+				sharesByPath[strings.TrimSuffix(path, "/")] = name
+			}
+		}
+	}
+
+	for i, file := range status.OpenFiles {
+		if file.User == "" {
+			status.OpenFiles[i].User = users[file.PID]
+		}
+		if file.Share != "" {
+			continue
+		}
+		if share, ok := sharesByPath[strings.TrimSuffix(file.SharePath, "/")]; ok {
+			status.OpenFiles[i].Share = share
+		} else if shares := sharesByPID[file.PID]; len(shares) == 1 {
+			// Shares with macros in their path, such as [homes]
+			status.OpenFiles[i].Share = shares[0]
+		}
+	}
+
+	return status, nil
+}
+
+// containsFold reports whether list contains value, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
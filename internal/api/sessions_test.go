@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+const testSmbstatusJSON = `{
+  "version": "4.17.12-Debian",
+  "sessions": {
+    "3744231845": {
+      "session_id": "3744231845",
+      "server_id": {"pid": "2436", "task_id": "0", "vnn": "4294967295"},
+      "uid": 1000, "gid": 1000,
+      "username": "alice", "groupname": "alice",
+      "remote_machine": "192.168.1.10",
+      "hostname": "ipv4:192.168.1.10:54321",
+      "session_dialect": "SMB3_11",
+      "encryption": {"cipher": "", "degree": "none"},
+      "signing": {"cipher": "AES-128-GMAC", "degree": "partial"}
+    }
+  },
+  "tcons": {
+    "2913853408": {
+      "service": "public",
+      "server_id": {"pid": "2436"},
+      "tcon_id": "2913853408",
+      "session_id": "3744231845",
+      "machine": "192.168.1.10",
+      "connected_at": "2023-10-16T10:00:00.000000+02:00",
+      "encryption": {"cipher": "AES-128-GCM", "degree": "full"},
+      "signing": {"cipher": "", "degree": "none"}
+    }
+  },
+  "open_files": {
+    "/srv/public/report.odt": {
+      "service_path": "/srv/public",
+      "filename": "report.odt",
+      "opens": {
+        "2436/7": {
+          "server_id": {"pid": "2436"},
+          "uid": 1000,
+          "sharemode": {"READ": true, "WRITE": false, "text": "R"},
+          "access_mask": {"text": "RW"},
+          "oplock": {"text": "LEASE"},
+          "lease": {"text": "RWH"},
+          "opened_at": "2023-10-16T10:01:00.000000+02:00"
+        }
+      }
+    }
+  }
+}`
+
+const testSmbstatusText = `
+Samba version 4.15.13-Ubuntu
+PID     Username     Group        Machine                                   Protocol Version  Encryption           Signing
+----------------------------------------------------------------------------------------------------------------------------------------
+2436    alice        alice        192.168.1.10 (ipv4:192.168.1.10:54321)    SMB3_11           -                    partial(AES-128-CMAC)
+
+Service      pid     Machine       Connected at                     Encryption   Signing
+---------------------------------------------------------------------------------------------
+public       2436    192.168.1.10  Mon Oct 16 10:00:00 AM 2023 CEST -            -
+
+Locked files:
+Pid          User(ID)   DenyMode   Access      R/W        Oplock           SharePath   Name   Time
+--------------------------------------------------------------------------------------------------
+2436         1000       DENY_WRITE 0x12019f    RDWR       LEASE(RWH)       /srv/public   Q3 report.odt   Mon Oct 16 10:01:00 2023
+
+`
+
+func TestParseSmbstatusJSON(t *testing.T) {
+	status, err := parseSmbstatusJSON(testSmbstatusJSON)
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+
+	want := SambaSession{SessionID: "3744231845", PID: "2436", User: "alice", Group: "alice", ClientIP: "192.168.1.10", Protocol: "SMB3_11", Encryption: "-", Signing: "partial(AES-128-GMAC)"}
+	if len(status.Sessions) != 1 || status.Sessions[0] != want {
+		t.Errorf("sessions = %+v", status.Sessions)
+	}
+	if len(status.Connections) != 1 || status.Connections[0].Share != "public" || status.Connections[0].Encryption != "full(AES-128-GCM)" {
+		t.Errorf("connections = %+v", status.Connections)
+	}
+	file := OpenFile{PID: "2436", UID: 1000, SharePath: "/srv/public", Name: "report.odt", DenyMode: "DENY_WRITE", Access: "RDWR", Lock: "LEASE(RWH)", OpenedAt: "2023-10-16T10:01:00.000000+02:00"}
+	if len(status.OpenFiles) != 1 || status.OpenFiles[0] != file {
+		t.Errorf("open files = %+v", status.OpenFiles)
+	}
+}
+
+func TestParseSmbstatusText(t *testing.T) {
+	status := parseSmbstatusText(testSmbstatusText)
+
+	want := SambaSession{PID: "2436", User: "alice", Group: "alice", ClientIP: "192.168.1.10", Protocol: "SMB3_11", Encryption: "-", Signing: "partial(AES-128-CMAC)"}
+	if len(status.Sessions) != 1 || status.Sessions[0] != want {
+		t.Errorf("sessions = %+v", status.Sessions)
+	}
+	tcon := TreeConnect{Share: "public", PID: "2436", ClientIP: "192.168.1.10", ConnectedAt: "Mon Oct 16 10:00:00 AM 2023 CEST", Encryption: "-", Signing: "-"}
+	if len(status.Connections) != 1 || status.Connections[0] != tcon {
+		t.Errorf("connections = %+v", status.Connections)
+	}
+	file := OpenFile{PID: "2436", UID: 1000, SharePath: "/srv/public", Name: "Q3 report.odt", DenyMode: "DENY_WRITE", Access: "RDWR", Lock: "LEASE(RWH)", OpenedAt: "Mon Oct 16 10:01:00 2023"}
+	if len(status.OpenFiles) != 1 || status.OpenFiles[0] != file {
+		t.Errorf("open files = %+v", status.OpenFiles)
+	}
+}
+
+func TestClientEndpointsFilterByUserAndShare(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.Clients = parseSmbstatusText(testSmbstatusText)
+	fake.Clients.Sessions = append(fake.Clients.Sessions, SambaSession{PID: "2500", User: "bob", ClientIP: "192.168.1.11"})
+	fake.Clients.Connections = append(fake.Clients.Connections, TreeConnect{Share: "bob", PID: "2500"})
+	fake.Clients.OpenFiles = append(fake.Clients.OpenFiles, OpenFile{PID: "2500", SharePath: "/home/bob", Name: "notes.txt"})
+
+	var sessions SessionListResponse
+	decode(t, serve(h, http.MethodGet, "/sessions?share=public", ""), &sessions)
+	if len(sessions.Sessions) != 1 || sessions.Sessions[0].User != "alice" || len(sessions.Sessions[0].Shares) != 1 {
+		t.Errorf("sessions = %+v", sessions.Sessions)
+	}
+
+	var connections ConnectionListResponse
+	decode(t, serve(h, http.MethodGet, "/connections?user=ALICE", ""), &connections)
+	if len(connections.Connections) != 1 || connections.Connections[0].User != "alice" {
+		t.Errorf("connections = %+v", connections.Connections)
+	}
+
+	var files OpenFileListResponse
+	decode(t, serve(h, http.MethodGet, "/open-files?user=bob", ""), &files)
+	if len(files.OpenFiles) != 1 || files.OpenFiles[0].Share != "bob" {
+		t.Errorf("open files = %+v", files.OpenFiles)
+	}
+	decode(t, serve(h, http.MethodGet, "/open-files?share=public", ""), &files)
+	if len(files.OpenFiles) != 1 || files.OpenFiles[0].User != "alice" {
+		t.Errorf("open files = %+v", files.OpenFiles)
+	}
+}
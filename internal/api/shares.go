@@ -1,12 +1,9 @@
 package api
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"os/exec"
 	"regexp"
 	"strings"
 )
@@ -78,6 +75,12 @@ func (h *APIHandler) CreateUpdateShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Validate path, owner, group and permissions before they reach system commands
+	if err := validateShareData(shareData); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	// Validate users in valid users and write list
 	if err := validateShareUsers(shareData); err != nil {
 		writeError(w, err.Error(), http.StatusBadRequest)
@@ -113,18 +116,26 @@ func (h *APIHandler) DeleteShare(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	delete(shares, shareName)
-
-	err = WriteConfig(shares)
+	// WriteConfig keeps sections missing from the map, so the share is
+	// removed from the file explicitly
+	err = removeConfigSection(shareName)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	// Clients still connected would keep using the removed share
+	message := "Share deleted successfully"
+	if count, err := disconnectShareClients(r, shareName); err != nil {
+		message = fmt.Sprintf("%s, but connected clients were not disconnected: %v", message, err)
+	} else if count > 0 {
+		message = fmt.Sprintf("%s, %d connections closed", message, count)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
-		Message: "Share deleted successfully",
+		Message: message,
 	})
 }
 
@@ -136,32 +147,48 @@ func createShareDirectory(shareData Share) error {
 		return nil // No path defined, nothing to create
 	}
 
+	// Paths with Samba macros (e.g. /srv/homes/%S) are expanded per connection
+	if strings.Contains(path, "%") {
+		return nil
+	}
+
+	if err := validateShareData(shareData); err != nil {
+		return err
+	}
+
+	sys := getBackend()
+
 	// Create the directory with standard permissions
-	err := os.MkdirAll(path, 0755)
+	err := sys.Files.MkdirAll(path, 0755)
 	if err != nil {
 		return fmt.Errorf("Failed to create directory: %v", err)
 	}
 
 	// Set owner if specified
 	if owner, exists := shareData["owner"]; exists && owner != "" {
-		cmd := exec.Command("chown", owner, path)
-		if err := cmd.Run(); err != nil {
+		account, err := sys.Accounts.LookupUser(owner)
+		if err == nil {
+			err = sys.Files.Chown(path, account.UID, -1)
+		}
+		if err != nil {
 			return fmt.Errorf("Failed to set owner: %v", err)
 		}
 	}
 
 	// Set group if specified
 	if group, exists := shareData["group"]; exists && group != "" {
-		cmd := exec.Command("chgrp", group, path)
-		if err := cmd.Run(); err != nil {
+		entry, err := sys.Accounts.LookupGroup(group)
+		if err == nil {
+			err = sys.Files.Chown(path, -1, entry.GID)
+		}
+		if err != nil {
 			return fmt.Errorf("Failed to set group: %v", err)
 		}
 	}
 
 	// Set permissions if specified
 	if permissions, exists := shareData["permissions"]; exists && permissions != "" {
-		cmd := exec.Command("chmod", permissions, path)
-		if err := cmd.Run(); err != nil {
+		if err := sys.Files.Chmod(path, permissions); err != nil {
 			return fmt.Errorf("Failed to set permissions: %v", err)
 		}
 	}
@@ -193,8 +220,8 @@ func setupShareACL(shareData Share) error {
 	}
 
 	// Reset ACLs recursively
-	clearCmd := exec.Command("setfacl", "-Rb", path)
-	if err := clearCmd.Run(); err != nil {
+	acls := getBackend().ACLs
+	if err := acls.ClearACL(path); err != nil {
 		return fmt.Errorf("Failed to reset existing ACLs recursively: %v", err)
 	}
 
@@ -212,29 +239,31 @@ func setupShareACL(shareData Share) error {
 			if strings.HasPrefix(entry, "@") || strings.HasPrefix(entry, "+") {
 				// It's a group - remove the prefix to get the group name
 				groupName := strings.TrimPrefix(strings.TrimPrefix(entry, "@"), "+")
+				if err := validateGroupName(groupName); err != nil {
+					return err
+				}
 
 				// Set read and execute permissions for group recursively to all files and directories
-				groupCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("g:%s:r-x", groupName), path)
-				if err := groupCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("g:%s:r-x", groupName)); err != nil {
 					return fmt.Errorf("Failed to set ACL for valid group %s: %v", groupName, err)
 				}
 
 				// Set read and execute permissions for group defaults recursively to all files and directories
-				defaultGroupCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("d:g:%s:r-x", groupName), path)
-				if err := defaultGroupCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("d:g:%s:r-x", groupName)); err != nil {
 					return fmt.Errorf("Failed to set default ACL for valid group %s: %v", groupName, err)
 				}
 			} else {
 				// It's a user
+				if err := validateUsername(entry); err != nil {
+					return err
+				}
 				// Set read and execute permissions for user recursively to all files and directories
-				userCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("u:%s:r-x", entry), path)
-				if err := userCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("u:%s:r-x", entry)); err != nil {
 					return fmt.Errorf("Failed to set ACL for valid user %s: %v", entry, err)
 				}
 
 				// Set read and execute permissions for user defaults recursively to all files and directories
-				defaultUserCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("d:u:%s:r-x", entry), path)
-				if err := defaultUserCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("d:u:%s:r-x", entry)); err != nil {
 					return fmt.Errorf("Failed to set default ACL for valid user %s: %v", entry, err)
 				}
 			}
@@ -255,29 +284,31 @@ func setupShareACL(shareData Share) error {
 			if strings.HasPrefix(entry, "@") || strings.HasPrefix(entry, "+") {
 				// It's a group - remove the prefix to get the group name
 				groupName := strings.TrimPrefix(strings.TrimPrefix(entry, "@"), "+")
+				if err := validateGroupName(groupName); err != nil {
+					return err
+				}
 
 				// Set read, write, and execute permissions for group recursively to all files and directories
-				groupCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("g:%s:rwx", groupName), path)
-				if err := groupCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("g:%s:rwx", groupName)); err != nil {
 					return fmt.Errorf("Failed to set ACL for write list group %s: %v", groupName, err)
 				}
 
 				// Set read, write, and execute permissions for group defaults recursively to all files and directories
-				defaultGroupCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("d:g:%s:rwx", groupName), path)
-				if err := defaultGroupCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("d:g:%s:rwx", groupName)); err != nil {
 					return fmt.Errorf("Failed to set ACL for write list group %s: %v", groupName, err)
 				}
 			} else {
 				// It's a user
+				if err := validateUsername(entry); err != nil {
+					return err
+				}
 				// Set read, write, and execute permissions for user recursively to all files and directories
-				userCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("u:%s:rwx", entry), path)
-				if err := userCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("u:%s:rwx", entry)); err != nil {
 					return fmt.Errorf("Failed to set ACL for write list user %s: %v", entry, err)
 				}
 
 				// Set read, write, and execute permissions for user defaults recursively to all files and directories
-				defaultUserCmd := exec.Command("setfacl", "-R", "-m", fmt.Sprintf("d:u:%s:rwx", entry), path)
-				if err := defaultUserCmd.Run(); err != nil {
+				if err := acls.ModifyACL(path, fmt.Sprintf("d:u:%s:rwx", entry)); err != nil {
 					return fmt.Errorf("Failed to set ACL for write list user %s: %v", entry, err)
 				}
 			}
@@ -287,6 +318,35 @@ func setupShareACL(shareData Share) error {
 	return nil
 }
 
+// validateShareData validates the share parameters that are passed to system commands
+func validateShareData(shareData Share) error {
+	if path, exists := shareData["path"]; exists && !strings.Contains(path, "%") {
+		if err := validateSharePath(path); err != nil {
+			return err
+		}
+	}
+
+	if owner, exists := shareData["owner"]; exists && owner != "" {
+		if err := validateUsername(owner); err != nil {
+			return err
+		}
+	}
+
+	if group, exists := shareData["group"]; exists && group != "" {
+		if err := validateGroupName(group); err != nil {
+			return err
+		}
+	}
+
+	if permissions, exists := shareData["permissions"]; exists && permissions != "" {
+		if err := validateFileMode(permissions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // validateShareUsers validates that all users listed in "valid users" and "write list" exist in Samba
 func validateShareUsers(shareData Share) error {
 	// Get the list of existing Samba users
@@ -346,76 +406,15 @@ func validateShareUsers(shareData Share) error {
 
 // getShareACLs gets the current ACLs for a share
 func getShareACLs(sharePath string) (ShareACLs, error) {
-	result := ShareACLs{
-		Path:    sharePath,
-		Owner:   "",
-		Group:   "",
-		Entries: []ACLEntry{},
+	if err := validateSharePath(sharePath); err != nil {
+		return ShareACLs{Path: sharePath, Entries: []ACLEntry{}}, err
 	}
 
-	// Use getfacl to get the current ACLs
-	cmd := exec.Command("getfacl", "-p", sharePath)
-	output, err := cmd.CombinedOutput()
+	result, err := getBackend().ACLs.GetACL(sharePath)
 	if err != nil {
 		return result, fmt.Errorf("Failed to get ACLs: %v", err)
 	}
 
-	// Parse the output
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-
-		// Skip empty lines
-		if line == "" {
-			continue
-		}
-
-		// Extract owner and group info
-		if strings.HasPrefix(line, "# owner:") {
-			result.Owner = strings.TrimSpace(strings.TrimPrefix(line, "# owner:"))
-			continue
-		}
-		if strings.HasPrefix(line, "# group:") {
-			result.Group = strings.TrimSpace(strings.TrimPrefix(line, "# group:"))
-			continue
-		}
-
-		// Skip other comment lines and file name line
-		if strings.HasPrefix(line, "#") {
-			continue
-		}
-
-		// Check if it's a default ACL
-		isDefault := false
-		if strings.HasPrefix(line, "default:") {
-			isDefault = true
-			line = strings.TrimPrefix(line, "default:")
-		}
-
-		// Parse ACL entries (user::rwx, group::r-x, etc.)
-		parts := strings.Split(line, ":")
-		if len(parts) >= 2 {
-			entryType := parts[0]
-			user := parts[1]
-			permission := ""
-
-			if len(parts) >= 3 {
-				permission = parts[2]
-			}
-
-			// Only add named users and groups (skip entries with empty user field which are for owner/group/other)
-			if (entryType == "user" || entryType == "group") && user != "" {
-				entry := ACLEntry{
-					Type:       entryType,
-					User:       user,
-					Permission: permission,
-					Default:    isDefault,
-				}
-				result.Entries = append(result.Entries, entry)
-			}
-		}
-	}
-
 	return result, nil
 }
 
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os/exec"
 	"strconv"
 	"strings"
 	"sync"
@@ -122,55 +121,15 @@ func GetFileSystemSizes() (DisksResponse, error) {
 		}
 	}
 
-	// Execute df command to get filesystem usage
-	cmd := exec.Command("df", "-h")
-	output, err := cmd.CombinedOutput()
+	// Get filesystem usage
+	disks, err := getBackend().Disks.Filesystems()
 	if err != nil {
 		return DisksResponse{}, err
 	}
 
-	// Parse output
-	lines := strings.Split(string(output), "\n")
-	var disks []DiskInfo
-
-	// Skip header line
-	for i := 1; i < len(lines); i++ {
-		line := strings.TrimSpace(lines[i])
-		if line == "" {
-			continue
-		}
-
-		// Split by whitespace with special handling for filesystems with spaces
-		fields := strings.Fields(line)
-		if len(fields) < 6 {
-			continue
-		}
-
-		// Extract percentage and convert to float
-		usePercentStr := strings.TrimSuffix(fields[4], "%")
-		usePercent, _ := strconv.ParseFloat(usePercentStr, 64)
-
-		// Get mount path and create a display name (shortened if too long)
-		mountPath := fields[5]
-		displayName := createDisplayName(mountPath)
-
-		// Get filesystem type and check if it's a virtual filesystem
-		fsType := fields[0]
-		isVirtualFS := virtualFilesystemTypes[fsType]
-
-		// Create filesystem info
-		filesystem := DiskInfo{
-			Filesystem:  fsType,
-			Size:        fields[1],
-			Used:        fields[2],
-			Available:   fields[3],
-			UsePercent:  usePercent,
-			MountedOn:   mountPath,
-			DisplayName: displayName,
-			IsVirtualFS: isVirtualFS,
-		}
-
-		disks = append(disks, filesystem)
+	// Create a display name (shortened if too long) for each mount path
+	for i := range disks {
+		disks[i].DisplayName = createDisplayName(disks[i].MountedOn)
 	}
 
 	// Update cache
@@ -246,22 +205,16 @@ func getShareSizes() (ShareSizesResponse, error) {
 		// Get filesystem info for the mount
 		filesystemInfo := mountMap[bestMount]
 
-		// Get directory size using du command
-		cmd := exec.Command("du", "-sh", path)
-		output, err := cmd.CombinedOutput()
-		if err != nil {
-			// Skip if we can't get the directory size
+		// Get directory size
+		if err := validateSharePath(path); err != nil {
 			continue
 		}
-
-		// Parse the output
-		parts := strings.Fields(string(output))
-		if len(parts) < 2 {
+		dirSize, err := getBackend().Disks.DirectorySize(path)
+		if err != nil {
+			// Skip if we can't get the directory size
 			continue
 		}
 
-		dirSize := parts[0]
-
 		// Parse directory size to calculate usage percentage
 		sizeStr := filesystemInfo.Size
 		usedStr := dirSize
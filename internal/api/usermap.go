@@ -0,0 +1,399 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// UsernameMapEntry maps one or more Windows names to a Unix user
+type UsernameMapEntry struct {
+	UnixName     string   `json:"unixName"`
+	WindowsNames []string `json:"windowsNames"`
+	// Stop marks a "!" rule that ends processing when it matches
+	Stop bool `json:"stop,omitempty"`
+}
+
+// UsernameMapIssue describes a problem found while validating the username map
+type UsernameMapIssue struct {
+	Entry   int    `json:"entry"`
+	Name    string `json:"name,omitempty"`
+	Message string `json:"message"`
+}
+
+// UsernameMap represents the username map file and its validation result
+type UsernameMap struct {
+	Path      string             `json:"path"`
+	Entries   []UsernameMapEntry `json:"entries"`
+	Errors    []UsernameMapIssue `json:"errors,omitempty"`
+	Conflicts []UsernameMapIssue `json:"conflicts,omitempty"`
+	Warnings  []UsernameMapIssue `json:"warnings,omitempty"`
+	Action    string             `json:"action,omitempty"`
+}
+
+// usernameMapHeader starts the username map files created by the manager
+const usernameMapHeader = "# Username map managed by samba-manager"
+
+// usernameMapTokenRegex matches a quoted or unquoted name on the Windows side
+var usernameMapTokenRegex = regexp.MustCompile(`"[^"]*"|[^\s"]+`)
+
+// GetUsernameMap returns the parsed username map with validation results
+func (h *APIHandler) GetUsernameMap(w http.ResponseWriter, r *http.Request) {
+	path, err := usernameMapPath()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usermap := UsernameMap{Path: path, Entries: []UsernameMapEntry{}}
+	if path != "" {
+		entries, _, err := readUsernameMap(path)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		usermap.Entries = entries
+		validateUsernameMap(&usermap)
+	}
+
+	json.NewEncoder(w).Encode(usermap)
+}
+
+// ValidateUsernameMap checks username map entries without saving them
+func (h *APIHandler) ValidateUsernameMap(w http.ResponseWriter, r *http.Request) {
+	var usermap UsernameMap
+	if err := json.NewDecoder(r.Body).Decode(&usermap); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	validateUsernameMap(&usermap)
+	json.NewEncoder(w).Encode(usermap)
+}
+
+// UpdateUsernameMap replaces the entries of the username map file
+func (h *APIHandler) UpdateUsernameMap(w http.ResponseWriter, r *http.Request) {
+	var usermap UsernameMap
+	if err := json.NewDecoder(r.Body).Decode(&usermap); err != nil {
+		writeError(w, "Invalid JSON format", http.StatusBadRequest)
+		return
+	}
+
+	configured, err := usernameMapPath()
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The path can only be chosen when smb.conf does not name one yet
+	if configured != "" {
+		if usermap.Path != "" && usermap.Path != configured {
+			writeError(w, fmt.Sprintf("The username map is configured as %s", configured), http.StatusBadRequest)
+			return
+		}
+		usermap.Path = configured
+	}
+	if usermap.Path == "" {
+		writeError(w, "No username map configured in [global] and no path given", http.StatusBadRequest)
+		return
+	}
+	if !filepath.IsAbs(usermap.Path) || filepath.Clean(usermap.Path) != usermap.Path {
+		writeError(w, "Username map path must be an absolute, clean path", http.StatusBadRequest)
+		return
+	}
+	if configured == "" {
+		if err := checkNewUsernameMapPath(usermap.Path); err != nil {
+			writeError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	validateUsernameMap(&usermap)
+	if len(usermap.Errors) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(usermap)
+		return
+	}
+	if len(usermap.Conflicts) > 0 && r.URL.Query().Get("force") != "true" {
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(usermap)
+		return
+	}
+
+	if err := writeUsernameMap(usermap.Path, usermap.Entries); err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if configured == "" {
+		config, err := ReadConfig()
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if config["global"] == nil {
+			config["global"] = make(SectionConfig)
+		}
+		config["global"]["username map"] = usermap.Path
+		if err := WriteConfig(config); err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		action, _, err := queueServiceAction(ServiceActionReload)
+		if err != nil {
+			writeError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		usermap.Action = action
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(usermap)
+}
+
+// usernameMapPath returns the username map file named in [global]
+func usernameMapPath() (string, error) {
+	config, err := ReadConfig()
+	if err != nil {
+		return "", err
+	}
+	return config["global"]["username map"], nil
+}
+
+// checkNewUsernameMapPath makes sure a username map that is not configured
+// yet is created next to smb.conf and does not replace an unrelated file
+func checkNewUsernameMapPath(path string) error {
+	configDir := filepath.Dir(GetConfigPath())
+	rel, err := filepath.Rel(configDir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("A new username map must be inside %s", configDir)
+	}
+
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Failed to check username map path: %v", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s exists and is not a regular file", path)
+	}
+
+	// Only files created by the manager may be taken over
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Failed to check username map path: %v", err)
+	}
+	if !strings.HasPrefix(string(data), usernameMapHeader+"\n") {
+		return fmt.Errorf("%s already exists and was not created by samba-manager", path)
+	}
+	return nil
+}
+
+// usernameMapComments holds the comment and blank lines of a username map
+type usernameMapComments struct {
+	before [][]string // lines preceding each entry
+	after  []string   // lines following the last entry
+}
+
+// readUsernameMap parses a username map file, returning its entries and the
+// comment lines around them
+func readUsernameMap(path string) ([]UsernameMapEntry, usernameMapComments, error) {
+	entries := []UsernameMapEntry{}
+	var comments usernameMapComments
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return entries, comments, nil
+	}
+	if err != nil {
+		return nil, comments, fmt.Errorf("Failed to read username map: %v", err)
+	}
+
+	var pending []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		eq := strings.Index(trimmed, "=")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";") || eq < 0 {
+			pending = append(pending, strings.TrimRight(line, " \t\r"))
+			continue
+		}
+
+		entry := UsernameMapEntry{UnixName: strings.TrimSpace(trimmed[:eq])}
+		if strings.HasPrefix(entry.UnixName, "!") {
+			entry.Stop = true
+			entry.UnixName = strings.TrimSpace(entry.UnixName[1:])
+		}
+		for _, token := range usernameMapTokenRegex.FindAllString(trimmed[eq+1:], -1) {
+			entry.WindowsNames = append(entry.WindowsNames, strings.Trim(token, `"`))
+		}
+		entries = append(entries, entry)
+		comments.before = append(comments.before, pending)
+		pending = nil
+	}
+	comments.after = pending
+
+	return entries, comments, nil
+}
+
+// writeUsernameMap rewrites the entries of a username map file. Comments stay
+// in front of the entry they precede; those of removed entries move to the
+// next entry that is kept.
+func writeUsernameMap(path string, entries []UsernameMapEntry) error {
+	existing, comments, err := readUsernameMap(path)
+	if err != nil {
+		return err
+	}
+
+	// Entries are matched by Unix name and occurrence, as a name can be
+	// mapped on several lines
+	entryKeys := func(list []UsernameMapEntry) []string {
+		seen := make(map[string]int)
+		keys := make([]string, len(list))
+		for i, entry := range list {
+			keys[i] = fmt.Sprintf("%s#%d", entry.UnixName, seen[entry.UnixName])
+			seen[entry.UnixName]++
+		}
+		return keys
+	}
+	newKeys := entryKeys(entries)
+	kept := make(map[string]bool)
+	for _, key := range newKeys {
+		kept[key] = true
+	}
+
+	// The lines before the first entry up to its last blank line are the
+	// header of the file and stay on top, all of them without a blank line
+	var header []string
+	if len(existing) > 0 {
+		first := comments.before[0]
+		split := len(first)
+		for i := len(first) - 1; i >= 0; i-- {
+			if strings.TrimSpace(first[i]) == "" {
+				split = i + 1
+				break
+			}
+		}
+		header, comments.before[0] = first[:split], first[split:]
+	}
+
+	blocks := make(map[string][]string)
+	var pending []string
+	for i, key := range entryKeys(existing) {
+		pending = append(pending, comments.before[i]...)
+		if kept[key] {
+			blocks[key] = pending
+			pending = nil
+		}
+	}
+	footer := append(pending, comments.after...)
+
+	lines := append([]string{}, header...)
+	switch {
+	case len(existing) == 0 && len(footer) == 0:
+		lines = append(lines, usernameMapHeader)
+	case len(existing) == 0:
+		// A map without entries only has a header
+		lines, footer = footer, nil
+	}
+
+	for i, entry := range entries {
+		lines = append(lines, blocks[newKeys[i]]...)
+
+		prefix := ""
+		if entry.Stop {
+			prefix = "!"
+		}
+
+		names := make([]string, len(entry.WindowsNames))
+		for i, name := range entry.WindowsNames {
+			if strings.ContainsAny(name, " \t") {
+				name = `"` + name + `"`
+			}
+			names[i] = name
+		}
+		lines = append(lines, fmt.Sprintf("%s%s = %s", prefix, entry.UnixName, strings.Join(names, " ")))
+	}
+	lines = append(lines, footer...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Failed to create directory for username map: %v", err)
+	}
+
+	perm := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+	// smbd rereads the map at every login, so it must never see a partial file
+	if err := writeFileAtomic(path, []byte(strings.Join(lines, "\n")+"\n"), perm); err != nil {
+		return fmt.Errorf("Failed to write username map: %v", err)
+	}
+
+	return nil
+}
+
+// validateUsernameMap fills in the errors, conflicts and warnings of a username map
+func validateUsernameMap(usermap *UsernameMap) {
+	usermap.Errors, usermap.Conflicts, usermap.Warnings = nil, nil, nil
+
+	sys := getBackend()
+	sambaUsers := make(map[string]bool)
+	if users, err := sys.PassDB.ListUsers(); err == nil {
+		for _, user := range users {
+			sambaUsers[strings.ToLower(user)] = true
+		}
+	}
+
+	// Windows names already claimed by an earlier entry
+	mappedTo := make(map[string]string)
+
+	for i, entry := range usermap.Entries {
+		if err := validatePosixName(entry.UnixName); err != nil {
+			usermap.Errors = append(usermap.Errors, UsernameMapIssue{Entry: i, Name: entry.UnixName, Message: err.Error()})
+			continue
+		}
+		if len(entry.WindowsNames) == 0 {
+			usermap.Errors = append(usermap.Errors, UsernameMapIssue{Entry: i, Name: entry.UnixName, Message: "At least one Windows name is required"})
+			continue
+		}
+
+		if _, err := sys.Accounts.LookupUser(entry.UnixName); err != nil {
+			usermap.Warnings = append(usermap.Warnings, UsernameMapIssue{Entry: i, Name: entry.UnixName, Message: "Unix user does not exist"})
+		} else if !sambaUsers[strings.ToLower(entry.UnixName)] {
+			usermap.Warnings = append(usermap.Warnings, UsernameMapIssue{Entry: i, Name: entry.UnixName, Message: "Unix user is not a Samba user"})
+		}
+
+		for _, name := range entry.WindowsNames {
+			if name == "" || strings.ContainsAny(name, "\"=\r\n") {
+				usermap.Errors = append(usermap.Errors, UsernameMapIssue{Entry: i, Name: name, Message: "Windows names cannot be empty or contain quotes, '=' or line breaks"})
+				continue
+			}
+			if name == "*" || strings.HasPrefix(name, "@") || strings.HasPrefix(name, "+") || strings.HasPrefix(name, "&") {
+				continue
+			}
+
+			// Samba compares names case-insensitively
+			key := strings.ToLower(name)
+			if key != strings.ToLower(entry.UnixName) && sambaUsers[key] {
+				usermap.Conflicts = append(usermap.Conflicts, UsernameMapIssue{
+					Entry:   i,
+					Name:    name,
+					Message: fmt.Sprintf("Samba user %s would log in as %s", name, entry.UnixName),
+				})
+			}
+			if previous, ok := mappedTo[key]; ok && previous != entry.UnixName {
+				usermap.Conflicts = append(usermap.Conflicts, UsernameMapIssue{
+					Entry:   i,
+					Name:    name,
+					Message: fmt.Sprintf("%s is already mapped to %s", name, previous),
+				})
+			}
+			mappedTo[key] = entry.UnixName
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unsetUsernameMap removes the username map from [global]
+func unsetUsernameMap(t *testing.T) {
+	t.Helper()
+	config, err := ReadConfig()
+	if err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	delete(config["global"], "username map")
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+}
+
+func TestUpdateUsernameMapCreatesNewMapNextToConfig(t *testing.T) {
+	_, h := newTestAPI(t)
+	unsetUsernameMap(t)
+
+	mapFile := filepath.Join(filepath.Dir(GetConfigPath()), "users.map")
+	rec := serve(h, http.MethodPost, "/usermap", `{"path": "`+mapFile+`", "entries": [{"unixName": "alice", "windowsNames": ["ALICE"]}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	data, _ := os.ReadFile(mapFile)
+	if want := usernameMapHeader + "\nalice = ALICE\n"; string(data) != want {
+		t.Errorf("username map = %q", data)
+	}
+	config, _ := ReadConfig()
+	if config["global"]["username map"] != mapFile {
+		t.Errorf("username map parameter = %q", config["global"]["username map"])
+	}
+}
+
+func TestUpdateUsernameMapRejectsUnsafeNewPaths(t *testing.T) {
+	_, h := newTestAPI(t)
+	unsetUsernameMap(t)
+
+	outside := filepath.Join(t.TempDir(), "passwd")
+	if err := os.WriteFile(outside, []byte("root:x:0:0:root:/root:/bin/bash\n"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	foreign := filepath.Join(filepath.Dir(GetConfigPath()), "lmhosts")
+	if err := os.WriteFile(foreign, []byte("127.0.0.1 localhost\n"), 0644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+
+	for _, path := range []string{outside, foreign, GetConfigPath(), filepath.Dir(GetConfigPath())} {
+		rec := serve(h, http.MethodPost, "/usermap", `{"path": "`+path+`", "entries": [{"unixName": "alice", "windowsNames": ["ALICE"]}]}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want 400", path, rec.Code)
+		}
+	}
+
+	if data, _ := os.ReadFile(outside); !strings.HasPrefix(string(data), "root:") {
+		t.Errorf("file outside the config directory was overwritten: %q", data)
+	}
+	if data, _ := os.ReadFile(foreign); string(data) != "127.0.0.1 localhost\n" {
+		t.Errorf("existing file was overwritten: %q", data)
+	}
+	if config, _ := ReadConfig(); config["global"]["username map"] != "" {
+		t.Errorf("username map parameter = %q", config["global"]["username map"])
+	}
+}
+
+func TestUpdateUsernameMapKeepsComments(t *testing.T) {
+	_, h := newTestAPI(t)
+
+	mapFile, _ := usernameMapPath()
+	content := "# Site map\n\n# Alice's Windows logins\nalice = ALICE\n; retired, keep until 2025\nbob = robert\n\n# trailing note\n"
+	if err := os.WriteFile(mapFile, []byte(content), 0640); err != nil {
+		t.Fatalf("write map: %v", err)
+	}
+	os.Chmod(mapFile, 0640)
+
+	rec := serve(h, http.MethodPost, "/usermap", `{"entries": [{"unixName": "alice", "windowsNames": ["ALICE", "Alice Smith"]}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	data, _ := os.ReadFile(mapFile)
+	want := "# Site map\n\n# Alice's Windows logins\nalice = ALICE \"Alice Smith\"\n; retired, keep until 2025\n\n# trailing note\n"
+	if string(data) != want {
+		t.Errorf("username map = %q, want %q", data, want)
+	}
+	if info, err := os.Stat(mapFile); err != nil || info.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v, err = %v", info.Mode(), err)
+	}
+
+	// The header stays on top and moved entries take their comments along
+	rec = serve(h, http.MethodPost, "/usermap", `{"entries": [{"unixName": "carol", "windowsNames": ["CAROL"]}, {"unixName": "alice", "windowsNames": ["ALICE"]}]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+	data, _ = os.ReadFile(mapFile)
+	want = "# Site map\n\ncarol = CAROL\n# Alice's Windows logins\nalice = ALICE\n; retired, keep until 2025\n\n# trailing note\n"
+	if string(data) != want {
+		t.Errorf("username map = %q, want %q", data, want)
+	}
+}
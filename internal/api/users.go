@@ -1,16 +1,10 @@
 package api
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"os/exec"
-	"os/user"
 	"regexp"
-	"strconv"
-	"strings"
 )
 
 // GetUsers returns all Samba users
@@ -22,7 +16,8 @@ func (h *APIHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 	}
 
 	json.NewEncoder(w).Encode(UserListResponse{
-		Users: users,
+		Users:    users,
+		Accounts: classifyUsers(users),
 	})
 }
 
@@ -30,6 +25,11 @@ func (h *APIHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)$`), r.URL.Path, 1)
 
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	var passwordReq PasswordRequest
 	err := json.NewDecoder(r.Body).Decode(&passwordReq)
 	if err != nil {
@@ -48,6 +48,19 @@ func (h *APIHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Provision the home directory; the user exists even if this fails
+	if GetHomeConfig().AutoCreate {
+		if _, err := createUserHomeDirectory(username); err != nil {
+			w.WriteHeader(http.StatusOK)
+			json.NewEncoder(w).Encode(APIResponse{
+				Status:  "warning",
+				Message: "User created successfully",
+				Error:   fmt.Sprintf("Home directory was not created: %v", err),
+			})
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
@@ -59,16 +72,43 @@ func (h *APIHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)$`), r.URL.Path, 1)
 
-	err := deleteSambaUser(username)
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkUserModifiable(username); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	// The home directory action can be overridden per request
+	homeAction := r.URL.Query().Get("home")
+	if homeAction == "" {
+		homeAction = GetHomeConfig().OnDelete
+	}
+	if homeAction == "" {
+		homeAction = HomeActionKeep
+	}
+	if err := validateHomeAction(homeAction); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	homeResult, err := deleteSambaUser(username, homeAction)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	message := "User deleted successfully"
+	if homeResult != "" {
+		message = fmt.Sprintf("%s. %s", message, homeResult)
+	}
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
-		Message: "User deleted successfully",
+		Message: message,
 	})
 }
 
@@ -76,6 +116,15 @@ func (h *APIHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 func (h *APIHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)/password$`), r.URL.Path, 1)
 
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkUserModifiable(username); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
 	var passwordReq PasswordRequest
 	err := json.NewDecoder(r.Body).Decode(&passwordReq)
 	if err != nil {
@@ -103,79 +152,108 @@ func (h *APIHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 // getSambaUsers returns a list of all Samba users
 func getSambaUsers() ([]string, error) {
-	cmd := exec.Command(SMB_USER_LIST_CMD, "-L")
-	output, err := cmd.CombinedOutput()
+	users, err := getBackend().PassDB.ListUsers()
 	if err != nil {
 		return nil, fmt.Errorf("Failed to list Samba users: %v", err)
 	}
 
-	var users []string
-	scanner := bufio.NewScanner(strings.NewReader(string(output)))
-	for scanner.Scan() {
-		line := scanner.Text()
-		if strings.Contains(line, ":") {
-			username := strings.TrimSpace(strings.Split(line, ":")[0])
-			if username != "" && !strings.HasPrefix(username, "#") {
-				users = append(users, username)
-			}
+	return users, nil
+}
+
+// classifyUsers returns the UID and system/protected status of each user
+func classifyUsers(users []string) []UserInfo {
+	policy := GetAccountPolicy()
+
+	uids := make(map[string]int)
+	if accounts, err := getBackend().Accounts.ListUsers(); err == nil {
+		for _, account := range accounts {
+			uids[account.Name] = account.UID
 		}
 	}
 
-	return users, nil
+	infos := make([]UserInfo, 0, len(users))
+	for _, name := range users {
+		info := UserInfo{Name: name, UID: -1, Protected: policy.IsProtectedUser(name)}
+		if uid, ok := uids[name]; ok {
+			info.UID = uid
+			info.IsSystem = policy.IsSystemUID(uid)
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
 }
 
 // createSambaUser creates a new Samba user
 func createSambaUser(username, password string) error {
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	sys := getBackend()
+
 	// Add user to system
-	sysCmd := exec.Command("useradd", "-M", "-s", "/sbin/nologin", username)
-	err := sysCmd.Run()
+	err := sys.Accounts.CreateUser(username)
 	if err != nil {
 		return fmt.Errorf("Failed to create system user: %v", err)
 	}
 
-	// Add to Samba database
-	smbCmd := exec.Command(SMB_USER_ADD_CMD, "-a", "-u", username)
-	smbCmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n%s\n", password, password))
-	err = smbCmd.Run()
+	// Add to Samba database and set password
+	err = sys.PassDB.AddUser(username, password)
 	if err != nil {
 		return fmt.Errorf("Failed to add Samba user: %v", err)
 	}
 
-	// Set password
-	passCmd := exec.Command(SMB_PASSWD_CMD, "-a", username)
-	passCmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n%s\n", password, password))
-	err = passCmd.Run()
-	if err != nil {
-		return fmt.Errorf("Failed to set Samba password: %v", err)
-	}
-
 	return nil
 }
 
-// deleteSambaUser deletes a Samba user
-func deleteSambaUser(username string) error {
+// deleteSambaUser deletes a Samba user and handles its home directory
+// according to homeAction, returning a description of the home handling
+func deleteSambaUser(username, homeAction string) (string, error) {
+	if err := validateUsername(username); err != nil {
+		return "", err
+	}
+
+	sys := getBackend()
+
+	// Resolve the home directory while the account still exists
+	account, lookupErr := sys.Accounts.LookupUser(username)
+	homePath := ""
+	if lookupErr == nil && homeAction != HomeActionKeep {
+		homePath, _ = resolveHomePath(account, GetHomeConfig())
+	}
+
 	// Delete from Samba database
-	smbCmd := exec.Command(SMB_USER_DEL_CMD, "-x", username)
-	err := smbCmd.Run()
+	err := sys.PassDB.DeleteUser(username)
 	if err != nil {
-		return fmt.Errorf("Failed to delete Samba user: %v", err)
+		return "", fmt.Errorf("Failed to delete Samba user: %v", err)
 	}
 
 	// Remove from system
-	sysCmd := exec.Command("userdel", username)
-	err = sysCmd.Run()
+	err = sys.Accounts.DeleteUser(username)
 	if err != nil {
-		return fmt.Errorf("Failed to delete system user: %v", err)
+		return "", fmt.Errorf("Failed to delete system user: %v", err)
 	}
 
-	return nil
+	if homePath == "" {
+		return "", nil
+	}
+
+	result, err := offboardHomeDirectory(account, homePath, homeAction)
+	if err != nil {
+		return "", fmt.Errorf("User deleted, but the home directory was not processed: %v", err)
+	}
+
+	return result, nil
 }
 
 // changeSambaPassword changes a user's password
 func changeSambaPassword(username, password string) error {
-	cmd := exec.Command(SMB_PASSWD_CMD, username)
-	cmd.Stdin = strings.NewReader(fmt.Sprintf("%s\n%s\n", password, password))
-	err := cmd.Run()
+	if err := validateUsername(username); err != nil {
+		return err
+	}
+
+	err := getBackend().PassDB.SetPassword(username, password)
 	if err != nil {
 		return fmt.Errorf("Failed to change password: %v", err)
 	}
@@ -187,7 +265,16 @@ func changeSambaPassword(username, password string) error {
 func (h *APIHandler) CreateUserHomeDirectory(w http.ResponseWriter, r *http.Request) {
 	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)/home$`), r.URL.Path, 1)
 
-	err := createUserHomeDirectory(username)
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkUserModifiable(username); err != nil {
+		writeError(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	homePath, err := createUserHomeDirectory(username)
 	if err != nil {
 		writeError(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -196,53 +283,15 @@ func (h *APIHandler) CreateUserHomeDirectory(w http.ResponseWriter, r *http.Requ
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(APIResponse{
 		Status:  "success",
-		Message: fmt.Sprintf("Home directory created for user %s", username),
+		Message: fmt.Sprintf("Home directory %s created for user %s", homePath, username),
 	})
 }
 
 // createUserHomeDirectory creates a home directory for the specified user
-func createUserHomeDirectory(username string) error {
-	// Verify the user exists
-	_, err := user.Lookup(username)
-	if err != nil {
-		return fmt.Errorf("User %s does not exist", username)
+func createUserHomeDirectory(username string) (string, error) {
+	if err := validateUsername(username); err != nil {
+		return "", err
 	}
 
-	// Construct the full path for the user's home directory
-	homePath := fmt.Sprintf("/home/%s", username)
-
-	// Check if home directory already exists
-	if _, err := os.Stat(homePath); err == nil {
-		return fmt.Errorf("Home directory for user %s already exists", username)
-	}
-
-	// Create the home directory with appropriate permissions
-	// 0755 means rwxr-xr-x (owner can read/write/execute, group and others can read/execute)
-	err = os.MkdirAll(homePath, 0755)
-	if err != nil {
-		return fmt.Errorf("Failed to create home directory for user %s: %v", username, err)
-	}
-
-	// Change ownership of the directory to the new user
-	userInfo, err := user.Lookup(username)
-	if err != nil {
-		return fmt.Errorf("Failed to lookup user information for %s: %v", username, err)
-	}
-
-	uid, err := strconv.Atoi(userInfo.Uid)
-	if err != nil {
-		return fmt.Errorf("Failed to convert user ID to integer: %v", err)
-	}
-
-	gid, err := strconv.Atoi(userInfo.Gid)
-	if err != nil {
-		return fmt.Errorf("Failed to convert group ID to integer: %v", err)
-	}
-
-	err = os.Chown(homePath, uid, gid)
-	if err != nil {
-		return fmt.Errorf("Failed to set ownership of home directory for user %s: %v", username, err)
-	}
-
-	return nil
+	return provisionHomeDirectory(username)
 }
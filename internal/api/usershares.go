@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Share access levels
+const (
+	AccessNone  = "none"
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// UserShareAccess describes what a user can do on one share
+type UserShareAccess struct {
+	Share      string   `json:"share"`
+	Path       string   `json:"path"`
+	Access     string   `json:"access"`
+	Admin      bool     `json:"admin"`
+	Guest      bool     `json:"guest"`
+	Browseable bool     `json:"browseable"`
+	Reasons    []string `json:"reasons"`
+}
+
+// UserSharesResponse represents the response for a user's share overview
+type UserSharesResponse struct {
+	User   string            `json:"user"`
+	Groups []string          `json:"groups"`
+	Shares []UserShareAccess `json:"shares"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// GetUserShares lists the shares a user can reach and with which rights
+func (h *APIHandler) GetUserShares(w http.ResponseWriter, r *http.Request) {
+	username := getRouteParam(regexp.MustCompile(`^/users/([^/]+)/shares$`), r.URL.Path, 1)
+
+	if err := validateUsername(username); err != nil {
+		writeError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	account, err := getBackend().Accounts.LookupUser(username)
+	if err != nil {
+		writeError(w, fmt.Sprintf("User %s does not exist", username), http.StatusNotFound)
+		return
+	}
+
+	// Denied shares are only listed on request
+	includeAll := r.URL.Query().Get("all") == "true"
+
+	response, err := getUserShares(account, includeAll)
+	if err != nil {
+		writeError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// getUserShares resolves direct and group-based access of an account to every share
+func getUserShares(account Account, includeAll bool) (UserSharesResponse, error) {
+	response := UserSharesResponse{User: account.Name, Groups: []string{}, Shares: []UserShareAccess{}}
+
+	groups, primaryGroup, err := userGroups(account)
+	if err != nil {
+		return response, err
+	}
+	for group := range groups {
+		response.Groups = append(response.Groups, group)
+	}
+	sort.Strings(response.Groups)
+
+	config, err := ReadConfig()
+	if err != nil {
+		return response, err
+	}
+	global := normalizeShareParams(config["global"])
+
+	names := make([]string, 0, len(config))
+	for name := range config {
+		if name != "global" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		params := normalizeShareParams(config[name])
+		lookup := func(param string) string {
+			if value, ok := params[param]; ok {
+				return value
+			}
+			return global[param]
+		}
+
+		// [homes] appears to each user as a share named after them
+		shareName := name
+		if name == "homes" {
+			shareName = account.Name
+		}
+
+		access := resolveShareAccess(account.Name, groups, lookup, func(value string) string {
+			return expandSambaMacros(value, account, primaryGroup)
+		})
+		access.Share = shareName
+		access.Path = expandSambaMacros(lookup("path"), account, primaryGroup)
+		if name == "homes" {
+			if access.Path == "" {
+				access.Path = account.Home
+			}
+			access.Reasons = append(access.Reasons, "[homes] share of the user")
+		}
+
+		if access.Access == AccessNone && !includeAll {
+			continue
+		}
+		response.Shares = append(response.Shares, access)
+	}
+
+	return response, nil
+}
+
+// resolveShareAccess applies Samba's access rules for a user to one share
+func resolveShareAccess(username string, groups map[string]bool, lookup func(string) string, expand func(string) string) UserShareAccess {
+	access := UserShareAccess{Access: AccessNone, Reasons: []string{}}
+
+	access.Guest = parseSambaBool(lookup("guest ok"), false)
+	access.Browseable = parseSambaBool(lookup("browseable"), true)
+
+	if via, ok := listMatches(expand(lookup("invalid users")), username, groups); ok {
+		access.Reasons = append(access.Reasons, "denied by invalid users"+via)
+		return access
+	}
+
+	if validUsers := expand(lookup("valid users")); validUsers != "" {
+		via, ok := listMatches(validUsers, username, groups)
+		if !ok {
+			access.Reasons = append(access.Reasons, "not in valid users")
+			return access
+		}
+		access.Reasons = append(access.Reasons, "valid users"+via)
+	}
+
+	access.Access = AccessRead
+	if !parseSambaBool(lookup("read only"), true) {
+		access.Access = AccessWrite
+	}
+
+	if via, ok := listMatches(expand(lookup("read list")), username, groups); ok {
+		access.Access = AccessRead
+		access.Reasons = append(access.Reasons, "read list"+via)
+	}
+	if via, ok := listMatches(expand(lookup("write list")), username, groups); ok {
+		access.Access = AccessWrite
+		access.Reasons = append(access.Reasons, "write list"+via)
+	}
+	if via, ok := listMatches(expand(lookup("admin users")), username, groups); ok {
+		access.Admin = true
+		access.Access = AccessWrite
+		access.Reasons = append(access.Reasons, "admin users"+via)
+	}
+
+	return access
+}
+
+// listMatches reports whether a user list names the user directly or through
+// one of its groups, returning " via @group" for group matches
+func listMatches(value, username string, groups map[string]bool) (string, bool) {
+	for _, token := range listTokenRegex.FindAllString(value, -1) {
+		name := strings.Trim(token, `"`)
+		prefix := groupPrefixRegex.FindString(name)
+		name = name[len(prefix):]
+
+		if prefix == "" {
+			if strings.EqualFold(name, username) {
+				return "", true
+			}
+			continue
+		}
+
+		// & alone means an NIS netgroup, which can't be resolved here
+		if prefix == "&" {
+			continue
+		}
+		if groups[name] {
+			return " via " + prefix + name, true
+		}
+	}
+	return "", false
+}
+
+// userGroups returns the primary and supplementary groups of an account
+func userGroups(account Account) (map[string]bool, string, error) {
+	entries, err := getBackend().Accounts.ListGroups()
+	if err != nil {
+		return nil, "", fmt.Errorf("Failed to list groups: %v", err)
+	}
+
+	groups := make(map[string]bool)
+	primary := ""
+	for _, entry := range entries {
+		if entry.GID == account.GID {
+			groups[entry.Name] = true
+			primary = entry.Name
+			continue
+		}
+		for _, member := range entry.Members {
+			if member == account.Name {
+				groups[entry.Name] = true
+				break
+			}
+		}
+	}
+
+	return groups, primary, nil
+}
+
+// shareParamSynonyms maps parameter synonyms to their canonical name
+var shareParamSynonyms = map[string]string{
+	"public":    "guest ok",
+	"browsable": "browseable",
+}
+
+// inverseReadOnly are the inverse synonyms of read only
+var inverseReadOnly = map[string]bool{
+	"writable":  true,
+	"writeable": true,
+	"write ok":  true,
+}
+
+// normalizeShareParams returns a section with lower-case, canonical
+// parameter names so synonyms in a share override [global] correctly
+func normalizeShareParams(section SectionConfig) map[string]string {
+	params := make(map[string]string, len(section))
+	for key, value := range section {
+		key = strings.ToLower(key)
+		if canonical, ok := shareParamSynonyms[key]; ok {
+			key = canonical
+		}
+		if inverseReadOnly[key] {
+			key = "read only"
+			if parseSambaBool(value, false) {
+				value = "no"
+			} else {
+				value = "yes"
+			}
+		}
+		params[key] = value
+	}
+	return params
+}
+
+// parseSambaBool parses a Samba boolean, returning def for empty or unknown values
+func parseSambaBool(value string, def bool) bool {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "yes", "true", "1", "on":
+		return true
+	case "no", "false", "0", "off":
+		return false
+	}
+	return def
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestUserSharesResolvesGroupsHomesAndGuests(t *testing.T) {
+	fake, h := newTestAPI(t)
+	fake.AddGroup("projects", 3000, "alice")
+
+	config, _ := ReadConfig()
+	config["global"]["guest ok"] = "no"
+	config["homes"] = SectionConfig{"path": "/srv/homes/%S", "valid users": "%S", "read only": "no", "browseable": "no"}
+	config["projects"] = SectionConfig{"path": "/srv/projects", "valid users": "+projects", "read list": "@projects", "admin users": "alice"}
+	config["docs"] = SectionConfig{"path": "/srv/docs", "public": "yes", "writable": "yes", "write list": "@staff"}
+	config["secret"] = SectionConfig{"path": "/srv/secret", "invalid users": "@staff"}
+	if err := WriteConfig(config); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+
+	rec := serve(h, http.MethodGet, "/users/alice/shares?all=true", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d; body: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp UserSharesResponse
+	decode(t, rec, &resp)
+	shares := make(map[string]UserShareAccess)
+	for _, share := range resp.Shares {
+		shares[share.Share] = share
+	}
+
+	if home := shares["alice"]; home.Path != "/srv/homes/alice" || home.Access != AccessWrite || home.Browseable {
+		t.Errorf("home share = %+v", home)
+	}
+	if projects := shares["projects"]; projects.Access != AccessWrite || !projects.Admin {
+		t.Errorf("projects = %+v", projects)
+	}
+	if docs := shares["docs"]; docs.Access != AccessWrite || !docs.Guest || docs.Reasons[0] != "write list via @staff" {
+		t.Errorf("docs = %+v", docs)
+	}
+	if secret := shares["secret"]; secret.Access != AccessNone {
+		t.Errorf("secret = %+v", secret)
+	}
+	if len(resp.Groups) != 3 {
+		t.Errorf("groups = %v", resp.Groups)
+	}
+
+	// bob is not in projects or staff
+	rec = serve(h, http.MethodGet, "/users/bob/shares", "")
+	decode(t, rec, &resp)
+	for _, share := range resp.Shares {
+		if share.Share == "projects" {
+			t.Errorf("bob can reach projects: %+v", share)
+		}
+		if share.Share == "docs" && share.Access != AccessWrite {
+			t.Errorf("bob docs = %+v", share)
+		}
+	}
+}
@@ -12,8 +12,9 @@ import (
 type Config struct {
 	// Manager configuration
 	Manager struct {
-		Port string `yaml:"port"` // Port to listen on
-		Host string `yaml:"host"` // Host to bind to
+		Port    string `yaml:"port"`    // Port to listen on
+		Host    string `yaml:"host"`    // Host to bind to
+		DataDir string `yaml:"dataDir"` // Directory for manager-side state
 	} `yaml:"manager"`
 
 	// Samba configuration
@@ -21,11 +22,62 @@ type Config struct {
 		ConfigPath string `yaml:"configPath"` // Path to smb.conf
 	} `yaml:"samba"`
 
+	// Samba service control
+	Service struct {
+		InitSystem     string `yaml:"initSystem"`     // auto, systemd, openrc, sysv or direct
+		CoalesceMillis int    `yaml:"coalesceMillis"` // Window merging reload/restart requests, 0 applies immediately
+	} `yaml:"service"`
+
+	// Session history collection
+	History struct {
+		Enabled         bool `yaml:"enabled"`         // Sample sessions and share connections in the background
+		IntervalSeconds int  `yaml:"intervalSeconds"` // Time between samples
+		RetentionDays   int  `yaml:"retentionDays"`   // Samples and clients older than this are deleted
+	} `yaml:"history"`
+
 	// Authentication configuration
 	Auth struct {
-		Username string `yaml:"username"` // Basic auth username
-		Password string `yaml:"password"` // Basic auth password
+		Username string `yaml:"username"` // First admin, created when the admin store is empty
+		Password string `yaml:"password"` // Password of the first admin, hashed into the store
 	} `yaml:"auth"`
+
+	// Self-service password portal configuration
+	SelfService struct {
+		Enabled       bool `yaml:"enabled"`       // Expose the portal outside admin auth
+		MaxAttempts   int  `yaml:"maxAttempts"`   // Attempts allowed per client/user within the window
+		WindowMinutes int  `yaml:"windowMinutes"` // Rate limit window in minutes
+	} `yaml:"selfService"`
+
+	// Home directory provisioning
+	Homes struct {
+		BasePath   string   `yaml:"basePath"`   // Used when [homes] has no path, supports Samba macros
+		Mode       string   `yaml:"mode"`       // Octal mode of new home directories
+		Skeleton   string   `yaml:"skeleton"`   // Directory copied into new homes, empty to disable
+		Quota      string   `yaml:"quota"`      // Block quota such as 10G, empty to disable
+		ACL        []string `yaml:"acl"`        // Extra ACL entries such as g:staff:r-x
+		AutoCreate bool     `yaml:"autoCreate"` // Provision homes when users are created
+
+		OnDelete     string `yaml:"onDelete"`     // keep, archive, move or delete when a user is removed
+		ArchivePath  string `yaml:"archivePath"`  // Directory receiving home tarballs
+		DepartedPath string `yaml:"departedPath"` // Directory receiving moved homes
+	} `yaml:"homes"`
+
+	// UID/GID ranges and accounts the manager must not touch
+	Accounts struct {
+		LoginDefs       string   `yaml:"loginDefs"`       // Source of UID_MIN/UID_MAX/GID_MIN/GID_MAX
+		UIDMin          int      `yaml:"uidMin"`          // Overrides login.defs when non-zero
+		UIDMax          int      `yaml:"uidMax"`          // Overrides login.defs when non-zero
+		GIDMin          int      `yaml:"gidMin"`          // Overrides login.defs when non-zero
+		GIDMax          int      `yaml:"gidMax"`          // Overrides login.defs when non-zero
+		ProtectedUsers  []string `yaml:"protectedUsers"`  // Users that can't be deleted or modified
+		ProtectedGroups []string `yaml:"protectedGroups"` // Groups that can't be deleted or modified
+	} `yaml:"accounts"`
+
+	// Password policy applied to self-service password changes
+	PasswordPolicy struct {
+		MinLength         int  `yaml:"minLength"`         // Minimum password length
+		RequireComplexity bool `yaml:"requireComplexity"` // Require three of: upper, lower, digit, symbol
+	} `yaml:"passwordPolicy"`
 }
 
 // DefaultConfig returns the default configuration
@@ -35,14 +87,47 @@ func DefaultConfig() *Config {
 	// Manager defaults
 	cfg.Manager.Port = "8080"
 	cfg.Manager.Host = "localhost"
+	cfg.Manager.DataDir = "/var/lib/samba-manager"
 
 	// Samba defaults
 	cfg.Samba.ConfigPath = "/etc/samba/smb.conf"
 
+	// Service defaults
+	cfg.Service.InitSystem = "auto"
+	cfg.Service.CoalesceMillis = 2000
+
+	// History defaults
+	cfg.History.Enabled = true
+	cfg.History.IntervalSeconds = 60
+	cfg.History.RetentionDays = 90
+
 	// Auth defaults
 	cfg.Auth.Username = "admin"
 	cfg.Auth.Password = "admin"
 
+	// Self-service defaults
+	cfg.SelfService.Enabled = false
+	cfg.SelfService.MaxAttempts = 5
+	cfg.SelfService.WindowMinutes = 15
+
+	// Home directory defaults
+	cfg.Homes.BasePath = ""
+	cfg.Homes.Mode = "0700"
+	cfg.Homes.Skeleton = "/etc/skel"
+	cfg.Homes.AutoCreate = true
+	cfg.Homes.OnDelete = "keep"
+	cfg.Homes.ArchivePath = "/var/backups/samba-manager/homes"
+	cfg.Homes.DepartedPath = "/srv/departed-homes"
+
+	// Account defaults
+	cfg.Accounts.LoginDefs = "/etc/login.defs"
+	cfg.Accounts.ProtectedUsers = []string{"root", "nobody"}
+	cfg.Accounts.ProtectedGroups = []string{"root", "wheel", "sudo", "adm", "nogroup", "nobody"}
+
+	// Password policy defaults
+	cfg.PasswordPolicy.MinLength = 8
+	cfg.PasswordPolicy.RequireComplexity = true
+
 	return cfg
 }
 
@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"embed"
 	"io"
 	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"path"
 	"samba-manager/internal/api"
 	"samba-manager/internal/config"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -24,10 +28,77 @@ func main() {
 
 	// Set config in API
 	api.SetConfigPath(cfg.Samba.ConfigPath)
+	api.SetDataDir(cfg.Manager.DataDir)
+	if err := api.SetInitSystem(cfg.Service.InitSystem); err != nil {
+		log.Printf("Warning: %v; detecting the init system", err)
+		api.SetInitSystem(api.InitSystemAuto)
+	}
+	api.SetServiceApplyWindow(time.Duration(cfg.Service.CoalesceMillis) * time.Millisecond)
 
-	// Set auth config
+	// Set auth config, which creates the first admin of an empty admin store
 	api.SetAuthConfig(cfg.Auth.Username, cfg.Auth.Password)
 
+	// Set home directory provisioning
+	api.SetHomeConfig(api.HomeConfig{
+		BasePath:   cfg.Homes.BasePath,
+		Mode:       cfg.Homes.Mode,
+		Skeleton:   cfg.Homes.Skeleton,
+		Quota:      cfg.Homes.Quota,
+		ACL:        cfg.Homes.ACL,
+		AutoCreate: cfg.Homes.AutoCreate,
+
+		OnDelete:     cfg.Homes.OnDelete,
+		ArchivePath:  cfg.Homes.ArchivePath,
+		DepartedPath: cfg.Homes.DepartedPath,
+	})
+
+	// Set password policy
+	api.SetPasswordPolicy(api.PasswordPolicy{
+		MinLength:         cfg.PasswordPolicy.MinLength,
+		RequireComplexity: cfg.PasswordPolicy.RequireComplexity,
+	})
+
+	// Set UID/GID ranges and protected accounts
+	accountPolicy := api.GetAccountPolicy()
+	if cfg.Accounts.LoginDefs != "" {
+		if err := api.LoadLoginDefs(cfg.Accounts.LoginDefs, &accountPolicy); err != nil {
+			log.Printf("Warning: %v; using default UID/GID ranges", err)
+		}
+	}
+	if cfg.Accounts.UIDMin != 0 {
+		accountPolicy.UIDMin = cfg.Accounts.UIDMin
+	}
+	if cfg.Accounts.UIDMax != 0 {
+		accountPolicy.UIDMax = cfg.Accounts.UIDMax
+	}
+	if cfg.Accounts.GIDMin != 0 {
+		accountPolicy.GIDMin = cfg.Accounts.GIDMin
+	}
+	if cfg.Accounts.GIDMax != 0 {
+		accountPolicy.GIDMax = cfg.Accounts.GIDMax
+	}
+	accountPolicy.ProtectedUsers = cfg.Accounts.ProtectedUsers
+	accountPolicy.ProtectedGroups = cfg.Accounts.ProtectedGroups
+	api.SetAccountPolicy(accountPolicy)
+
+	// Manage admins from the command line
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		os.Exit(runAdminCommand(os.Args[2:]))
+	}
+	if err := api.InitAdminStore(); err != nil {
+		log.Fatalf("Failed to initialize admins: %v", err)
+	}
+
+	// Revert debug levels a previous run raised and could not revert
+	if err := api.RevertStoredDebugOverrides(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Start sampling sessions for the connection history
+	if cfg.History.Enabled && cfg.History.IntervalSeconds > 0 {
+		api.StartHistoryCollector(time.Duration(cfg.History.IntervalSeconds)*time.Second, time.Duration(cfg.History.RetentionDays)*24*time.Hour)
+	}
+
 	// Set up API handlers
 	apiHandler := api.NewAPIHandler()
 
@@ -43,6 +114,12 @@ func main() {
 	// API routes with authentication middleware
 	mux.Handle("/api/", api.BasicAuthMiddleware(http.StripPrefix("/api", apiHandler)))
 
+	// Self-service password portal - Samba users authenticate with their own password
+	if cfg.SelfService.Enabled {
+		selfServiceHandler := api.NewSelfServiceHandler(cfg.SelfService.MaxAttempts, time.Duration(cfg.SelfService.WindowMinutes)*time.Minute)
+		mux.Handle("/api/self-service/", http.StripPrefix("/api/self-service", selfServiceHandler))
+	}
+
 	// React app static files - no authentication for static content
 	fileServer := http.FileServer(http.FS(reactFS))
 
@@ -77,7 +154,29 @@ func main() {
 		IdleTimeout:  60 * time.Second,
 	}
 
-	log.Fatal(server.ListenAndServe())
+	// Revert raised debug levels and finish open requests on SIGINT and SIGTERM
+	stopped := make(chan struct{})
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+
+		log.Println("Shutting down...")
+		if err := api.RevertDebugOverrides(); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+		close(stopped)
+	}()
+
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
 }
 
 // Helper function to serve index.html